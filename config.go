@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/meiraka/vv/internal/log"
 	"github.com/meiraka/vv/internal/vv"
+	"github.com/meiraka/vv/internal/vv/auth"
+	"github.com/meiraka/vv/internal/vv/scrobble"
+	"github.com/meiraka/vv/internal/vv/webhook"
 	"github.com/spf13/pflag"
 	"gopkg.in/yaml.v2"
 )
@@ -25,17 +31,48 @@ type Config struct {
 		BinaryLimit    BinarySize `yaml:"binarylimit"`
 	} `yaml:"mpd"`
 	Server struct {
-		Addr           string `yaml:"addr"`
-		CacheDirectory string `yaml:"cache_directory"`
-		Cover          struct {
-			Local  bool `yaml:"local"`
-			Remote bool `yaml:"remote"`
+		Addr            string   `yaml:"addr"`
+		CacheDirectory  string   `yaml:"cache_directory"`
+		RecordDirectory string   `yaml:"record_directory"`
+		AllowedOrigins  []string `yaml:"allowed_origins"`
+		Cover           struct {
+			Local      bool `yaml:"local"`
+			Remote     bool `yaml:"remote"`
+			Thumbnails struct {
+				MaxSize BinarySize `yaml:"max_size"`
+				Sizes   []int      `yaml:"sizes"`
+			} `yaml:"thumbnails"`
 		} `yaml:"cover"`
+		Auth struct {
+			Users     []*ConfigUser  `yaml:"users"`
+			Tokens    []*ConfigToken `yaml:"tokens"`
+			Anonymous string         `yaml:"anonymous"`
+		} `yaml:"auth"`
 	} `yaml:"server"`
 	Playlist struct {
 		Tree      map[string]*ConfigListNode `yaml:"tree"`
 		TreeOrder []string                   `yaml:"tree_order"`
 	}
+	Scrobble []*ConfigScrobbler `yaml:"scrobble"`
+	Webhooks []*ConfigWebhook   `yaml:"webhooks"`
+	MQTT     struct {
+		Addr            string `yaml:"addr"`
+		ClientID        string `yaml:"client_id"`
+		UserName        string `yaml:"username"`
+		Password        string `yaml:"password"`
+		Topic           string `yaml:"topic"`
+		DiscoveryPrefix string `yaml:"discovery_prefix"`
+		Name            string `yaml:"name"`
+	} `yaml:"mqtt"`
+	MPRIS struct {
+		Enabled bool   `yaml:"enabled"`
+		Name    string `yaml:"name"`
+	} `yaml:"mpris"`
+	Log struct {
+		Level  log.Level  `yaml:"level"`
+		Format log.Format `yaml:"format"`
+		Access bool       `yaml:"access"`
+	} `yaml:"log"`
 	debug bool
 }
 
@@ -45,6 +82,10 @@ func DefaultConfig() *Config {
 	c.Server.Addr = ":8080"
 	c.Server.CacheDirectory = filepath.Join(os.TempDir(), "vv")
 	c.Server.Cover.Local = true
+	c.Server.Cover.Thumbnails.MaxSize = 64 * 1024 * 1024
+	c.Log.Level = log.LevelInfo
+	c.Log.Format = log.FormatText
+	c.MQTT.DiscoveryPrefix = "homeassistant"
 	return c
 }
 
@@ -97,6 +138,9 @@ func ParseConfig(dir []string, name string, args []string) (*Config, time.Time,
 	mb := flagset.String("mpd.binarylimit", "", "set the maximum binary response size of mpd")
 	sa := flagset.String("server.addr", "", "this app serving address")
 	si := flagset.Bool("server.cover.remote", false, "enable coverart via mpd api")
+	ll := flagset.String("log.level", "", "minimum log level(debug, info, warn, error)")
+	lf := flagset.String("log.format", "", "log output format(text, json)")
+	la := flagset.Bool("log.access", false, "enable http access log")
 	d := flagset.BoolP("debug", "d", false, "use local assets if exists")
 	flagset.Parse(args)
 	if len(*mn) != 0 {
@@ -124,6 +168,19 @@ func ParseConfig(dir []string, name string, args []string) (*Config, time.Time,
 	if *si {
 		c.Server.Cover.Remote = true
 	}
+	if len(*ll) != 0 {
+		if err := c.Log.Level.UnmarshalText([]byte(*ll)); err != nil {
+			return nil, date, err
+		}
+	}
+	if len(*lf) != 0 {
+		if err := c.Log.Format.UnmarshalText([]byte(*lf)); err != nil {
+			return nil, date, err
+		}
+	}
+	if *la {
+		c.Log.Access = true
+	}
 	c.debug = *d
 	fillConfig(c)
 	return c, date, nil
@@ -217,6 +274,121 @@ func toTree(t map[string]*ConfigListNode) vv.Tree {
 	return ret
 }
 
+// ConfigUser represents local user for authentication.
+type ConfigUser struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+	Role     string `yaml:"role"`
+}
+
+// ConfigToken represents api token for authentication.
+type ConfigToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"`
+}
+
+// authEnabled returns true if users or tokens are defined.
+func (c *Config) authEnabled() bool {
+	return len(c.Server.Auth.Users) != 0 || len(c.Server.Auth.Tokens) != 0
+}
+
+// toAuthConfig copies config auth to auth.Config.
+func toAuthConfig(c *Config) *auth.Config {
+	ret := &auth.Config{Anonymous: c.Server.Auth.Anonymous}
+	for _, u := range c.Server.Auth.Users {
+		ret.Users = append(ret.Users, auth.User{Name: u.Name, Password: u.Password, Role: u.Role})
+	}
+	for _, t := range c.Server.Auth.Tokens {
+		ret.Tokens = append(ret.Tokens, auth.Token{Name: t.Name, Token: t.Token, Role: t.Role})
+	}
+	return ret
+}
+
+// ConfigScrobbler represents user account for scrobbling api.
+type ConfigScrobbler struct {
+	Name       string `yaml:"name"`
+	API        string `yaml:"api"`
+	URL        string `yaml:"url"`
+	Token      string `yaml:"token"`
+	APIKey     string `yaml:"api_key"`
+	Secret     string `yaml:"secret"`
+	SessionKey string `yaml:"session_key"`
+}
+
+// toScrobbleConfigs copies config scrobble to scrobble.Config list.
+// retry queue is stored in server.cache_directory.
+func toScrobbleConfigs(c *Config, logger scrobble.Logger) ([]*scrobble.Config, error) {
+	names := make(map[string]struct{}, len(c.Scrobble))
+	ret := make([]*scrobble.Config, 0, len(c.Scrobble))
+	for i, s := range c.Scrobble {
+		if len(s.Name) == 0 {
+			return nil, fmt.Errorf("scrobble: #%d: name is empty", i)
+		}
+		if _, ok := names[s.Name]; ok {
+			return nil, fmt.Errorf("scrobble: %s: duplicated", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		ret = append(ret, &scrobble.Config{
+			Name:       s.Name,
+			API:        s.API,
+			URL:        s.URL,
+			Token:      s.Token,
+			APIKey:     s.APIKey,
+			Secret:     s.Secret,
+			SessionKey: s.SessionKey,
+			QueueFile:  filepath.Join(c.Server.CacheDirectory, "scrobble", url.PathEscape(s.Name)+".json"),
+			Logger:     logger,
+		})
+	}
+	return ret, nil
+}
+
+// ConfigWebhook represents http endpoint to post player and library events.
+type ConfigWebhook struct {
+	Name       string   `yaml:"name"`
+	URL        string   `yaml:"url"`
+	Secret     string   `yaml:"secret"`
+	Events     []string `yaml:"events"`
+	MaxRetries int      `yaml:"max_retries"`
+}
+
+// toWebhookConfigs copies config webhooks to webhook.Config list.
+func toWebhookConfigs(c *Config, logger webhook.Logger) ([]*webhook.Config, error) {
+	names := make(map[string]struct{}, len(c.Webhooks))
+	ret := make([]*webhook.Config, 0, len(c.Webhooks))
+	for i, w := range c.Webhooks {
+		if len(w.Name) == 0 {
+			return nil, fmt.Errorf("webhooks: #%d: name is empty", i)
+		}
+		if _, ok := names[w.Name]; ok {
+			return nil, fmt.Errorf("webhooks: %s: duplicated", w.Name)
+		}
+		names[w.Name] = struct{}{}
+		ret = append(ret, &webhook.Config{
+			Name:       w.Name,
+			URL:        w.URL,
+			Secret:     w.Secret,
+			Events:     w.Events,
+			MaxRetries: w.MaxRetries,
+			Logger:     logger,
+		})
+	}
+	return ret, nil
+}
+
+// localURL returns http server url for local clients.
+func (c *Config) localURL() string {
+	host, port, err := net.SplitHostPort(c.Server.Addr)
+	if err != nil {
+		return "http://localhost"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
 // BinarySize represents a number of binary size.
 type BinarySize uint64
 
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/meiraka/vv/internal/log"
 	"gopkg.in/yaml.v2"
 )
 
@@ -68,6 +69,9 @@ func TestParseConfigExample(t *testing.T) {
 	want.Server.CacheDirectory = "/tmp/vv"
 	want.Server.Cover.Local = true
 	want.Server.Cover.Remote = true
+	want.Server.Cover.Thumbnails.MaxSize = 64 * 1024 * 1024
+	want.Log.Format = log.FormatText
+	want.MQTT.DiscoveryPrefix = "homeassistant"
 	want.Playlist.Tree = map[string]*ConfigListNode{
 		"AlbumArtist": {
 			Sort: []string{"AlbumArtist", "Date", "Album", "DiscNumber", "TrackNumber", "Title", "file"},
@@ -119,6 +123,9 @@ func TestParseConfigDefault(t *testing.T) {
 	want.Server.Addr = ":8080"
 	want.Server.CacheDirectory = "/tmp/vv"
 	want.Server.Cover.Local = true
+	want.Server.Cover.Thumbnails.MaxSize = 64 * 1024 * 1024
+	want.Log.Format = log.FormatText
+	want.MQTT.DiscoveryPrefix = "homeassistant"
 	if !reflect.DeepEqual(config, want) {
 		t.Errorf("got %+v; want %+v", config, want)
 	}
@@ -134,6 +141,9 @@ func TestParseConfigOptions(t *testing.T) {
 		"--mpd.binarylimit", "32k",
 		"--server.addr", ":80",
 		"--server.cover.remote",
+		"--log.level", "warn",
+		"--log.format", "json",
+		"--log.access",
 	})
 	if err != nil {
 		t.Fatalf("failed to parse: %v", err)
@@ -152,6 +162,11 @@ func TestParseConfigOptions(t *testing.T) {
 	want.Server.CacheDirectory = "/tmp/vv"
 	want.Server.Cover.Local = true
 	want.Server.Cover.Remote = true
+	want.Server.Cover.Thumbnails.MaxSize = 64 * 1024 * 1024
+	want.Log.Level = log.LevelWarn
+	want.Log.Format = log.FormatJSON
+	want.Log.Access = true
+	want.MQTT.DiscoveryPrefix = "homeassistant"
 	if !reflect.DeepEqual(config, want) {
 		t.Errorf("got \n%+v; want \n%+v", config, want)
 	}
@@ -225,3 +240,20 @@ func TestBinarySize(t *testing.T) {
 	}
 
 }
+
+func TestConfigLocalURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8080":          "http://localhost:8080",
+		"0.0.0.0:8080":   "http://localhost:8080",
+		"[::]:8080":      "http://localhost:8080",
+		"127.0.0.1:80":   "http://127.0.0.1:80",
+		"[::1]:8080":     "http://[::1]:8080",
+		"example.com:80": "http://example.com:80",
+	} {
+		c := &Config{}
+		c.Server.Addr = addr
+		if got := c.localURL(); got != want {
+			t.Errorf("localURL(%q) got %q; want %q", addr, got, want)
+		}
+	}
+}
@@ -3,12 +3,19 @@ module github.com/meiraka/vv
 go 1.19
 
 require (
+	github.com/andybalholm/brotli v1.0.5
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/gorilla/websocket v1.4.1
+	github.com/klauspost/compress v1.16.7
 	github.com/spf13/pflag v1.0.3
 	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.6.0
 	golang.org/x/image v0.5.0
 	golang.org/x/text v0.7.0
 	gopkg.in/yaml.v2 v2.2.8
 )
 
-require golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
+require (
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+)
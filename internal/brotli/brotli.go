@@ -0,0 +1,21 @@
+package brotli
+
+import (
+	"bytes"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Encode encodes bytes to brotli compressed data.
+func Encode(data []byte) ([]byte, error) {
+	var br bytes.Buffer
+	bw := brotli.NewWriterLevel(&br, brotli.DefaultCompression)
+	_, err := bw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	return br.Bytes(), nil
+}
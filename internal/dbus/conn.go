@@ -0,0 +1,323 @@
+// Package dbus is a minimal D-Bus client to export objects on message bus.
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bus name request flags and replies
+const (
+	NameFlagDoNotQueue    uint32     = 4
+	NameReplyPrimaryOwner uint32     = 1
+	NameReplyAlreadyOwner uint32     = 4
+	busName                          = "org.freedesktop.DBus"
+	busPath               ObjectPath = "/org/freedesktop/DBus"
+)
+
+// ErrClosed is returned when connection is closed.
+var ErrClosed = errors.New("dbus: connection closed")
+
+// SessionBusAddress returns session bus address.
+func SessionBusAddress() (string, error) {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); len(addr) != 0 {
+		return addr, nil
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); len(dir) != 0 {
+		return "unix:path=" + dir + "/bus", nil
+	}
+	return "", errors.New("dbus: session bus address is not found")
+}
+
+// parseAddress returns first supported unix socket address in D-Bus server addresses.
+func parseAddress(addr string) (string, error) {
+	for _, a := range strings.Split(addr, ";") {
+		transport, kvs, ok := strings.Cut(a, ":")
+		if !ok || transport != "unix" {
+			continue
+		}
+		for _, kv := range strings.Split(kvs, ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			v, err := url.PathUnescape(v)
+			if err != nil {
+				return "", fmt.Errorf("dbus: invalid address: %q", addr)
+			}
+			switch k {
+			case "path":
+				return v, nil
+			case "abstract":
+				return "@" + v, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("dbus: unsupported address: %q", addr)
+}
+
+// Conn is a D-Bus message bus connection.
+type Conn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	name      string
+	serial    uint32
+	pending   map[uint32]chan *Message
+	calls     chan *Message
+	handler   func(*Conn, *Message)
+	done      chan struct{}
+	err       error
+	mu        sync.Mutex
+	wmu       sync.Mutex
+	closeOnce sync.Once
+}
+
+// Dial connects to D-Bus message bus. handler is called for each method call message in order.
+func Dial(ctx context.Context, addr string, handler func(*Conn, *Message)) (*Conn, error) {
+	path, err := parseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{}
+	nc, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	c := &Conn{
+		conn:    nc,
+		r:       bufio.NewReader(nc),
+		pending: map[uint32]chan *Message{},
+		calls:   make(chan *Message, 16),
+		handler: handler,
+		done:    make(chan struct{}),
+	}
+	if err := c.auth(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	go c.readLoop()
+	go c.callLoop()
+	ret, err := c.Call(ctx, busName, busPath, busName, "Hello")
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if len(ret) != 1 {
+		c.Close()
+		return nil, errMalformed
+	}
+	c.name, _ = ret[0].(string)
+	return c, nil
+}
+
+// auth authenticates by EXTERNAL mechanism.
+func (c *Conn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: authentication failed: %s", strings.TrimSpace(line))
+	}
+	_, err = io.WriteString(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// Name returns unique connection name.
+func (c *Conn) Name() string {
+	return c.name
+}
+
+// RequestName requests well-known bus name; returns error if name is owned by another connection.
+func (c *Conn) RequestName(ctx context.Context, name string) error {
+	ret, err := c.Call(ctx, busName, busPath, busName, "RequestName", name, NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if len(ret) != 1 {
+		return errMalformed
+	}
+	if r, _ := ret[0].(uint32); r != NameReplyPrimaryOwner && r != NameReplyAlreadyOwner {
+		return fmt.Errorf("dbus: name %s is owned by another connection", name)
+	}
+	return nil
+}
+
+// Call calls method and returns reply body.
+func (c *Conn) Call(ctx context.Context, dest string, path ObjectPath, iface, member string, args ...interface{}) ([]interface{}, error) {
+	reply := make(chan *Message, 1)
+	m := &Message{Type: TypeMethodCall, Destination: dest, Path: path, Interface: iface, Member: member, Body: args}
+	c.mu.Lock()
+	c.serial++
+	m.Serial = c.serial
+	c.pending[m.Serial] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, m.Serial)
+		c.mu.Unlock()
+	}()
+	if err := c.send(m); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-reply:
+		if r.Type == TypeError {
+			e := &Error{Name: r.ErrorName}
+			if len(r.Body) != 0 {
+				e.Message, _ = r.Body[0].(string)
+			}
+			return nil, e
+		}
+		return r.Body, nil
+	case <-c.done:
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Emit sends signal.
+func (c *Conn) Emit(path ObjectPath, iface, member string, args ...interface{}) error {
+	return c.send(&Message{Type: TypeSignal, Path: path, Interface: iface, Member: member, Body: args})
+}
+
+// Reply sends method return for call.
+func (c *Conn) Reply(call *Message, args ...interface{}) error {
+	if call.Flags&FlagNoReplyExpected != 0 {
+		return nil
+	}
+	return c.send(&Message{Type: TypeMethodReturn, Destination: call.Sender, ReplySerial: call.Serial, Body: args})
+}
+
+// ReplyError sends error for call.
+func (c *Conn) ReplyError(call *Message, e *Error) error {
+	if call.Flags&FlagNoReplyExpected != 0 {
+		return nil
+	}
+	return c.send(&Message{Type: TypeError, Destination: call.Sender, ReplySerial: call.Serial, ErrorName: e.Name, Body: []interface{}{e.Message}})
+}
+
+func (c *Conn) send(m *Message) error {
+	if m.Serial == 0 {
+		c.mu.Lock()
+		c.serial++
+		m.Serial = c.serial
+		c.mu.Unlock()
+	}
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		c.close(err)
+		return err
+	}
+	return nil
+}
+
+// Done returns chan which is closed when connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason why connection was closed.
+func (c *Conn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close closes connection.
+func (c *Conn) Close() error {
+	c.close(ErrClosed)
+	return nil
+}
+
+func (c *Conn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *Conn) readLoop() {
+	h := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(c.r, h); err != nil {
+			c.close(err)
+			return
+		}
+		n, err := messageSize(h)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		b := make([]byte, n)
+		copy(b, h)
+		if _, err := io.ReadFull(c.r, b[16:]); err != nil {
+			c.close(err)
+			return
+		}
+		m, err := Unmarshal(b)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		switch m.Type {
+		case TypeMethodReturn, TypeError:
+			c.mu.Lock()
+			reply, ok := c.pending[m.ReplySerial]
+			c.mu.Unlock()
+			if ok {
+				reply <- m
+			}
+		case TypeMethodCall:
+			select {
+			case c.calls <- m:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+func (c *Conn) callLoop() {
+	for {
+		select {
+		case m := <-c.calls:
+			if c.handler != nil {
+				c.handler(c, m)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
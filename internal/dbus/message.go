@@ -0,0 +1,639 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Message types
+const (
+	TypeMethodCall   byte = 1
+	TypeMethodReturn byte = 2
+	TypeError        byte = 3
+	TypeSignal       byte = 4
+)
+
+// FlagNoReplyExpected is a message flag to indicate that caller does not wait for reply.
+const FlagNoReplyExpected byte = 0x1
+
+// header field codes
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+)
+
+const maxMessageSize = 128 << 20
+
+var errMalformed = errors.New("dbus: malformed message")
+
+// ObjectPath is a D-Bus object path.
+type ObjectPath string
+
+// Signature is a D-Bus type signature.
+type Signature string
+
+// Variant is a D-Bus variant value.
+type Variant struct {
+	Value interface{}
+}
+
+// MakeVariant creates Variant.
+func MakeVariant(v interface{}) Variant {
+	return Variant{Value: v}
+}
+
+// Message is a D-Bus message.
+type Message struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Body        []interface{}
+	signature   Signature
+}
+
+// Signature returns body signature.
+func (m *Message) Signature() Signature {
+	return m.signature
+}
+
+// Error is a D-Bus error reply.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// SignatureOf returns D-Bus signature of Go values.
+//
+//	byte: y, bool: b, int16: n, uint16: q, int32: i, uint32: u, int64: x, uint64: t, float64: d,
+//	string: s, ObjectPath: o, Signature: g, Variant: v, []string: as, []ObjectPath: ao,
+//	[]Variant: av, map[string]Variant: a{sv}
+func SignatureOf(vs ...interface{}) (Signature, error) {
+	var b strings.Builder
+	for _, v := range vs {
+		switch v.(type) {
+		case byte:
+			b.WriteString("y")
+		case bool:
+			b.WriteString("b")
+		case int16:
+			b.WriteString("n")
+		case uint16:
+			b.WriteString("q")
+		case int32:
+			b.WriteString("i")
+		case uint32:
+			b.WriteString("u")
+		case int64:
+			b.WriteString("x")
+		case uint64:
+			b.WriteString("t")
+		case float64:
+			b.WriteString("d")
+		case string:
+			b.WriteString("s")
+		case ObjectPath:
+			b.WriteString("o")
+		case Signature:
+			b.WriteString("g")
+		case Variant:
+			b.WriteString("v")
+		case []string:
+			b.WriteString("as")
+		case []ObjectPath:
+			b.WriteString("ao")
+		case []Variant:
+			b.WriteString("av")
+		case map[string]Variant:
+			b.WriteString("a{sv}")
+		default:
+			return "", fmt.Errorf("dbus: unsupported type %T", v)
+		}
+	}
+	return Signature(b.String()), nil
+}
+
+// encoder encodes values in little endian.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) signature(s Signature) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// array encodes array length and elements which are aligned by align.
+func (e *encoder) array(align int, f func() error) error {
+	e.uint32(0)
+	pos := len(e.buf)
+	e.align(align)
+	start := len(e.buf)
+	if err := f(); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(e.buf[pos-4:], uint32(len(e.buf)-start))
+	return nil
+}
+
+func (e *encoder) value(v interface{}) error {
+	switch v := v.(type) {
+	case byte:
+		e.buf = append(e.buf, v)
+	case bool:
+		var b uint32
+		if v {
+			b = 1
+		}
+		e.uint32(b)
+	case int16:
+		e.align(2)
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(v))
+	case uint16:
+		e.align(2)
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, v)
+	case int32:
+		e.uint32(uint32(v))
+	case uint32:
+		e.uint32(v)
+	case int64:
+		e.align(8)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(v))
+	case uint64:
+		e.align(8)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+	case float64:
+		e.align(8)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+	case string:
+		e.string(v)
+	case ObjectPath:
+		e.string(string(v))
+	case Signature:
+		e.signature(v)
+	case Variant:
+		sig, err := SignatureOf(v.Value)
+		if err != nil {
+			return err
+		}
+		e.signature(sig)
+		return e.value(v.Value)
+	case []string:
+		return e.array(4, func() error {
+			for _, s := range v {
+				e.string(s)
+			}
+			return nil
+		})
+	case []ObjectPath:
+		return e.array(4, func() error {
+			for _, s := range v {
+				e.string(string(s))
+			}
+			return nil
+		})
+	case []Variant:
+		return e.array(1, func() error {
+			for _, s := range v {
+				if err := e.value(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case map[string]Variant:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return e.array(8, func() error {
+			for _, k := range keys {
+				e.align(8)
+				e.string(k)
+				if err := e.value(v[k]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return fmt.Errorf("dbus: unsupported type %T", v)
+	}
+	return nil
+}
+
+// Marshal encodes message.
+func (m *Message) Marshal() ([]byte, error) {
+	sig, err := SignatureOf(m.Body...)
+	if err != nil {
+		return nil, err
+	}
+	body := &encoder{}
+	for _, v := range m.Body {
+		if err := body.value(v); err != nil {
+			return nil, err
+		}
+	}
+	e := &encoder{}
+	e.buf = append(e.buf, 'l', m.Type, m.Flags, 1)
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(m.Serial)
+	field := func(code byte, v interface{}) {
+		e.align(8)
+		e.buf = append(e.buf, code)
+		e.value(Variant{v})
+	}
+	if err := e.array(8, func() error {
+		if len(m.Path) != 0 {
+			field(fieldPath, m.Path)
+		}
+		if len(m.Interface) != 0 {
+			field(fieldInterface, m.Interface)
+		}
+		if len(m.Member) != 0 {
+			field(fieldMember, m.Member)
+		}
+		if len(m.ErrorName) != 0 {
+			field(fieldErrorName, m.ErrorName)
+		}
+		if m.ReplySerial != 0 {
+			field(fieldReplySerial, m.ReplySerial)
+		}
+		if len(m.Destination) != 0 {
+			field(fieldDestination, m.Destination)
+		}
+		if len(m.Sender) != 0 {
+			field(fieldSender, m.Sender)
+		}
+		if len(sig) != 0 {
+			field(fieldSignature, sig)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	e.align(8)
+	return append(e.buf, body.buf...), nil
+}
+
+// decoder decodes values in little endian.
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) align(n int) error {
+	if r := d.pos % n; r != 0 {
+		d.pos += n - r
+	}
+	if d.pos > len(d.buf) {
+		return errMalformed
+	}
+	return nil
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, errMalformed
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if err := d.align(8); err != nil {
+		return 0, err
+	}
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+func (d *decoder) signature() (Signature, error) {
+	n, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return Signature(b[:n[0]]), nil
+}
+
+// splitType returns first single complete type in sig and rest.
+func splitType(sig Signature) (Signature, Signature, error) {
+	if len(sig) == 0 {
+		return "", "", errMalformed
+	}
+	switch sig[0] {
+	case 'a':
+		t, rest, err := splitType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + t, rest, nil
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		depth := 0
+		for i := 0; i < len(sig); i++ {
+			switch sig[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+				if depth == 0 {
+					if sig[i] != end {
+						return "", "", errMalformed
+					}
+					return sig[:i+1], sig[i+1:], nil
+				}
+			}
+		}
+		return "", "", errMalformed
+	}
+	return sig[:1], sig[1:], nil
+}
+
+func alignOf(t byte) int {
+	switch t {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+// values decodes values for signature.
+func (d *decoder) values(sig Signature) ([]interface{}, error) {
+	var ret []interface{}
+	for len(sig) != 0 {
+		t, rest, err := splitType(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(t)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+		sig = rest
+	}
+	return ret, nil
+}
+
+// value decodes single complete type value.
+func (d *decoder) value(t Signature) (interface{}, error) {
+	switch t[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		v, err := d.uint32()
+		return v != 0, err
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if t[0] == 'n' {
+			return int16(binary.LittleEndian.Uint16(b)), nil
+		}
+		return binary.LittleEndian.Uint16(b), nil
+	case 'i':
+		v, err := d.uint32()
+		return int32(v), err
+	case 'u', 'h':
+		return d.uint32()
+	case 'x':
+		v, err := d.uint64()
+		return int64(v), err
+	case 't':
+		return d.uint64()
+	case 'd':
+		v, err := d.uint64()
+		return math.Float64frombits(v), err
+	case 's':
+		return d.string()
+	case 'o':
+		s, err := d.string()
+		return ObjectPath(s), err
+	case 'g':
+		return d.signature()
+	case 'v':
+		sig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		et, rest, err := splitType(sig)
+		if err != nil || len(rest) != 0 {
+			return nil, errMalformed
+		}
+		v, err := d.value(et)
+		return Variant{v}, err
+	case '(', '{':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		return d.values(t[1 : len(t)-1])
+	case 'a':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		et := t[1:]
+		if err := d.align(alignOf(et[0])); err != nil {
+			return nil, err
+		}
+		end := d.pos + int(n)
+		if end > len(d.buf) {
+			return nil, errMalformed
+		}
+		switch et {
+		case "s":
+			ret := []string{}
+			for d.pos < end {
+				s, err := d.string()
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, s)
+			}
+			return ret, nil
+		case "{sv}":
+			ret := map[string]Variant{}
+			for d.pos < end {
+				kv, err := d.value(et)
+				if err != nil {
+					return nil, err
+				}
+				e := kv.([]interface{})
+				ret[e[0].(string)] = e[1].(Variant)
+			}
+			return ret, nil
+		}
+		ret := []interface{}{}
+		for d.pos < end {
+			v, err := d.value(et)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("dbus: unsupported type %q", t)
+}
+
+// Unmarshal decodes message.
+func Unmarshal(b []byte) (*Message, error) {
+	if len(b) < 16 || b[0] != 'l' {
+		// big endian messages are not used by dbus-daemon on little endian hosts
+		return nil, errMalformed
+	}
+	d := &decoder{buf: b, pos: 4}
+	m := &Message{Type: b[1], Flags: b[2]}
+	bodyLen, _ := d.uint32()
+	m.Serial, _ = d.uint32()
+	fields, err := d.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields.([]interface{}) {
+		f := f.([]interface{})
+		v := f[1].(Variant).Value
+		var ok bool
+		switch f[0].(byte) {
+		case fieldPath:
+			m.Path, ok = v.(ObjectPath)
+		case fieldInterface:
+			m.Interface, ok = v.(string)
+		case fieldMember:
+			m.Member, ok = v.(string)
+		case fieldErrorName:
+			m.ErrorName, ok = v.(string)
+		case fieldReplySerial:
+			m.ReplySerial, ok = v.(uint32)
+		case fieldDestination:
+			m.Destination, ok = v.(string)
+		case fieldSender:
+			m.Sender, ok = v.(string)
+		case fieldSignature:
+			m.signature, ok = v.(Signature)
+		default:
+			ok = true
+		}
+		if !ok {
+			return nil, errMalformed
+		}
+	}
+	if err := d.align(8); err != nil {
+		return nil, err
+	}
+	if len(b)-d.pos != int(bodyLen) {
+		return nil, errMalformed
+	}
+	body := &decoder{buf: b[d.pos:]}
+	if m.Body, err = body.values(m.signature); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// messageSize returns total message size from first 16 bytes of message.
+func messageSize(h []byte) (int, error) {
+	if len(h) < 16 || h[0] != 'l' {
+		return 0, errMalformed
+	}
+	bodyLen := int(binary.LittleEndian.Uint32(h[4:]))
+	fieldsLen := int(binary.LittleEndian.Uint32(h[12:]))
+	n := 16 + fieldsLen
+	if r := n % 8; r != 0 {
+		n += 8 - r
+	}
+	n += bodyLen
+	if n > maxMessageSize {
+		return 0, errMalformed
+	}
+	return n, nil
+}
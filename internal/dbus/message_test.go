@@ -0,0 +1,80 @@
+package dbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessageMarshal(t *testing.T) {
+	want := &Message{
+		Type:      TypeSignal,
+		Serial:    3,
+		Path:      "/org/mpris/MediaPlayer2",
+		Interface: "org.freedesktop.DBus.Properties",
+		Member:    "PropertiesChanged",
+		Body: []interface{}{
+			"org.mpris.MediaPlayer2.Player",
+			map[string]Variant{
+				"PlaybackStatus": MakeVariant("Playing"),
+				"Volume":         MakeVariant(0.5),
+				"Shuffle":        MakeVariant(true),
+				"Metadata": MakeVariant(map[string]Variant{
+					"mpris:trackid":     MakeVariant(ObjectPath("/org/mpris/MediaPlayer2/vv/song/1")),
+					"mpris:length":      MakeVariant(int64(200000000)),
+					"xesam:artist":      MakeVariant([]string{"foo", "bar"}),
+					"xesam:trackNumber": MakeVariant(int32(2)),
+				}),
+			},
+			[]string{},
+		},
+		signature: "sa{sv}as",
+	}
+	b, err := want.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal got error %v; want nil", err)
+	}
+	if n, err := messageSize(b[:16]); err != nil || n != len(b) {
+		t.Errorf("messageSize got %d, %v; want %d, nil", n, err, len(b))
+	}
+	got, err := Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal got error %v; want nil", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
+
+func TestSplitType(t *testing.T) {
+	for in, want := range map[Signature][2]Signature{
+		"sa{sv}as": {"s", "a{sv}as"},
+		"a{sv}as":  {"a{sv}", "as"},
+		"a(yv)":    {"a(yv)", ""},
+		"(a(ii)s)": {"(a(ii)s)", ""},
+	} {
+		first, rest, err := splitType(in)
+		if err != nil || first != want[0] || rest != want[1] {
+			t.Errorf("splitType(%q) got %q, %q, %v; want %q, %q, nil", in, first, rest, err, want[0], want[1])
+		}
+	}
+	for _, in := range []Signature{"", "a", "(ii", "{sv)"} {
+		if _, _, err := splitType(in); err == nil {
+			t.Errorf("splitType(%q) got nil error; want error", in)
+		}
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	for in, want := range map[string]string{
+		"unix:path=/run/user/1000/bus":                        "/run/user/1000/bus",
+		"unix:abstract=/tmp/dbus-abc,guid=0123":               "@/tmp/dbus-abc",
+		"tcp:host=localhost,port=1;unix:path=/tmp/a%20b/sock": "/tmp/a b/sock",
+	} {
+		if got, err := parseAddress(in); err != nil || got != want {
+			t.Errorf("parseAddress(%q) got %q, %v; want %q, nil", in, got, err, want)
+		}
+	}
+	if _, err := parseAddress("tcp:host=localhost,port=1"); err == nil {
+		t.Errorf("parseAddress(tcp) got nil error; want error")
+	}
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HeaderRequestID is a http header to pass request id.
+const HeaderRequestID = "X-Request-Id"
+
+type contextKey string
+
+const contextRequestID = contextKey("requestID")
+
+// RequestID returns request id set by AccessLog.
+func RequestID(ctx context.Context) string {
+	if v, ok := ctx.Value(contextRequestID).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// AccessLog returns http.Handler which prints info level access log for each request.
+// Request id is taken from X-Request-Id request header or generated, and set to response header and request context.
+func AccessLog(l *Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(HeaderRequestID)
+		if len(id) == 0 || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextRequestID, id)))
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		l.output(1, LevelInfo, "http", []interface{}{
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", rw.size,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		})
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// responseWriter records response status and body size.
+// Flush and Hijack are passed to the underlying ResponseWriter for streaming and websocket.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("log: http.Hijacker is not implemented")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
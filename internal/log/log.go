@@ -1,73 +1,282 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Level is a logging severity.
+type Level int
+
+// Logging levels.
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// String returns lower case level name.
+func (l Level) String() string {
+	if s, ok := levelNames[l]; ok {
+		return s
+	}
+	return strconv.Itoa(int(l))
+}
+
+// MarshalText returns level name.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses level name; debug, info, warn or error.
+func (l *Level) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	if s == "warning" {
+		s = "warn"
+	}
+	for k, v := range levelNames {
+		if v == s {
+			*l = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level: %s", text)
+}
+
+// Format is a log output format.
+type Format string
+
+// Log output formats.
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// UnmarshalText parses format name; text or json.
+func (f *Format) UnmarshalText(text []byte) error {
+	switch s := Format(strings.ToLower(strings.TrimSpace(string(text)))); s {
+	case FormatText, FormatJSON:
+		*f = s
+		return nil
+	}
+	return fmt.Errorf("unknown log format: %s", text)
+}
+
+// Logger is a leveled logger with contextual key-value fields.
 type Logger struct {
-	l     *log.Logger
-	debug bool
+	l      *log.Logger
+	level  Level
+	format Format
+	fields []interface{}
 }
 
+// New creates text format Logger which prints info or higher level logs.
 func New(out io.Writer) *Logger {
-	return &Logger{
-		l: log.New(out, "", log.LstdFlags),
-	}
+	return NewLogger(out, LevelInfo, FormatText)
 }
 
+// NewDebugLogger creates text format Logger which prints all logs with file name.
 func NewDebugLogger(out io.Writer) *Logger {
+	return NewLogger(out, LevelDebug, FormatText)
+}
+
+// NewLogger creates Logger which prints level or higher level logs in format.
+func NewLogger(out io.Writer, level Level, format Format) *Logger {
+	flag := log.LstdFlags
+	switch {
+	case format == FormatJSON:
+		flag = 0
+	case level <= LevelDebug:
+		flag |= log.Lshortfile
+	}
 	return &Logger{
-		l:     log.New(out, "", log.Lshortfile|log.LstdFlags),
-		debug: true,
+		l:      log.New(out, "", flag),
+		level:  level,
+		format: format,
+	}
+}
+
+// With returns Logger which adds key-value pairs to each log.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+	return &Logger{l: l.l, level: l.level, format: l.format, fields: fields}
+}
+
+// Enabled reports whether l prints level logs.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) output(calldepth int, level Level, msg string, keysAndValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	msg = strings.TrimSuffix(msg, "\n")
+	fields := l.fields
+	if len(keysAndValues) != 0 {
+		fields = append(append(make([]interface{}, 0, len(fields)+len(keysAndValues)), fields...), keysAndValues...)
+	}
+	if l.format == FormatJSON {
+		l.l.Output(calldepth+1, jsonLine(level, msg, fields))
+		return
 	}
+	l.l.Output(calldepth+1, textLine(level, msg, fields))
 }
 
-// Printf calls l.Output to print to the logger.
+func textLine(level Level, msg string, fields []interface{}) string {
+	var b strings.Builder
+	if level != LevelInfo {
+		b.WriteString(level.String())
+		b.WriteString(": ")
+	}
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fieldKey(fields, i))
+		b.WriteByte('=')
+		v := fieldString(fields, i)
+		if v == "" || strings.ContainsAny(v, " \"=\n\t") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+func jsonLine(level Level, msg string, fields []interface{}) string {
+	var b strings.Builder
+	b.WriteString(`{"time":`)
+	writeJSON(&b, time.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(',')
+		writeJSON(&b, fieldKey(fields, i))
+		b.WriteByte(':')
+		var v interface{}
+		if i+1 < len(fields) {
+			v = fields[i+1]
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		if d, ok := v.(time.Duration); ok {
+			v = d.Seconds()
+		}
+		if _, ok := v.(json.Marshaler); !ok {
+			if _, ok := v.(fmt.Stringer); ok {
+				v = fieldString(fields, i)
+			}
+		}
+		jb, err := json.Marshal(v)
+		if err != nil {
+			jb, _ = json.Marshal(fmt.Sprint(v))
+		}
+		b.Write(jb)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func writeJSON(b *strings.Builder, s string) {
+	jb, _ := json.Marshal(s)
+	b.Write(jb)
+}
+
+func fieldKey(fields []interface{}, i int) string {
+	if s, ok := fields[i].(string); ok {
+		return s
+	}
+	return fmt.Sprint(fields[i])
+}
+
+func fieldString(fields []interface{}, i int) string {
+	if i+1 >= len(fields) {
+		return ""
+	}
+	return fmt.Sprint(fields[i+1])
+}
+
+// Printf prints info level log.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Printf(format string, v ...interface{}) {
-	l.l.Output(2, fmt.Sprintf(format, v...))
+	l.output(2, LevelInfo, fmt.Sprintf(format, v...), nil)
 }
 
-// Print calls l.Output to print to the logger.
+// Print prints info level log.
 // Arguments are handled in the manner of fmt.Print.
-func (l *Logger) Print(v ...interface{}) { l.l.Output(2, fmt.Sprint(v...)) }
+func (l *Logger) Print(v ...interface{}) { l.output(2, LevelInfo, fmt.Sprint(v...), nil) }
 
-// Println calls l.Output to print to the logger.
+// Println prints info level log.
 // Arguments are handled in the manner of fmt.Println.
-func (l *Logger) Println(v ...interface{}) { l.l.Output(2, fmt.Sprintln(v...)) }
+func (l *Logger) Println(v ...interface{}) { l.output(2, LevelInfo, fmt.Sprintln(v...), nil) }
 
-// Debugf calls l.Output to print to the logger.
+// Debugf prints debug level log.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	if !l.debug {
-		return
-	}
-	l.l.Output(2, "debug: "+fmt.Sprintf(format, v...))
+	l.output(2, LevelDebug, fmt.Sprintf(format, v...), nil)
 }
 
-// Debug calls l.Output to print to the logger.
+// Debug prints debug level log.
 // Arguments are handled in the manner of fmt.Print.
-func (l *Logger) Debug(v ...interface{}) {
-	if !l.debug {
-		return
-	}
-	l.l.Output(2, "debug: "+fmt.Sprint(v...))
-}
+func (l *Logger) Debug(v ...interface{}) { l.output(2, LevelDebug, fmt.Sprint(v...), nil) }
 
-// Debugln calls l.Output to print to the logger.
+// Debugln prints debug level log.
 // Arguments are handled in the manner of fmt.Println.
-func (l *Logger) Debugln(v ...interface{}) {
-	if !l.debug {
-		return
-	}
-	l.l.Output(2, "debug: "+fmt.Sprintln(v...))
+func (l *Logger) Debugln(v ...interface{}) { l.output(2, LevelDebug, fmt.Sprintln(v...), nil) }
+
+// Warnf prints warn level log.
+// Arguments are handled in the manner of fmt.Printf.
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.output(2, LevelWarn, fmt.Sprintf(format, v...), nil)
+}
+
+// Errorf prints error level log.
+// Arguments are handled in the manner of fmt.Printf.
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.output(2, LevelError, fmt.Sprintf(format, v...), nil)
+}
+
+// Debugw prints debug level msg with key-value pairs.
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.output(2, LevelDebug, msg, keysAndValues)
+}
+
+// Infow prints info level msg with key-value pairs.
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.output(2, LevelInfo, msg, keysAndValues)
+}
+
+// Warnw prints warn level msg with key-value pairs.
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.output(2, LevelWarn, msg, keysAndValues)
+}
+
+// Errorw prints error level msg with key-value pairs.
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.output(2, LevelError, msg, keysAndValues)
 }
 
-// Fatalf is equivalent to l.Printf() followed by a call to os.Exit(1).
+// Fatalf prints error level log followed by a call to os.Exit(1).
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-	l.l.Output(2, fmt.Sprintf(format, v...))
+	l.output(2, LevelError, fmt.Sprintf(format, v...), nil)
 	os.Exit(1)
 }
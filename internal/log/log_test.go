@@ -0,0 +1,97 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := NewLogger(b, LevelInfo, FormatText).With("subsystem", "api")
+		l.Debugf("hidden")
+		l.Printf("hello %s", "world")
+		l.Errorw("failed", "command", "play", "error", errors.New("not connected"))
+		got := b.String()
+		if strings.Contains(got, "hidden") {
+			t.Errorf("got debug log %q; want no debug log", got)
+		}
+		for _, want := range []string{
+			"hello world subsystem=api\n",
+			`error: failed subsystem=api command=play error="not connected"` + "\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("got %q; want contains %q", got, want)
+			}
+		}
+	})
+	t.Run("json", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := NewLogger(b, LevelWarn, FormatJSON).With("subsystem", "api")
+		l.Printf("hidden")
+		l.Warnw("slow", "command", "listallinfo", "n", 3)
+		var got map[string]interface{}
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse %q: %v", b.String(), err)
+		}
+		for k, want := range map[string]interface{}{"level": "warn", "msg": "slow", "subsystem": "api", "command": "listallinfo", "n": 3.0} {
+			if got[k] != want {
+				t.Errorf("got %s %v; want %v", k, got[k], want)
+			}
+		}
+		if _, ok := got["time"]; !ok {
+			t.Errorf("got %v; want time field", got)
+		}
+	})
+}
+
+func TestLevelUnmarshalText(t *testing.T) {
+	for in, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "warning": LevelWarn, "error": LevelError} {
+		var got Level
+		if err := got.UnmarshalText([]byte(in)); err != nil || got != want {
+			t.Errorf("UnmarshalText(%q) got %v, %v; want %v, nil", in, got, err, want)
+		}
+	}
+	var l Level
+	if err := l.UnmarshalText([]byte("verbose")); err == nil {
+		t.Errorf("UnmarshalText(verbose) got nil error; want error")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	b := &bytes.Buffer{}
+	var gotID string
+	h := AccessLog(NewLogger(b, LevelInfo, FormatJSON), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = RequestID(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("foo"))
+	}))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/music", nil)
+	r.Header.Set(HeaderRequestID, "abc")
+	h.ServeHTTP(w, r)
+	if gotID != "abc" || w.Header().Get(HeaderRequestID) != "abc" {
+		t.Errorf("got request id %q, header %q; want abc", gotID, w.Header().Get(HeaderRequestID))
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse %q: %v", b.String(), err)
+	}
+	for k, want := range map[string]interface{}{"request_id": "abc", "method": "GET", "path": "/api/music", "status": 418.0, "bytes": 3.0} {
+		if got[k] != want {
+			t.Errorf("got %s %v; want %v", k, got[k], want)
+		}
+	}
+
+	// generates request id
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if id := w.Header().Get(HeaderRequestID); len(id) == 0 || id != gotID {
+		t.Errorf("got request id %q, header %q; want generated id", gotID, id)
+	}
+}
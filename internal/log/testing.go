@@ -47,3 +47,33 @@ func (l *TestLogger) Fatalf(format string, v ...interface{}) {
 	l.tb.Helper()
 	l.tb.Fatalf(format, v...)
 }
+
+func (l *TestLogger) Warnf(format string, v ...interface{}) {
+	l.tb.Helper()
+	l.tb.Logf("warn: "+format, v...)
+}
+
+func (l *TestLogger) Errorf(format string, v ...interface{}) {
+	l.tb.Helper()
+	l.tb.Logf("error: "+format, v...)
+}
+
+func (l *TestLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.tb.Helper()
+	l.tb.Log("debug: " + textLine(LevelInfo, msg, keysAndValues))
+}
+
+func (l *TestLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.tb.Helper()
+	l.tb.Log(textLine(LevelInfo, msg, keysAndValues))
+}
+
+func (l *TestLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.tb.Helper()
+	l.tb.Log(textLine(LevelWarn, msg, keysAndValues))
+}
+
+func (l *TestLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.tb.Helper()
+	l.tb.Log(textLine(LevelError, msg, keysAndValues))
+}
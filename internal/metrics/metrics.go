@@ -0,0 +1,252 @@
+// Package metrics provides minimal prometheus text format metrics.
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are default histogram buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry is a set of metrics served as prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	collect []func()
+}
+
+// NewRegistry creates empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// OnCollect registers f to be called before each scrape to update gauges.
+func (r *Registry) OnCollect(f func()) {
+	r.mu.Lock()
+	r.collect = append(r.collect, f)
+	r.mu.Unlock()
+}
+
+// Counter creates and registers counter vec.
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	v := newVec("counter", name, help, labels)
+	r.register(v)
+	return v
+}
+
+// Gauge creates and registers gauge vec.
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	v := newVec("gauge", name, help, labels)
+	r.register(v)
+	return v
+}
+
+// Histogram creates and registers histogram vec. DefBuckets is used if buckets is nil.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogramValue{}}
+	r.register(h)
+	return h
+}
+
+// ServeHTTP writes all metrics as prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.mu.Lock()
+	collect := append([]func(){}, r.collect...)
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+	for _, f := range collect {
+		f()
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	bw.Flush()
+}
+
+// Vec is a counter or gauge partitioned by label values.
+type Vec struct {
+	typ    string
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newVec(typ, name, help string, labels []string) *Vec {
+	return &Vec{typ: typ, name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+// Add adds d to the value for label values.
+func (v *Vec) Add(d float64, values ...string) {
+	k := key(values)
+	v.mu.Lock()
+	v.values[k] += d
+	v.mu.Unlock()
+}
+
+// Inc increments the value for label values.
+func (v *Vec) Inc(values ...string) {
+	v.Add(1, values...)
+}
+
+// Set sets the value for label values.
+func (v *Vec) Set(f float64, values ...string) {
+	k := key(values)
+	v.mu.Lock()
+	v.values[k] = f
+	v.mu.Unlock()
+}
+
+func (v *Vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	writeHeader(w, v.name, v.help, v.typ)
+	for _, k := range sortedKeys(v.values) {
+		writeSample(w, v.name, labelPairs(v.labels, k), v.values[k])
+	}
+}
+
+// Histogram is a histogram partitioned by label values.
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds f to the histogram for label values.
+func (h *Histogram) Observe(f float64, values ...string) {
+	k := key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.values[k]
+	if !ok {
+		v = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = v
+	}
+	for i, b := range h.buckets {
+		if f <= b {
+			v.counts[i]++
+		}
+	}
+	v.count++
+	v.sum += f
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, k := range sortedKeys(h.values) {
+		v := h.values[k]
+		labels := labelPairs(h.labels, k)
+		for i, b := range h.buckets {
+			writeSample(w, h.name+"_bucket", append(labels, [2]string{"le", formatFloat(b)}), float64(v.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", append(labels, [2]string{"le", "+Inf"}), float64(v.count))
+		writeSample(w, h.name+"_sum", labels, v.sum)
+		writeSample(w, h.name+"_count", labels, float64(v.count))
+	}
+}
+
+// key joins label values to map key.
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func labelPairs(names []string, k string) [][2]string {
+	if len(names) == 0 {
+		return nil
+	}
+	values := strings.Split(k, "\xff")
+	ret := make([][2]string, 0, len(names)+1)
+	for i, n := range names {
+		var v string
+		if i < len(values) {
+			v = values[i]
+		}
+		ret = append(ret, [2]string{n, v})
+	}
+	return ret
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name string, labels [][2]string, v float64) {
+	w.WriteString(name)
+	if len(labels) != 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l[0] + `="` + labelEscaper.Replace(l[1]) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("test_errors_total", "Errors.", "command")
+	c.Inc("play")
+	c.Add(2, `a"b`)
+	g := r.Gauge("test_subscribers", "Subscribers.")
+	r.OnCollect(func() { g.Set(3) })
+	h := r.Histogram("test_duration_seconds", "Duration.", []float64{0.1, 1}, "path")
+	h.Observe(0.05, "/api")
+	h.Observe(0.5, "/api")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total{command="a\"b"} 2
+test_errors_total{command="play"} 1
+# HELP test_subscribers Subscribers.
+# TYPE test_subscribers gauge
+test_subscribers 3
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{path="/api",le="0.1"} 1
+test_duration_seconds_bucket{path="/api",le="1"} 2
+test_duration_seconds_bucket{path="/api",le="+Inf"} 2
+test_duration_seconds_sum{path="/api"} 0.55
+test_duration_seconds_count{path="/api"} 2
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+}
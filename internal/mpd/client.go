@@ -32,7 +32,7 @@ func Dial(proto, addr string, opts *ClientOptions) (*Client, error) {
 		opts = &ClientOptions{}
 	}
 	c := &Client{opts: opts}
-	pool, err := newPool(proto, addr, opts.Timeout, opts.ReconnectionInterval, func(conn *conn) error {
+	pool, err := newPool(proto, addr, opts.Timeout, opts.ReconnectionInterval, opts.NonBlocking, func(conn *conn) error {
 		if err := opts.connectHook(conn); err != nil {
 			return err
 		}
@@ -64,12 +64,17 @@ func (c *Client) Version() string {
 	return c.pool.Version()
 }
 
+// Health returns command connection state.
+func (c *Client) Health() Health {
+	return c.pool.Health()
+}
+
 // Querying MPD’s status
 
 // CurrentSong displays the song info of the current song
 func (c *Client) CurrentSong(ctx context.Context) (map[string][]string, error) {
 	ch := make(chan map[string][]string, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, "currentsong", func(conn *conn) error {
 		defer close(ch)
 		if err := request(conn, "currentsong"); err != nil {
 			return err
@@ -165,6 +170,11 @@ func (c *Client) Previous(ctx context.Context) error {
 	return c.ok(ctx, "previous")
 }
 
+// Stop stops playing.
+func (c *Client) Stop(ctx context.Context) error {
+	return c.ok(ctx, "stop")
+}
+
 // SeekCur seeks to the position t within the current song
 func (c *Client) SeekCur(ctx context.Context, t float64) error {
 	return c.ok(ctx, "seekcur", t)
@@ -175,7 +185,7 @@ func (c *Client) SeekCur(ctx context.Context, t float64) error {
 // PlaylistInfo displays a list of all songs in the playlist.
 func (c *Client) PlaylistInfo(ctx context.Context) ([]map[string][]string, error) {
 	ch := make(chan []map[string][]string, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, "playlistinfo", func(conn *conn) error {
 		defer close(ch)
 		if err := request(conn, "playlistinfo"); err != nil {
 			return err
@@ -206,7 +216,7 @@ func (c *Client) ReadPicture(ctx context.Context, uri string) ([]byte, error) {
 // ListAllInfo lists all songs and directories in uri.
 func (c *Client) ListAllInfo(ctx context.Context, uri string) ([]map[string][]string, error) {
 	ch := make(chan []map[string][]string, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, "listallinfo", func(conn *conn) error {
 		defer close(ch)
 		if err := request(conn, "listallinfo", uri); err != nil {
 			return err
@@ -272,7 +282,7 @@ type Output struct {
 // Outputs shows information about all outputs.
 func (c *Client) Outputs(ctx context.Context) ([]*Output, error) {
 	ch := make(chan []*Output, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, "outputs", func(conn *conn) error {
 		defer close(ch)
 		if err := request(conn, "outputs"); err != nil {
 			return err
@@ -329,7 +339,7 @@ func (c *Client) Config(ctx context.Context) (map[string]string, error) {
 func (c *Client) Commands(ctx context.Context) ([]string, error) {
 	if !c.opts.CacheCommandsResult {
 		ch := make(chan []string, 1)
-		err := c.pool.Exec(ctx, func(conn *conn) error {
+		err := c.exec(ctx, "commands", func(conn *conn) error {
 			defer close(ch)
 			if err := request(conn, "commands"); err != nil {
 				return err
@@ -363,15 +373,26 @@ func (c *Client) updateCommands(conn *conn) error {
 	return nil
 }
 
+// exec executes f and reports its duration and error by CommandHook.
+func (c *Client) exec(ctx context.Context, cmd string, f func(*conn) error) error {
+	if c.opts.CommandHook == nil {
+		return c.pool.Exec(ctx, f)
+	}
+	start := time.Now()
+	err := c.pool.Exec(ctx, f)
+	c.opts.CommandHook(cmd, time.Since(start), err)
+	return err
+}
+
 func (c *Client) ok(ctx context.Context, cmd string, args ...interface{}) error {
-	return c.pool.Exec(ctx, func(conn *conn) error {
+	return c.exec(ctx, cmd, func(conn *conn) error {
 		return execOK(conn, cmd, args...)
 	})
 }
 
 func (c *Client) binaryPart(ctx context.Context, pos int, cmd string, args ...interface{}) (map[string]string, []byte, error) {
 	ch1, ch2 := make(chan map[string]string, 1), make(chan []byte, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, cmd, func(conn *conn) error {
 		defer close(ch1)
 		defer close(ch2)
 		if err := request(conn, cmd, append(args, pos)...); err != nil {
@@ -417,7 +438,7 @@ func (c *Client) binary(ctx context.Context, cmd string, args ...interface{}) ([
 
 func (c *Client) mapStr(ctx context.Context, cmd string, args ...interface{}) (map[string]string, error) {
 	ch := make(chan map[string]string, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, cmd, func(conn *conn) error {
 		defer close(ch)
 		if err := request(conn, cmd, args...); err != nil {
 			return err
@@ -434,7 +455,7 @@ func (c *Client) mapStr(ctx context.Context, cmd string, args ...interface{}) (m
 
 func (c *Client) listMap(ctx context.Context, newKey string, cmd string, args ...interface{}) ([]map[string]string, error) {
 	ch := make(chan []map[string]string, 1)
-	err := c.pool.Exec(ctx, func(conn *conn) error {
+	err := c.exec(ctx, cmd, func(conn *conn) error {
 		defer close(ch)
 		if err := request(conn, cmd, args...); err != nil {
 			return err
@@ -460,6 +481,10 @@ type ClientOptions struct {
 	BinaryLimit int
 	// CacheCommandsResult caches mpd command "commands" result
 	CacheCommandsResult bool
+	// NonBlocking returns Client without error if initial connection fails and connects to mpd in background.
+	NonBlocking bool
+	// CommandHook is called with command name, duration and error after each command(e.g. metrics).
+	CommandHook func(cmd string, d time.Duration, err error)
 }
 
 func (c *ClientOptions) connectHook(conn *conn) error {
@@ -211,6 +211,10 @@ func TestClient(t *testing.T) {
 			cmd1: c.Previous,
 			wr:   []*mpdtest.WR{{Read: "previous\n", Write: "OK\n"}},
 		},
+		"stop": {
+			cmd1: c.Stop,
+			wr:   []*mpdtest.WR{{Read: "stop\n", Write: "OK\n"}},
+		},
 		// The Queue
 		"playlistinfo": {
 			cmd2: func(ctx context.Context) (interface{}, error) { return c.PlaylistInfo(ctx) },
@@ -422,14 +426,51 @@ func TestClientCloseNetworkError(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to connect mock server: %v", err)
 	}
+	if h := c.Health(); !h.Connected || h.LastError != nil || h.LastSuccess.IsZero() {
+		t.Errorf("got Health() %+v; want connected", h)
+	}
 	svr <- struct{}{}
 	<-cli
 	opErr := &net.OpError{}
-	if err := c.Ping(ctx); !errors.As(err, &opErr) || opErr.Op != "write" {
+	err = c.Ping(ctx)
+	if !errors.As(err, &opErr) || opErr.Op != "write" {
 		t.Errorf("Ping(ctx) got %v; want %v", err, &net.OpError{Op: "write", Err: syscall.EPIPE})
 	}
+	if h := c.Health(); h.Connected || h.LastError == nil {
+		t.Errorf("got Health() %+v; want disconnected with error", h)
+	}
 	if err := c.Close(ctx); !errors.Is(err, ErrClosed) {
 		t.Errorf("got %v; want %v", err, ErrClosed)
 	}
 
 }
+
+func TestClientCommandHook(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	ts := mpdtest.NewServer("OK MPD 0.19")
+	defer ts.Close()
+	go func() {
+		ts.Expect(ctx, &mpdtest.WR{Read: "next\n", Write: "OK\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "status\n", Write: "ACK [2@0] {status} error\n"})
+	}()
+	type call struct {
+		cmd string
+		err bool
+	}
+	var got []call
+	c, err := Dial("tcp", ts.URL, &ClientOptions{Timeout: testTimeout, CommandHook: func(cmd string, d time.Duration, err error) {
+		got = append(got, call{cmd: cmd, err: err != nil})
+	}})
+	if err != nil {
+		t.Fatalf("Dial got error %v; want nil", err)
+	}
+	c.Next(ctx)
+	c.Status(ctx)
+	if want := []call{{cmd: "next"}, {cmd: "status", err: true}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got CommandHook calls %v; want %v", got, want)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Errorf("Close got error %v; want nil", err)
+	}
+}
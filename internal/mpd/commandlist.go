@@ -3,6 +3,8 @@ package mpd
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // CommandListEqual compares command list a and b.
@@ -53,6 +55,56 @@ func (cl *CommandList) Add(uri string) {
 	})
 }
 
+// AddID adds uri to playlist at song number pos.
+func (cl *CommandList) AddID(uri string, pos int) {
+	req, _ := srequest("addid", uri, pos)
+	cl.requests = append(cl.requests, req)
+	cl.commands = append(cl.commands, "addid")
+	cl.parsers = append(cl.parsers, func(c *conn) error {
+		line, err := readln(c)
+		if err != nil {
+			return err
+		}
+		if ok, err := isEnd(line, responseListOK); ok {
+			return err
+		}
+		if !strings.HasPrefix(line, "Id: ") {
+			return fmt.Errorf("%w: got: %q; want: %q", ErrParse, line, "Id: ")
+		}
+		return parseEnd(c, responseListOK)
+	})
+}
+
+// Delete deletes songs from start to end(excluded) in playlist.
+func (cl *CommandList) Delete(start, end int) {
+	req, _ := srequest("delete", strconv.Itoa(start)+":"+strconv.Itoa(end))
+	cl.requests = append(cl.requests, req)
+	cl.commands = append(cl.commands, "delete")
+	cl.parsers = append(cl.parsers, func(c *conn) error {
+		return parseEnd(c, responseListOK)
+	})
+}
+
+// Move moves the song at from to to in playlist.
+func (cl *CommandList) Move(from, to int) {
+	req, _ := srequest("move", from, to)
+	cl.requests = append(cl.requests, req)
+	cl.commands = append(cl.commands, "move")
+	cl.parsers = append(cl.parsers, func(c *conn) error {
+		return parseEnd(c, responseListOK)
+	})
+}
+
+// Load loads the stored playlist name to playlist.
+func (cl *CommandList) Load(name string) {
+	req, _ := srequest("load", name)
+	cl.requests = append(cl.requests, req)
+	cl.commands = append(cl.commands, "load")
+	cl.parsers = append(cl.parsers, func(c *conn) error {
+		return parseEnd(c, responseListOK)
+	})
+}
+
 // Play begins playing the playlist at song number pos.
 func (cl *CommandList) Play(pos int) {
 	req, _ := srequest("play", pos)
@@ -63,6 +115,26 @@ func (cl *CommandList) Play(pos int) {
 	})
 }
 
+// Pause pauses or resumes playback.
+func (cl *CommandList) Pause(state bool) {
+	req, _ := srequest("pause", state)
+	cl.requests = append(cl.requests, req)
+	cl.commands = append(cl.commands, "pause")
+	cl.parsers = append(cl.parsers, func(c *conn) error {
+		return parseEnd(c, responseListOK)
+	})
+}
+
+// Seek seeks to the position t(in seconds) of song number pos and begins playing.
+func (cl *CommandList) Seek(pos int, t float64) {
+	req, _ := srequest("seek", pos, t)
+	cl.requests = append(cl.requests, req)
+	cl.commands = append(cl.commands, "seek")
+	cl.parsers = append(cl.parsers, func(c *conn) error {
+		return parseEnd(c, responseListOK)
+	})
+}
+
 // ExecCommandList executes commandlist.
 func (c *Client) ExecCommandList(ctx context.Context, cl *CommandList) error {
 	defer func() {
@@ -70,7 +142,7 @@ func (c *Client) ExecCommandList(ctx context.Context, cl *CommandList) error {
 		cl.commands = []string{}
 		cl.parsers = []func(*conn) error{}
 	}()
-	return c.pool.Exec(ctx, func(conn *conn) error {
+	return c.exec(ctx, "command_list", func(conn *conn) error {
 		if err := request(conn, "command_list_ok_begin"); err != nil {
 			return err
 		}
@@ -20,7 +20,13 @@ func TestCommandList(t *testing.T) {
 		ts.Expect(ctx, &mpdtest.WR{Read: "command_list_ok_begin\n"})
 		ts.Expect(ctx, &mpdtest.WR{Read: "clear\n"})
 		ts.Expect(ctx, &mpdtest.WR{Read: "add \"/foo/bar\"\n"})
-		ts.Expect(ctx, &mpdtest.WR{Read: "command_list_end\n", Write: "list_OK\nlist_OK\nOK\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "seek 0 12.5\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "pause 1\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "delete \"2:4\"\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "move 3 0\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "addid \"/foo/baz\" 1\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "load \"morning\"\n"})
+		ts.Expect(ctx, &mpdtest.WR{Read: "command_list_end\n", Write: "list_OK\nlist_OK\nlist_OK\nlist_OK\nlist_OK\nlist_OK\nId: 12\nlist_OK\nlist_OK\nOK\n"})
 	}()
 	c, err := Dial("tcp", ts.URL,
 		&ClientOptions{Password: "2434", Timeout: testTimeout, ReconnectionInterval: time.Millisecond})
@@ -30,6 +36,12 @@ func TestCommandList(t *testing.T) {
 	cl := &CommandList{}
 	cl.Clear()
 	cl.Add("/foo/bar")
+	cl.Seek(0, 12.5)
+	cl.Pause(true)
+	cl.Delete(2, 4)
+	cl.Move(3, 0)
+	cl.AddID("/foo/baz", 1)
+	cl.Load("morning")
 	if err := c.ExecCommandList(ctx, cl); err != nil {
 		t.Errorf("CommandList got error %v; want nil", err)
 	}
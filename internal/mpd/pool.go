@@ -17,9 +17,18 @@ type pool struct {
 	connCancel           context.CancelFunc
 	mu                   sync.RWMutex
 	version              string
+	offline              bool // initial connection failed
+	health               Health
 }
 
-func newPool(proto string, addr string, timeout time.Duration, reconnectionInterval time.Duration, connHook func(*conn) error) (*pool, error) {
+// Health represents mpd connection state.
+type Health struct {
+	Connected   bool      // connection is established
+	LastError   error     // last connection or command error
+	LastSuccess time.Time // last time mpd responded to a command
+}
+
+func newPool(proto string, addr string, timeout time.Duration, reconnectionInterval time.Duration, nonBlocking bool, connHook func(*conn) error) (*pool, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	p := &pool{
 		proto:                proto,
@@ -32,7 +41,12 @@ func newPool(proto string, addr string, timeout time.Duration, reconnectionInter
 		connCancel:           cancel,
 	}
 	if err := p.connectOnce(); err != nil {
-		return nil, err
+		p.setError(err)
+		if !nonBlocking {
+			return nil, err
+		}
+		p.offline = true
+		go p.connect()
 	}
 	return p, nil
 }
@@ -53,11 +67,22 @@ func (c *pool) Exec(ctx context.Context, f func(*conn) error) error {
 		err = ctx.Err()
 		conn.SetDeadline(time.Now())
 	}
+	c.mu.Lock()
+	if err != nil {
+		c.health.LastError = err
+	}
+	if _, ok := err.(*CommandError); ok || err == nil {
+		c.health.LastSuccess = time.Now()
+	}
+	c.mu.Unlock()
 	return c.returnConn(conn, err)
 }
 
 func (c *pool) Close(ctx context.Context) error {
 	c.connCancel()
+	c.mu.Lock()
+	c.health.Connected = false
+	c.mu.Unlock()
 	conn, err := c.get(ctx)
 	if err != nil {
 		return err
@@ -72,6 +97,20 @@ func (c *pool) Version() string {
 	return c.version
 }
 
+// Health returns connection state.
+func (c *pool) Health() Health {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.health
+}
+
+func (c *pool) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health.Connected = false
+	c.health.LastError = err
+}
+
 func (c *pool) get(ctx context.Context) (*conn, error) {
 	select {
 	case conn, ok := <-c.connC:
@@ -92,6 +131,7 @@ func (c *pool) get(ctx context.Context) (*conn, error) {
 func (c *pool) returnConn(conn *conn, err error) error {
 	if err != nil {
 		if _, ok := err.(*CommandError); !ok {
+			c.setError(err)
 			conn.Close()
 			go c.connect()
 			return err
@@ -104,6 +144,7 @@ func (c *pool) returnConn(conn *conn, err error) error {
 func (c *pool) connect() {
 	for {
 		if err := c.connectOnce(); err != nil {
+			c.setError(err)
 			select {
 			case <-c.connCtx.Done():
 				close(c.connC)
@@ -131,9 +172,11 @@ func (c *pool) connectOnce() error {
 		conn.Close()
 		return err
 	}
-	c.connC <- conn
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	c.version = conn.Version
+	c.health.Connected = true
+	c.health.LastSuccess = time.Now()
+	c.mu.Unlock()
+	c.connC <- conn
 	return nil
 }
@@ -2,11 +2,14 @@ package mpd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
+var errNotConnected = errors.New("mpd: not connected")
+
 // NewWatcher connects to mpd server
 func NewWatcher(proto, addr string, opts *WatcherOptions) (*Watcher, error) {
 	if opts == nil {
@@ -16,7 +19,7 @@ func NewWatcher(proto, addr string, opts *WatcherOptions) (*Watcher, error) {
 	for i := range opts.SubSystems {
 		args[i] = opts.SubSystems[i]
 	}
-	pool, err := newPool(proto, addr, opts.Timeout, opts.ReconnectionInterval, opts.connectHook)
+	pool, err := newPool(proto, addr, opts.Timeout, opts.ReconnectionInterval, opts.NonBlocking, opts.connectHook)
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +36,10 @@ func NewWatcher(proto, addr string, opts *WatcherOptions) (*Watcher, error) {
 		defer close(closed)
 		defer close(event)
 		var err error
+		if pool.offline {
+			// sends reconnecting and reconnect event for initial connection
+			err = errNotConnected
+		}
 		for {
 			select {
 			case <-ctx.Done():
@@ -111,6 +118,11 @@ func (w *Watcher) Event() <-chan string {
 	return w.event
 }
 
+// Health returns idle connection state.
+func (w *Watcher) Health() Health {
+	return w.pool.Health()
+}
+
 // Close closes connection
 func (w *Watcher) Close(ctx context.Context) error {
 	w.cancel()
@@ -130,6 +142,8 @@ type WatcherOptions struct {
 	ReconnectionInterval time.Duration
 	// SubSystems are list of recieve events. Watcher recieves all events if SubSystems are empty.
 	SubSystems []string
+	// NonBlocking returns Watcher without error if initial connection fails and connects to mpd in background.
+	NonBlocking bool
 }
 
 func (c *WatcherOptions) connectHook(conn *conn) error {
@@ -1,7 +1,10 @@
 package mpd
 
 import (
+	"bufio"
 	"context"
+	"fmt"
+	"net"
 	"testing"
 	"time"
 
@@ -46,6 +49,63 @@ func TestWatcher(t *testing.T) {
 
 }
 
+func TestWatcherNonBlocking(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if _, err := NewWatcher("tcp", addr, &WatcherOptions{Timeout: testTimeout, ReconnectionInterval: time.Millisecond}); err == nil {
+		t.Fatalf("NewWatcher got nil error; want connection error")
+	}
+	w, err := NewWatcher("tcp", addr,
+		&WatcherOptions{Timeout: testTimeout, ReconnectionInterval: time.Millisecond, NonBlocking: true})
+	if err != nil {
+		t.Fatalf("NewWatcher got error %v; want nil", err)
+	}
+	if got, ok := readChan(ctx, t, w.Event()); !ok || got != "reconnecting" {
+		t.Fatalf("got %s, %v; want reconnecting, true", got, ok)
+	}
+	if h := w.Health(); h.Connected || h.LastError == nil {
+		t.Errorf("got Health() %+v; want disconnected with error", h)
+	}
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, "OK MPD 0.19")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "noidle\n" {
+				fmt.Fprintln(conn, "OK")
+			}
+		}
+	}()
+	if got, ok := readChan(ctx, t, w.Event()); !ok || got != "reconnect" {
+		t.Fatalf("got %s, %v; want reconnect, true", got, ok)
+	}
+	if h := w.Health(); !h.Connected {
+		t.Errorf("got Health() %+v; want connected", h)
+	}
+	if err := w.Close(ctx); err != nil {
+		t.Errorf("Close got error %v; want nil", err)
+	}
+}
+
 func readChan(ctx context.Context, t *testing.T, c <-chan string) (ret string, ok bool) {
 	t.Helper()
 	select {
@@ -0,0 +1,292 @@
+// Package mqtt is a minimal MQTT 3.1.1 client which supports QoS 0 publish and subscribe.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultKeepAlive = 60 * time.Second
+
+// ErrClosed is returned when connection is closed.
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options contains connection options.
+type Options struct {
+	ClientID  string
+	UserName  string
+	Password  string
+	KeepAlive time.Duration // ping interval(default: 60 seconds)
+	Will      *Message      // published by broker when connection is lost
+}
+
+// ConnAckError represents connection refused by broker.
+type ConnAckError byte
+
+func (e ConnAckError) Error() string {
+	switch e {
+	case 1:
+		return "mqtt: connection refused: unacceptable protocol version"
+	case 2:
+		return "mqtt: connection refused: identifier rejected"
+	case 3:
+		return "mqtt: connection refused: server unavailable"
+	case 4:
+		return "mqtt: connection refused: bad user name or password"
+	case 5:
+		return "mqtt: connection refused: not authorized"
+	}
+	return fmt.Sprintf("mqtt: connection refused: code %d", byte(e))
+}
+
+// Conn is a MQTT client connection.
+type Conn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+	messages  chan *Message
+	done      chan struct{}
+	err       error
+	packetID  uint16
+	mu        sync.Mutex
+	closeOnce sync.Once
+}
+
+// Dial connects to MQTT broker.
+func Dial(ctx context.Context, network, addr string, opts *Options) (*Conn, error) {
+	o := &Options{}
+	if opts != nil {
+		*o = *opts
+	}
+	if o.KeepAlive == 0 {
+		o.KeepAlive = defaultKeepAlive
+	}
+	dialer := net.Dialer{}
+	nc, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	c := &Conn{
+		conn:      nc,
+		r:         bufio.NewReader(nc),
+		keepAlive: o.KeepAlive,
+		messages:  make(chan *Message, 16),
+		done:      make(chan struct{}),
+	}
+	if err := c.connect(o); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+func (c *Conn) connect(o *Options) error {
+	var flags byte = FlagCleanSession
+	if o.Will != nil {
+		flags |= FlagWill
+		if o.Will.Retain {
+			flags |= FlagWillRetain
+		}
+	}
+	if len(o.UserName) != 0 {
+		flags |= FlagUserName
+	}
+	if len(o.Password) != 0 {
+		flags |= FlagPassword
+	}
+	b := AppendString(nil, "MQTT")
+	b = append(b, 4, flags)
+	b = binary.BigEndian.AppendUint16(b, uint16(o.KeepAlive/time.Second))
+	b = AppendString(b, o.ClientID)
+	if o.Will != nil {
+		b = AppendString(b, o.Will.Topic)
+		b = AppendString(b, string(o.Will.Payload))
+	}
+	if len(o.UserName) != 0 {
+		b = AppendString(b, o.UserName)
+	}
+	if len(o.Password) != 0 {
+		b = AppendString(b, o.Password)
+	}
+	if err := WritePacket(c.conn, &Packet{Type: TypeConnect, Body: b}); err != nil {
+		return err
+	}
+	p, err := ReadPacket(c.r)
+	if err != nil {
+		return err
+	}
+	if p.Type != TypeConnAck || len(p.Body) != 2 {
+		return fmt.Errorf("mqtt: unexpected packet type %d; want CONNACK", p.Type)
+	}
+	if p.Body[1] != 0 {
+		return ConnAckError(p.Body[1])
+	}
+	return nil
+}
+
+// Publish sends message with QoS 0.
+func (c *Conn) Publish(m *Message) error {
+	var flags byte
+	if m.Retain {
+		flags |= FlagRetain
+	}
+	b := AppendString(nil, m.Topic)
+	return c.write(&Packet{Type: TypePublish, Flags: flags, Body: append(b, m.Payload...)})
+}
+
+// Subscribe requests QoS 0 subscription for topic filters.
+// Subscription result is not checked.
+func (c *Conn) Subscribe(filters ...string) error {
+	c.mu.Lock()
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID++
+	}
+	b := binary.BigEndian.AppendUint16(nil, c.packetID)
+	c.mu.Unlock()
+	for _, f := range filters {
+		b = AppendString(b, f)
+		b = append(b, 0)
+	}
+	return c.write(&Packet{Type: TypeSubscribe, Flags: 0x02, Body: b})
+}
+
+// Messages returns received message chan; chan is closed when connection is closed.
+func (c *Conn) Messages() <-chan *Message {
+	return c.messages
+}
+
+// Done returns chan which is closed when connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason why connection was closed.
+func (c *Conn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close sends DISCONNECT and closes connection. broker does not publish will message.
+func (c *Conn) Close() error {
+	err := c.write(&Packet{Type: TypeDisconnect})
+	c.close(ErrClosed)
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (c *Conn) write(p *Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	if err := WritePacket(c.conn, p); err != nil {
+		c.close(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.messages)
+	for {
+		// pingLoop sends PINGREQ every half of keep alive; connection is lost if no PINGRESP arrives
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := ReadPacket(c.r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		if p.Type != TypePublish {
+			continue
+		}
+		m, id, err := parsePublish(p)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		if p.Flags&0x06 != 0 {
+			if err := c.write(&Packet{Type: TypePubAck, Body: binary.BigEndian.AppendUint16(nil, id)}); err != nil {
+				return
+			}
+		}
+		select {
+		case c.messages <- m:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Conn) pingLoop() {
+	t := time.NewTicker(c.keepAlive / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.write(&Packet{Type: TypePingReq}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parsePublish parses PUBLISH packet and returns message and packet id.
+func parsePublish(p *Packet) (*Message, uint16, error) {
+	topic, b, err := ReadString(p.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	var id uint16
+	if p.Flags&0x06 != 0 {
+		if id, b, err = ReadUint16(b); err != nil {
+			return nil, 0, err
+		}
+	}
+	return &Message{Topic: topic, Payload: b, Retain: p.Flags&FlagRetain != 0}, id, nil
+}
+
+// ParsePublish parses PUBLISH packet.
+func ParsePublish(p *Packet) (*Message, error) {
+	m, _, err := parsePublish(p)
+	return m, err
+}
@@ -0,0 +1,105 @@
+package mqtt_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/mqtt"
+	"github.com/meiraka/vv/internal/mqtt/mqtttest"
+)
+
+func recv(t *testing.T, c *mqtt.Conn) *mqtt.Message {
+	t.Helper()
+	select {
+	case m := <-c.Messages():
+		return m
+	case <-time.After(time.Second):
+		t.Fatalf("got no message; want message")
+	}
+	return nil
+}
+
+func TestConn(t *testing.T) {
+	s, err := mqtttest.NewServer()
+	if err != nil {
+		t.Fatalf("mqtttest.NewServer got error %v; want nil", err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pub, err := mqtt.Dial(ctx, "tcp", s.Addr, &mqtt.Options{
+		ClientID:  "pub",
+		KeepAlive: 100 * time.Millisecond,
+		Will:      &mqtt.Message{Topic: "test/availability", Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		t.Fatalf("Dial got error %v; want nil", err)
+	}
+	defer pub.Close()
+	sub, err := mqtt.Dial(ctx, "tcp", s.Addr, &mqtt.Options{ClientID: "sub"})
+	if err != nil {
+		t.Fatalf("Dial got error %v; want nil", err)
+	}
+	defer sub.Close()
+
+	if err := pub.Publish(&mqtt.Message{Topic: "test/retained", Payload: []byte("foo"), Retain: true}); err != nil {
+		t.Fatalf("Publish got error %v; want nil", err)
+	}
+	// wait for broker to store retained message
+	for i := 0; s.Retained("test/retained") == nil; i++ {
+		if i > 100 {
+			t.Fatalf("got no retained message")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := sub.Subscribe("test/#"); err != nil {
+		t.Fatalf("Subscribe got error %v; want nil", err)
+	}
+	if m := recv(t, sub); m.Topic != "test/retained" || string(m.Payload) != "foo" || !m.Retain {
+		t.Errorf("got %+v; want retained foo", m)
+	}
+	large := strings.Repeat("a", 1000)
+	if err := pub.Publish(&mqtt.Message{Topic: "test/large", Payload: []byte(large)}); err != nil {
+		t.Fatalf("Publish got error %v; want nil", err)
+	}
+	if m := recv(t, sub); m.Topic != "test/large" || string(m.Payload) != large || m.Retain {
+		t.Errorf("got %s %d bytes; want test/large %d bytes", m.Topic, len(m.Payload), len(large))
+	}
+
+	// keeps connection by ping
+	time.Sleep(300 * time.Millisecond)
+	if err := pub.Err(); err != nil {
+		t.Fatalf("got connection error %v; want nil", err)
+	}
+
+	// will message
+	s.Disconnect()
+	select {
+	case <-pub.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("connection is not closed")
+	}
+	if m := s.Retained("test/availability"); m == nil || string(m.Payload) != "offline" {
+		t.Errorf("got will message %+v; want offline", m)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"vv/#", "vv/outputs/0/set", true},
+		{"vv/+/set", "vv/volume/set", true},
+		{"vv/+/set", "vv/outputs/0/set", false},
+		{"vv/volume", "vv/volume/set", false},
+		{"vv/volume/set", "vv/volume", false},
+	} {
+		if got := mqtttest.Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v; want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
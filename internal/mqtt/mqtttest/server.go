@@ -0,0 +1,262 @@
+// Package mqtttest provides in-memory MQTT broker for testing.
+package mqtttest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/meiraka/vv/internal/mqtt"
+)
+
+// Server is a minimal MQTT broker which supports QoS 0, retained messages and will messages.
+type Server struct {
+	ln       net.Listener
+	Addr     string
+	clients  map[*client]struct{}
+	retained map[string]*mqtt.Message
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+type client struct {
+	conn    net.Conn
+	filters []string
+	will    *mqtt.Message
+	mu      sync.Mutex
+}
+
+// NewServer starts MQTT broker on localhost.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		Addr:     ln.Addr().String(),
+		clients:  map[*client]struct{}{},
+		retained: map[string]*mqtt.Message{},
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s, nil
+}
+
+// Retained returns retained message for topic.
+func (s *Server) Retained(topic string) *mqtt.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retained[topic]
+}
+
+// Disconnect closes all client connections without DISCONNECT; will messages are published.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+// Close stops broker.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.ln.Close()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	p, err := mqtt.ReadPacket(r)
+	if err != nil || p.Type != mqtt.TypeConnect {
+		return
+	}
+	c := &client{conn: conn}
+	if c.will, err = parseConnect(p); err != nil {
+		return
+	}
+	if err := c.write(&mqtt.Packet{Type: mqtt.TypeConnAck, Body: []byte{0, 0}}); err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		if c.will != nil {
+			s.publish(c.will)
+		}
+	}()
+	for {
+		p, err := mqtt.ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.Type {
+		case mqtt.TypePublish:
+			m, err := mqtt.ParsePublish(p)
+			if err != nil {
+				return
+			}
+			s.publish(m)
+		case mqtt.TypeSubscribe:
+			id, b, err := mqtt.ReadUint16(p.Body)
+			if err != nil {
+				return
+			}
+			var filters []string
+			for len(b) != 0 {
+				var f string
+				if f, b, err = mqtt.ReadString(b); err != nil || len(b) == 0 {
+					return
+				}
+				b = b[1:] // requested qos
+				filters = append(filters, f)
+			}
+			s.mu.Lock()
+			c.filters = append(c.filters, filters...)
+			var retained []*mqtt.Message
+			for _, m := range s.retained {
+				for _, f := range filters {
+					if Match(f, m.Topic) {
+						retained = append(retained, m)
+						break
+					}
+				}
+			}
+			s.mu.Unlock()
+			ack := []byte{byte(id >> 8), byte(id)}
+			for range filters {
+				ack = append(ack, 0)
+			}
+			if err := c.write(&mqtt.Packet{Type: mqtt.TypeSubAck, Body: ack}); err != nil {
+				return
+			}
+			for _, m := range retained {
+				c.publish(m)
+			}
+		case mqtt.TypePingReq:
+			if err := c.write(&mqtt.Packet{Type: mqtt.TypePingResp}); err != nil {
+				return
+			}
+		case mqtt.TypeDisconnect:
+			c.will = nil
+			return
+		}
+	}
+}
+
+func (s *Server) publish(m *mqtt.Message) {
+	s.mu.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(s.retained, m.Topic)
+		} else {
+			s.retained[m.Topic] = m
+		}
+	}
+	var targets []*client
+	for c := range s.clients {
+		for _, f := range c.filters {
+			if Match(f, m.Topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	// retain flag is cleared for subscribed clients
+	sent := &mqtt.Message{Topic: m.Topic, Payload: m.Payload}
+	for _, c := range targets {
+		c.publish(sent)
+	}
+}
+
+func (c *client) publish(m *mqtt.Message) {
+	var flags byte
+	if m.Retain {
+		flags = mqtt.FlagRetain
+	}
+	c.write(&mqtt.Packet{Type: mqtt.TypePublish, Flags: flags, Body: append(mqtt.AppendString(nil, m.Topic), m.Payload...)})
+}
+
+func (c *client) write(p *mqtt.Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return mqtt.WritePacket(c.conn, p)
+}
+
+// parseConnect returns will message in CONNECT packet.
+func parseConnect(p *mqtt.Packet) (*mqtt.Message, error) {
+	_, b, err := mqtt.ReadString(p.Body) // protocol name
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, errors.New("mqtttest: malformed connect packet")
+	}
+	flags := b[1]
+	b = b[4:]                                       // level, flags, keep alive
+	if _, b, err = mqtt.ReadString(b); err != nil { // client id
+		return nil, err
+	}
+	if flags&mqtt.FlagWill == 0 {
+		return nil, nil
+	}
+	topic, b, err := mqtt.ReadString(b)
+	if err != nil {
+		return nil, err
+	}
+	payload, _, err := mqtt.ReadString(b)
+	if err != nil {
+		return nil, err
+	}
+	return &mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: flags&mqtt.FlagWillRetain != 0}, nil
+}
+
+// Match reports whether topic matches topic filter.
+func Match(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
@@ -0,0 +1,122 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types
+const (
+	TypeConnect     byte = 1
+	TypeConnAck     byte = 2
+	TypePublish     byte = 3
+	TypePubAck      byte = 4
+	TypeSubscribe   byte = 8
+	TypeSubAck      byte = 9
+	TypePingReq     byte = 12
+	TypePingResp    byte = 13
+	TypeDisconnect  byte = 14
+	maxRemainingLen      = 268435455
+)
+
+// CONNECT flags
+const (
+	FlagCleanSession byte = 0x02
+	FlagWill         byte = 0x04
+	FlagWillRetain   byte = 0x20
+	FlagPassword     byte = 0x40
+	FlagUserName     byte = 0x80
+)
+
+// PUBLISH flags
+const (
+	FlagRetain byte = 0x01
+	FlagQoS1   byte = 0x02
+)
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// Packet is a MQTT control packet.
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte // variable header and payload
+}
+
+// ReadPacket reads a control packet from r.
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var n, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return nil, errMalformed
+		}
+	}
+	p := &Packet{Type: h >> 4, Flags: h & 0x0f, Body: make([]byte, n)}
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// WritePacket writes a control packet to w.
+func WritePacket(w io.Writer, p *Packet) error {
+	n := len(p.Body)
+	if n > maxRemainingLen {
+		return fmt.Errorf("mqtt: packet too large: %d bytes", n)
+	}
+	b := make([]byte, 1, n+5)
+	b[0] = p.Type<<4 | p.Flags
+	for {
+		d := byte(n & 0x7f)
+		if n >>= 7; n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(b, p.Body...))
+	return err
+}
+
+// AppendString appends length prefixed utf-8 string to b.
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ReadString reads length prefixed string from b and returns rest of b.
+func ReadString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformed
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errMalformed
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// ReadUint16 reads big endian uint16 from b and returns rest of b.
+func ReadUint16(b []byte) (uint16, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, errMalformed
+	}
+	return binary.BigEndian.Uint16(b), b[2:], nil
+}
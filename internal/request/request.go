@@ -2,6 +2,8 @@ package request
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,95 @@ func ModifiedSince(r *http.Request, l time.Time) bool {
 }
 
 // NoneMatch compares request If-None-Match header and etag
+// If-None-Match header may contain comma separated list of etags or "*".
+// etags are compared by weak comparison.
 func NoneMatch(r *http.Request, etag string) bool {
-	return r.Header.Get("If-None-Match") == etag
+	h := r.Header.Get("If-None-Match")
+	if len(h) == 0 {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(h, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptEncoding returns the most preferred content coding in offers by request Accept-Encoding header.
+// offers are ordered by server preference. AcceptEncoding returns "identity" if no offers are acceptable.
+func AcceptEncoding(r *http.Request, offers ...string) string {
+	h := r.Header.Get("Accept-Encoding")
+	if len(h) == 0 {
+		return "identity"
+	}
+	accepts := parseQuality(h)
+	best, bestQ := "identity", -1.0
+	for _, o := range offers {
+		q, ok := accepts[o]
+		if !ok {
+			q, ok = accepts["*"]
+		}
+		if !ok && o == "identity" {
+			q, ok = 0.001, true
+		}
+		if ok && q > 0 && q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// Accept returns the most preferred media type in offers by request Accept header.
+// offers are ordered by server preference. Accept returns offers[0] if no offers are acceptable.
+func Accept(r *http.Request, offers ...string) string {
+	h := r.Header.Get("Accept")
+	if len(h) == 0 || len(offers) == 0 {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	accepts := parseQuality(h)
+	best, bestQ := offers[0], -1.0
+	for _, o := range offers {
+		q, ok := accepts[o]
+		if !ok {
+			if i := strings.Index(o, "/"); i > 0 {
+				q, ok = accepts[o[:i]+"/*"]
+			}
+		}
+		if !ok {
+			q, ok = accepts["*/*"]
+		}
+		if ok && q > 0 && q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// parseQuality parses comma separated header values with quality value.
+func parseQuality(h string) map[string]float64 {
+	ret := map[string]float64{}
+	for _, v := range strings.Split(h, ",") {
+		params := strings.Split(v, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if len(name) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		ret[name] = q
+	}
+	return ret
 }
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/request"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	auditMaxEntries      = 10000
+	auditMaxBodyBytes    = 64 << 10 // maximum request body size to record
+	auditDefaultLimit    = 100
+	auditMaxRequestBytes = 1 << 20 // maximum request body size to accept
+	auditQueueSize       = 64
+)
+
+var bucketAudit = []byte("audit")
+
+// auditEntry represents a mutating api request.
+type auditEntry struct {
+	Time       time.Time       `json:"time"`
+	RequestID  string          `json:"request_id,omitempty"`
+	User       string          `json:"user,omitempty"`
+	RemoteAddr string          `json:"remote_addr"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	Before     json.RawMessage `json:"before,omitempty"`  // api values of requested keys before request
+	Request    json.RawMessage `json:"request,omitempty"` // request body
+}
+
+// AuditHandler records mutating api requests and serves audit log.
+//
+//	GET /api/audit?offset=0&limit=100&since=2006-01-02T15:04:05Z&until=2006-01-02T15:04:05Z&user=alice&path=/api/music
+type AuditHandler struct {
+	db      *bolt.DB
+	user    func(context.Context) (string, bool)
+	logger  Logger
+	changed chan struct{}
+	queued  chan *auditEntry
+	done    chan struct{}
+	date    time.Time
+	n       int // number of entries in db; accessed by record goroutine only
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewAuditHandler opens audit db and creates AuditHandler.
+// user returns user name of request; user field is not recorded if user is nil.
+func NewAuditHandler(path string, user func(context.Context) (string, bool), logger Logger) (*AuditHandler, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0766); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("obtain audit db lock: %w", err)
+		}
+		return nil, err
+	}
+	date := time.Now().UTC()
+	var n int
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketAudit)
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		if k, _ := b.Cursor().Last(); k != nil {
+			date = keyTime(k)
+		}
+		n = b.Stats().KeyN
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	a := &AuditHandler{
+		db:      db,
+		user:    user,
+		logger:  logger,
+		changed: make(chan struct{}, 1),
+		queued:  make(chan *auditEntry, auditQueueSize),
+		done:    make(chan struct{}),
+		date:    date,
+		n:       n,
+	}
+	go a.run()
+	return a, nil
+}
+
+// serve serves r by next and records it with c values before request.
+func (a *AuditHandler) serve(w http.ResponseWriter, r *http.Request, c *cache, next http.Handler) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, auditMaxRequestBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var before json.RawMessage
+	if c != nil {
+		cur, _ := c.get()
+		before = auditBefore(cur, body)
+	}
+	sw := &auditResponseWriter{ResponseWriter: w}
+	next.ServeHTTP(sw, r)
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	e := &auditEntry{
+		Time:       time.Now().UTC(),
+		RequestID:  log.RequestID(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		Path:       r.URL.Path,
+		Status:     sw.status,
+		Before:     before,
+	}
+	if len(body) <= auditMaxBodyBytes && json.Valid(body) {
+		e.Request = body
+	}
+	if a.user != nil {
+		e.User, _ = a.user(r.Context())
+	}
+	a.queue(e)
+}
+
+// auditBefore returns values in cur for keys in req.
+func auditBefore(cur, req []byte) json.RawMessage {
+	var reqm, curm map[string]json.RawMessage
+	if err := json.Unmarshal(req, &reqm); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(cur, &curm); err != nil {
+		return nil
+	}
+	ret := make(map[string]json.RawMessage, len(reqm))
+	for k := range reqm {
+		if v, ok := curm[k]; ok {
+			ret[k] = v
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(ret)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// queue queues e to record in background.
+func (a *AuditHandler) queue(e *auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.queued <- e:
+	default:
+		a.logger.Warnw("vv/api: audit: queue is full; dropped entry", "request_id", e.RequestID, "path", e.Path)
+	}
+}
+
+func (a *AuditHandler) run() {
+	defer close(a.done)
+	for e := range a.queued {
+		a.record(e)
+	}
+}
+
+func (a *AuditHandler) record(e *auditEntry) {
+	n := a.n
+	if err := a.db.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		bucket := tx.Bucket(bucketAudit)
+		k := timeKey(e.Time)
+		// avoid to overwrite entry which has same timestamp
+		for bucket.Get(k) != nil {
+			binary.BigEndian.PutUint64(k, binary.BigEndian.Uint64(k)+1)
+		}
+		if err := bucket.Put(k, b); err != nil {
+			return err
+		}
+		n++
+		// remove old entries
+		c := bucket.Cursor()
+		for n > auditMaxEntries {
+			k, _ := c.First()
+			if k == nil {
+				break
+			}
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	}); err != nil {
+		a.logger.Errorw("vv/api: failed to record audit log", "request_id", e.RequestID, "path", e.Path, "error", err)
+		return
+	}
+	a.n = n
+	a.mu.Lock()
+	a.date = e.Time
+	a.mu.Unlock()
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+// ServeHTTP responses audit log as json format ordered by newest first.
+func (a *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	v, err := a.entries(r.URL.Query())
+	if err != nil {
+		var qerr *queryError
+		if errors.As(err, &qerr) {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.mu.Lock()
+	date := a.date
+	a.mu.Unlock()
+	cb := newCacheBinary(mediaTypeJSON+"; charset=utf-8", b, request.AcceptEncoding(r, cacheEncodings...))
+	serveCacheBinary(w, r, cb, date, `"`+cb.hash+`"`)
+}
+
+// entries returns audit log entries ordered by newest first.
+func (a *AuditHandler) entries(q url.Values) ([]*auditEntry, error) {
+	offset, err := queryInt(q, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(q, "limit", auditDefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	since, err := queryTime(q, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := queryTime(q, "until")
+	if err != nil {
+		return nil, err
+	}
+	user, path := q.Get("user"), q.Get("path")
+	ret := []*auditEntry{}
+	err = a.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketAudit).Cursor()
+		k, v := c.Last()
+		if !until.IsZero() {
+			if k, v = c.Seek(timeKey(until)); k == nil {
+				k, v = c.Last()
+			} else if keyTime(k).After(until) {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil && len(ret) < limit; k, v = c.Prev() {
+			if !since.IsZero() && keyTime(k).Before(since) {
+				break
+			}
+			e := &auditEntry{}
+			if err := json.Unmarshal(v, e); err != nil {
+				return err
+			}
+			if (len(user) != 0 && e.User != user) || (len(path) != 0 && e.Path != path) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			ret = append(ret, e)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Changed returns audit log update event chan.
+func (a *AuditHandler) Changed() <-chan struct{} {
+	return a.changed
+}
+
+// Close closes audit db and update event chan.
+func (a *AuditHandler) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.queued)
+	a.mu.Unlock()
+	// waits until queued entries are recorded
+	<-a.done
+	close(a.changed)
+	if err := a.db.Close(); err != nil {
+		a.logger.Errorw("vv/api: audit: failed to close db", "error", err)
+	}
+}
+
+// auditResponseWriter records response status.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
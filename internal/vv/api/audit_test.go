@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+)
+
+func TestAuditHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	user := func(ctx context.Context) (string, bool) {
+		name := log.RequestID(ctx)
+		return name, len(name) != 0
+	}
+	h, err := NewAuditHandler(path, user, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("NewAuditHandler got error %v; want nil", err)
+	}
+	c, err := newCache(map[string]interface{}{"volume": 30, "state": "play"})
+	if err != nil {
+		t.Fatalf("newCache got error %v; want nil", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(b), "invalid") {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("invalid state"))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	post := func(body, ua string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/music", strings.NewReader(body))
+		r.Header.Set("User-Agent", ua)
+		r.Header.Set(log.HeaderRequestID, ua+"-id")
+		log.AccessLog(log.New(io.Discard), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.serve(w, r, c, next)
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		select {
+		case <-h.Changed():
+		case <-time.After(time.Second):
+			t.Fatalf("got no changed event")
+		}
+	}
+	post(`{"volume":50}`, "foo")
+	post(`{"state":"invalid"}`, "bar")
+
+	get := func(query string) []*auditEntry {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/audit"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s got status %d; want %d", query, w.Code, http.StatusOK)
+		}
+		var ret []*auditEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+			t.Fatalf("failed to parse json %s: %v", w.Body.String(), err)
+		}
+		return ret
+	}
+	got := get("")
+	if len(got) != 2 {
+		t.Fatalf("got %d entries; want 2", len(got))
+	}
+	if e := got[0]; e.UserAgent != "bar" || e.Status != http.StatusBadRequest || string(e.Before) != `{"state":"play"}` || string(e.Request) != `{"state":"invalid"}` {
+		t.Errorf("got %+v; want failed state request", e)
+	}
+	if e := got[1]; e.UserAgent != "foo" || e.RequestID != "foo-id" || e.Status != http.StatusAccepted || e.Path != "/api/music" || len(e.RemoteAddr) == 0 ||
+		string(e.Before) != `{"volume":30}` || string(e.Request) != `{"volume":50}` {
+		t.Errorf("got %+v; want volume request", e)
+	}
+	if got := get("?offset=1&limit=1"); len(got) != 1 || got[0].UserAgent != "foo" {
+		t.Errorf("got %+v; want second entry", got)
+	}
+	if got := get("?user=alice"); len(got) != 0 {
+		t.Errorf("got %+v; want no entries for alice", got)
+	}
+	if got := get("?user=foo-id"); len(got) != 1 || got[0].User != "foo-id" {
+		t.Errorf("got %+v; want entry for foo-id", got)
+	}
+	w := httptest.NewRecorder()
+	h.serve(w, httptest.NewRequest(http.MethodPost, "/api/music", strings.NewReader(strings.Repeat(" ", auditMaxRequestBytes+1))), c, next)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST large body got status %d; want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	h.Close()
+
+	// entries are persistent
+	h, err = NewAuditHandler(path, user, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("NewAuditHandler got error %v; want nil", err)
+	}
+	defer h.Close()
+	if got := get(""); len(got) != 2 {
+		t.Errorf("got %d entries after reopen; want 2", len(got))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/meiraka/vv/internal/songs"
@@ -34,6 +35,9 @@ type imgBatch struct {
 	shutdownCh chan struct{}
 	shutdownB  bool
 	logger     Logger
+
+	total atomic.Int64
+	done  atomic.Int64
 }
 
 // newImgBatch creates Batch from some cover image api.
@@ -95,6 +99,8 @@ func (b *imgBatch) update(songs []map[string][]string, force bool) error {
 	case b.e <- true:
 	default:
 	}
+	b.total.Store(int64(len(songs)))
+	b.done.Store(0)
 	go func() {
 		defer func() { b.sem <- struct{}{} }()
 		ctx, cancel := context.WithCancel(context.Background())
@@ -110,12 +116,12 @@ func (b *imgBatch) update(songs []map[string][]string, force bool) error {
 			for _, c := range b.apis {
 				if force {
 					if err := c.Rescan(ctx, song, reqID); err != nil {
-						b.logger.Printf("vv/api: batch: rescan: %v: %v", songsTag(song, "file"), err)
+						b.logger.Warnw("vv/api: batch: failed to rescan", "file", songsTag(song, "file"), "error", err)
 						// use previous rescanned result
 					}
 				} else {
 					if err := c.Update(ctx, song); err != nil {
-						b.logger.Printf("vv/api: batch: update: %v: %v", songsTag(song, "file"), err)
+						b.logger.Warnw("vv/api: batch: failed to update", "file", songsTag(song, "file"), "error", err)
 						// use previous rescanned result
 					}
 				}
@@ -124,6 +130,7 @@ func (b *imgBatch) update(songs []map[string][]string, force bool) error {
 					break
 				}
 			}
+			b.done.Add(1)
 		}
 		select {
 		case <-ctx.Done():
@@ -135,6 +142,11 @@ func (b *imgBatch) update(songs []map[string][]string, force bool) error {
 	return nil
 }
 
+// Progress returns number of processed songs and total songs in the last batch.
+func (b *imgBatch) Progress() (done, total int) {
+	return int(b.done.Load()), int(b.total.Load())
+}
+
 // Shutdown gracefully shuts down cover image updater.
 func (b *imgBatch) Shutdown(ctx context.Context) error {
 	b.shutdownMu.Lock()
@@ -37,9 +37,15 @@ func TestImgBatch(t *testing.T) {
 			t.Errorf("batch.Rescan() = %v; want %v", err, errAlreadyUpdating)
 		}
 		testEvent(ctx, t, batch.Event(), true, true)
+		if done, total := batch.Progress(); done != 0 || total != 1 {
+			t.Errorf("batch.Progress() = %d, %d; want 0, 1", done, total)
+		}
 		c1 <- struct{}{}
 		c2 <- struct{}{}
 		testEvent(ctx, t, batch.Event(), false, true)
+		if done, total := batch.Progress(); done != 1 || total != 1 {
+			t.Errorf("batch.Progress() = %d, %d; want 1, 1", done, total)
+		}
 		if len(c1) != 0 {
 			t.Errorf("cov1.Update is not called: %d", len(c1))
 		}
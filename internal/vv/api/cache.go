@@ -1,39 +1,58 @@
 package api
 
 import (
-	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/meiraka/vv/internal/brotli"
 	"github.com/meiraka/vv/internal/gzip"
 	"github.com/meiraka/vv/internal/request"
+	"github.com/meiraka/vv/internal/zstd"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeCBOR = "application/cbor"
+)
+
+var (
+	// cacheEncodings is a list of supported content codings ordered by server preference.
+	cacheEncodings = []string{"br", "zstd", "gzip", "identity"}
+	cacheEncoders  = map[string]func([]byte) ([]byte, error){
+		"br":   brotli.Encode,
+		"zstd": zstd.Encode,
+		"gzip": gzip.Encode,
+	}
 )
 
 type cache struct {
 	changed  chan struct{}
 	changedB bool
-	json     []byte
-	gzjson   []byte
+	data     interface{}
+	json     *cacheBinary
+	cbor     *cacheBinary
 	date     time.Time
 	mu       sync.RWMutex
 }
 
 func newCache(i interface{}) (*cache, error) {
-	b, gz, err := cacheBinary(i)
+	b, err := newJSONCacheBinary(i)
 	if err != nil {
 		return nil, err
 	}
 	c := &cache{
 		changed:  make(chan struct{}, 1),
 		changedB: true,
+		data:     i,
 		json:     b,
-		gzjson:   gz,
 		date:     time.Now().UTC(),
 	}
 	return c, nil
@@ -61,59 +80,95 @@ func (c *cache) SetIfModified(i interface{}) (changed bool, err error) {
 	return c.set(i, false)
 }
 
-func (c *cache) get() ([]byte, []byte, time.Time) {
+func (c *cache) get() ([]byte, time.Time) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.json, c.gzjson, c.date
+	return c.json.identity, c.date
 }
 
-func (c *cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// size returns json body size in bytes.
+func (c *cache) size() int {
 	c.mu.RLock()
-	b, gz, date := c.json, c.gzjson, c.date
-	c.mu.RUnlock()
-	etag := fmt.Sprintf(`"%d.%d"`, date.Unix(), date.Nanosecond())
-	if request.NoneMatch(r, etag) {
-		w.WriteHeader(http.StatusNotModified)
-		return
-	}
-	if !request.ModifiedSince(r, date) {
-		w.WriteHeader(http.StatusNotModified)
+	defer c.mu.RUnlock()
+	return len(c.json.identity)
+}
+
+// version returns content hash of json and last modified date.
+func (c *cache) version() (string, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.json.hash, c.date
+}
+
+// dataVersion returns cache data with its content hash and last modified date.
+func (c *cache) dataVersion() (interface{}, string, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.data, c.json.hash, c.date
+}
+
+func (c *cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if request.Accept(r, mediaTypeJSON, mediaTypeCBOR) == mediaTypeCBOR {
+		hash, date := c.version()
+		etag := `"` + hash + `.cbor"`
+		if notModified(r, etag, date) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		b, date, err := c.getCBOR()
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		serveCacheBinary(w, r, b, date, `"`+b.hash+`.cbor"`)
 		return
 	}
-	w.Header().Add("Cache-Control", "max-age=0")
-	w.Header().Add("Content-Type", "application/json; charset=utf-8")
-	w.Header().Add("Last-Modified", date.Format(http.TimeFormat))
-	w.Header().Add("Vary", "Accept-Encoding")
-	w.Header().Add("ETag", etag)
-	status := http.StatusOK
-	if getUpdateTime(r).After(date) {
-		status = http.StatusAccepted
+	c.mu.RLock()
+	b, date := c.json, c.date
+	c.mu.RUnlock()
+	serveCacheBinary(w, r, b, date, `"`+b.hash+`"`)
+}
+
+// getCBOR returns cbor representation of cache data.
+// cbor binary is created at first request for each data.
+func (c *cache) getCBOR() (*cacheBinary, time.Time, error) {
+	c.mu.RLock()
+	b, date := c.cbor, c.date
+	c.mu.RUnlock()
+	if b != nil {
+		return b, date, nil
 	}
-	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && gz != nil {
-		w.Header().Add("Content-Encoding", "gzip")
-		w.Header().Add("Content-Length", strconv.Itoa(len(gz)))
-		w.WriteHeader(status)
-		w.Write(gz)
-		return
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cbor == nil {
+		n, err := newCBORCacheBinary(c.data)
+		if err != nil {
+			return nil, c.date, err
+		}
+		// use json hash to create cbor etag without cbor encoding
+		n.hash = c.json.hash
+		c.cbor = n
 	}
-	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
-	w.WriteHeader(status)
-	w.Write(b)
+	return c.cbor, c.date, nil
 }
 
 func (c *cache) set(i interface{}, force bool) (bool, error) {
-	n, gz, err := cacheBinary(i)
+	n, err := newJSONCacheBinary(i)
 	if err != nil {
 		return false, err
 	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	o := c.json
-	if force || !bytes.Equal(o, n) {
+	if force || c.json.hash != n.hash {
+		// encodes in background to avoid compressing on next request
+		if e := c.json.requested(); len(e) != 0 {
+			go n.warm(e)
+		}
+		c.data = i
 		c.json = n
+		c.cbor = nil
 		c.date = time.Now().UTC()
-		c.gzjson = gz
 		if c.changedB {
 			select {
 			case c.changed <- struct{}{}:
@@ -125,16 +180,136 @@ func (c *cache) set(i interface{}, force bool) (bool, error) {
 	return false, nil
 }
 
-func cacheBinary(i interface{}) ([]byte, []byte, error) {
+// cacheBinary is a response body with content codings.
+// each content coding is encoded at first request for it or by warm.
+type cacheBinary struct {
+	contentType string
+	hash        string
+	identity    []byte
+	encoded     map[string]*cacheEncoded
+}
+
+type cacheEncoded struct {
+	requested atomic.Bool
+	once      sync.Once
+	body      []byte
+	err       error
+}
+
+func newJSONCacheBinary(i interface{}) (*cacheBinary, error) {
 	n, err := json.Marshal(i)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	gz, err := gzip.Encode(n)
+	return newCacheBinary(mediaTypeJSON+"; charset=utf-8", n, cacheEncodings...), nil
+}
+
+func newCBORCacheBinary(i interface{}) (*cacheBinary, error) {
+	n, err := cbor.Marshal(i)
 	if err != nil {
-		return n, nil, nil
+		return nil, err
+	}
+	return newCacheBinary(mediaTypeCBOR, n, cacheEncodings...), nil
+}
+
+// newCacheBinary creates cacheBinary which can be encoded with given content codings.
+func newCacheBinary(contentType string, b []byte, encodings ...string) *cacheBinary {
+	hasher := md5.New()
+	hasher.Write(b)
+	ret := &cacheBinary{
+		contentType: contentType,
+		hash:        hex.EncodeToString(hasher.Sum(nil)),
+		identity:    b,
+		encoded:     make(map[string]*cacheEncoded, len(encodings)),
+	}
+	for _, e := range encodings {
+		if _, ok := cacheEncoders[e]; ok {
+			ret.encoded[e] = &cacheEncoded{}
+		}
+	}
+	return ret
+}
+
+// encodings returns available content codings ordered by server preference.
+func (b *cacheBinary) encodings() []string {
+	ret := make([]string, 0, len(cacheEncodings))
+	for _, e := range cacheEncodings {
+		if _, ok := b.encoded[e]; ok || e == "identity" {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// body returns body encoded with content coding; body reports false if encoding is not available or failed.
+func (b *cacheBinary) body(encoding string) ([]byte, bool) {
+	if encoding == "identity" {
+		return b.identity, true
+	}
+	e, ok := b.encoded[encoding]
+	if !ok {
+		return nil, false
+	}
+	e.requested.Store(true)
+	e.once.Do(func() {
+		e.body, e.err = cacheEncoders[encoding](b.identity)
+	})
+	return e.body, e.err == nil
+}
+
+// requested returns content codings which were requested.
+func (b *cacheBinary) requested() []string {
+	var ret []string
+	for _, e := range cacheEncodings {
+		if v, ok := b.encoded[e]; ok && v.requested.Load() {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// warm encodes body with content codings.
+func (b *cacheBinary) warm(encodings []string) {
+	for _, e := range encodings {
+		b.body(e)
+	}
+}
+
+// notModified evaluates conditional request headers.
+// If-Modified-Since is ignored if request has If-None-Match header.
+func notModified(r *http.Request, etag string, date time.Time) bool {
+	if len(r.Header.Get("If-None-Match")) != 0 {
+		return request.NoneMatch(r, etag)
+	}
+	return !request.ModifiedSince(r, date)
+}
+
+// serveCacheBinary responses b with conditional request headers and content negotiation.
+func serveCacheBinary(w http.ResponseWriter, r *http.Request, b *cacheBinary, date time.Time, etag string) {
+	if notModified(r, etag, date) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
-	return n, gz, nil
+	w.Header().Add("Cache-Control", "max-age=0")
+	w.Header().Add("Content-Type", b.contentType)
+	w.Header().Add("Last-Modified", date.Format(http.TimeFormat))
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+	w.Header().Add("ETag", etag)
+	status := http.StatusOK
+	if getUpdateTime(r).After(date) {
+		status = http.StatusAccepted
+	}
+	encoding := request.AcceptEncoding(r, b.encodings()...)
+	body, ok := b.body(encoding)
+	if !ok {
+		encoding, body = "identity", b.identity
+	}
+	if encoding != "identity" {
+		w.Header().Add("Content-Encoding", encoding)
+	}
+	w.Header().Add("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
 }
 
 type httpContextKey string
@@ -2,12 +2,18 @@ package api
 
 import (
 	"bytes"
+	"crypto/md5"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/meiraka/vv/internal/brotli"
+	"github.com/meiraka/vv/internal/gzip"
+	"github.com/meiraka/vv/internal/zstd"
 )
 
 func TestCacheSet(t *testing.T) {
@@ -17,34 +23,59 @@ func TestCacheSet(t *testing.T) {
 		t.Fatalf("failed to init cache: %v", err)
 	}
 
-	if b, _, date := b.get(); string(b) != `null` || date.Equal(time.Time{}) {
+	if b, date := b.get(); string(b) != `null` || date.Equal(time.Time{}) {
 		t.Errorf("got %s, _, %v; want nil, _, not time.Time{}", b, date)
 	}
 	b.Set(map[string]int{"a": 1})
-	if b, _, date := b.get(); string(b) != `{"a":1}` || date.Equal(time.Time{}) {
+	if b, date := b.get(); string(b) != `{"a":1}` || date.Equal(time.Time{}) {
 		t.Errorf("got %s, _, %v; want %s, _, not time.Time{}", b, date, `{"a":1}`)
 	} else {
 		oldDate = date
 	}
 	b.SetIfModified(map[string]int{"a": 1})
-	if b, _, date := b.get(); string(b) != `{"a":1}` || !date.Equal(oldDate) {
+	if b, date := b.get(); string(b) != `{"a":1}` || !date.Equal(oldDate) {
 		t.Errorf("got %s, _, %v; want %s, _, %v", b, date, `{"a":1}`, oldDate)
 	} else {
 		oldDate = date
 	}
 	b.Set(map[string]int{"a": 1})
-	if b, _, date := b.get(); string(b) != `{"a":1}` || date.Equal(oldDate) {
+	if b, date := b.get(); string(b) != `{"a":1}` || date.Equal(oldDate) {
 		t.Errorf("got %s, _, %v; want %s, _, not %v", b, date, `{"a":1}`, oldDate)
 	} else {
 		oldDate = date
 	}
 	b.SetIfModified(map[string]int{"a": 2})
-	if b, _, date := b.get(); string(b) != `{"a":2}` || date.Equal(oldDate) {
+	if b, date := b.get(); string(b) != `{"a":2}` || date.Equal(oldDate) {
 		t.Errorf("got %s, _, %v; want %s, _, not %v", b, date, `{"a":2}`, oldDate)
 	}
 
 }
 
+func TestCacheETag(t *testing.T) {
+	a, err := newCache(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("failed to init cache: %v", err)
+	}
+	b, err := newCache(nil)
+	if err != nil {
+		t.Fatalf("failed to init cache: %v", err)
+	}
+	b.Set(map[string]int{"a": 1})
+	ah, _ := a.version()
+	bh, bdate := b.version()
+	if ah != bh {
+		t.Errorf("got etag %s and %s for same content; want same etag", ah, bh)
+	}
+	b.Set(map[string]int{"a": 1})
+	if h, date := b.version(); h != bh || date.Equal(bdate) {
+		t.Errorf("forced Set got %s, %v; want %s, not %v", h, date, bh, bdate)
+	}
+	b.Set(map[string]int{"a": 2})
+	if h, _ := b.version(); h == ah {
+		t.Errorf("got etag %s for different content; want other etag", h)
+	}
+}
+
 func TestCacheHandler(t *testing.T) {
 	b, err := newCache(nil)
 	if err != nil {
@@ -53,7 +84,24 @@ func TestCacheHandler(t *testing.T) {
 	b.SetIfModified(map[string]int{"a": 1})
 	ts := httptest.NewServer(b)
 	defer ts.Close()
-	body, gz, date := b.get()
+	body, date := b.get()
+	gz, err := gzip.Encode(body)
+	if err != nil {
+		t.Fatalf("failed to encode gzip: %v", err)
+	}
+	br, err := brotli.Encode(body)
+	if err != nil {
+		t.Fatalf("failed to encode brotli: %v", err)
+	}
+	zst, err := zstd.Encode(body)
+	if err != nil {
+		t.Fatalf("failed to encode zstd: %v", err)
+	}
+	cb, err := cbor.Marshal(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("failed to encode cbor: %v", err)
+	}
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(body))
 	testsets := []struct {
 		header http.Header
 		status int
@@ -61,8 +109,19 @@ func TestCacheHandler(t *testing.T) {
 	}{
 		{header: http.Header{"Accept-Encoding": {"identity"}}, status: 200, want: body},
 		{header: http.Header{"Accept-Encoding": {"gzip"}}, status: 200, want: gz},
-		{header: http.Header{"Accept-Encoding": {"identity"}, "If-None-Match": {fmt.Sprintf(`"%d.%d"`, date.Unix(), date.Nanosecond())}}, status: 304, want: []byte{}},
+		{header: http.Header{"Accept-Encoding": {"gzip, deflate, br"}}, status: 200, want: br},
+		{header: http.Header{"Accept-Encoding": {"gzip, zstd"}}, status: 200, want: zst},
+		{header: http.Header{"Accept-Encoding": {"br;q=0.5, gzip;q=0.8"}}, status: 200, want: gz},
+		{header: http.Header{"Accept-Encoding": {"br;q=0, *"}}, status: 200, want: zst},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "Accept": {"application/cbor"}}, status: 200, want: cb},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "Accept": {"application/json;q=0.9, application/cbor"}}, status: 200, want: cb},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "Accept": {"application/cbor;q=0.5, */*"}}, status: 200, want: body},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "If-None-Match": {etag}}, status: 304, want: []byte{}},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "If-None-Match": {`"foo", W/` + etag}}, status: 304, want: []byte{}},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "If-None-Match": {"*"}}, status: 304, want: []byte{}},
 		{header: http.Header{"Accept-Encoding": {"identity"}, "If-None-Match": {""}}, status: 200, want: body},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "If-None-Match": {`"foo"`}, "If-Modified-Since": {date.Format(http.TimeFormat)}}, status: 200, want: body},
+		{header: http.Header{"Accept-Encoding": {"identity"}, "Accept": {"application/cbor"}, "If-None-Match": {etag}}, status: 200, want: cb},
 		{header: http.Header{"Accept-Encoding": {"identity"}, "If-Modified-Since": {date.Format(http.TimeFormat)}}, status: 304, want: []byte{}},
 		{header: http.Header{"Accept-Encoding": {"identity"}, "If-Modified-Since": {date.Add(time.Second).Format(http.TimeFormat)}}, status: 304, want: []byte{}},
 		{header: http.Header{"Accept-Encoding": {"identity"}, "If-Modified-Since": {date.Add(-1 * time.Second).Format(http.TimeFormat)}}, status: 200, want: body},
@@ -92,3 +151,56 @@ func TestCacheHandler(t *testing.T) {
 
 	}
 }
+
+func TestCacheBinaryEncodeLazily(t *testing.T) {
+	b := newCacheBinary(mediaTypeJSON, []byte(`{"a":1}`), cacheEncodings...)
+	for e, v := range b.encoded {
+		if v.body != nil {
+			t.Errorf("got %s body before request; want nil", e)
+		}
+	}
+	got, ok := b.body("gzip")
+	want, _ := gzip.Encode([]byte(`{"a":1}`))
+	if !ok || !bytes.Equal(got, want) {
+		t.Errorf("got gzip body %v, %v; want %v, true", got, ok, want)
+	}
+	if b.encoded["br"].body != nil {
+		t.Error("got br body without request; want nil")
+	}
+	if _, ok := b.body("deflate"); ok {
+		t.Error("got deflate body; want not available")
+	}
+}
+
+func TestCacheSetWarmsRequestedEncodings(t *testing.T) {
+	c, err := newCache(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("newCache got error %v; want nil", err)
+	}
+	defer c.Close()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	c.ServeHTTP(httptest.NewRecorder(), r)
+	if err := c.Set(map[string]int{"a": 2}); err != nil {
+		t.Fatalf("Set got error %v; want nil", err)
+	}
+	c.mu.RLock()
+	b := c.json
+	c.mu.RUnlock()
+	timeout := time.After(time.Second)
+	for !b.encoded["br"].requested.Load() {
+		select {
+		case <-timeout:
+			t.Fatal("got no br encoding after Set; want encoded in background")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	got, ok := b.body("br")
+	want, _ := brotli.Encode([]byte(`{"a":2}`))
+	if !ok || !bytes.Equal(got, want) {
+		t.Errorf("got br body %v, %v; want %v, true", got, ok, want)
+	}
+	if b.encoded["zstd"].requested.Load() || b.encoded["gzip"].requested.Load() {
+		t.Error("got unrequested encodings after Set; want br only")
+	}
+}
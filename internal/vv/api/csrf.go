@@ -0,0 +1,108 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	cookieCSRF = "vv_csrf"
+	headerCSRF = "X-CSRF-Token"
+)
+
+var (
+	errCSRFToken   = errors.New("invalid or missing csrf token")
+	errContentType = errors.New("Content-Type must be application/json")
+)
+
+// csrf protects state changing apis and websocket from cross site requests.
+//
+// Browser requests must have same or allowed Origin and POST requests from browser
+// must have X-CSRF-Token header which equals to SameSite=Strict vv_csrf cookie.
+// Requests without Origin and Cookie header(e.g. scripts with api token) do not need csrf token.
+type csrf struct {
+	origins map[string]struct{}
+}
+
+func newCSRF(origins []string) (*csrf, error) {
+	c := &csrf{origins: make(map[string]struct{}, len(origins))}
+	for _, o := range origins {
+		u, err := url.Parse(o)
+		if err != nil {
+			return nil, fmt.Errorf("allowed origins: %w", err)
+		}
+		if len(u.Scheme) == 0 || len(u.Host) == 0 || (len(u.Path) != 0 && u.Path != "/") || len(u.RawQuery) != 0 {
+			return nil, fmt.Errorf("allowed origins: %q: must be scheme://host[:port]", o)
+		}
+		c.origins[strings.ToLower(u.Scheme+"://"+u.Host)] = struct{}{}
+	}
+	return c, nil
+}
+
+// CheckOrigin returns true if request has no Origin header, same origin or allowed origin.
+func (c *csrf) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	_, ok := c.origins[strings.ToLower(u.Scheme+"://"+u.Host)]
+	return ok
+}
+
+// Check validates request and returns http status and error for invalid request.
+func (c *csrf) Check(r *http.Request) (int, error) {
+	if !c.CheckOrigin(r) {
+		return http.StatusForbidden, fmt.Errorf("origin not allowed: %s", r.Header.Get("Origin"))
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return http.StatusOK, nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != mediaTypeJSON {
+		return http.StatusUnsupportedMediaType, errContentType
+	}
+	if len(r.Header.Get("Origin")) == 0 && len(r.Header.Get("Cookie")) == 0 {
+		return http.StatusOK, nil
+	}
+	cookie, err := r.Cookie(cookieCSRF)
+	if err != nil || len(cookie.Value) == 0 {
+		return http.StatusForbidden, errCSRFToken
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(headerCSRF))) != 1 {
+		return http.StatusForbidden, errCSRFToken
+	}
+	return http.StatusOK, nil
+}
+
+// SetToken sets new csrf token cookie if request does not have it.
+func (c *csrf) SetToken(w http.ResponseWriter, r *http.Request) error {
+	if cookie, err := r.Cookie(cookieCSRF); err == nil && len(cookie.Value) != 0 {
+		return nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieCSRF,
+		Value:    hex.EncodeToString(b),
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
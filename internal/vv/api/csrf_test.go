@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewCSRF(t *testing.T) {
+	for _, o := range []string{"example.com", "http://example.com/foo", "http://example.com?foo=bar"} {
+		if _, err := newCSRF([]string{o}); err == nil {
+			t.Errorf("newCSRF(%q) got nil error; want error", o)
+		}
+	}
+}
+
+func TestCSRFCheck(t *testing.T) {
+	c, err := newCSRF([]string{"https://vv.example.com"})
+	if err != nil {
+		t.Fatalf("newCSRF got error %v; want nil", err)
+	}
+	for label, tt := range map[string]struct {
+		method string
+		header http.Header
+		status int
+		err    error
+	}{
+		"GET/no origin": {
+			method: http.MethodGet,
+			status: http.StatusOK,
+		},
+		"GET/same origin": {
+			method: http.MethodGet,
+			header: http.Header{"Origin": {"http://example.com"}},
+			status: http.StatusOK,
+		},
+		"GET/allowed origin": {
+			method: http.MethodGet,
+			header: http.Header{"Origin": {"https://vv.example.com"}},
+			status: http.StatusOK,
+		},
+		"GET/cross origin": {
+			method: http.MethodGet,
+			header: http.Header{"Origin": {"http://evil.example.com"}},
+			status: http.StatusForbidden,
+		},
+		"POST/script": {
+			method: http.MethodPost,
+			header: http.Header{"Content-Type": {"application/json"}},
+			status: http.StatusOK,
+		},
+		"POST/text plain": {
+			method: http.MethodPost,
+			header: http.Header{"Content-Type": {"text/plain"}},
+			status: http.StatusUnsupportedMediaType, err: errContentType,
+		},
+		"POST/no content type": {
+			method: http.MethodPost,
+			status: http.StatusUnsupportedMediaType, err: errContentType,
+		},
+		"POST/browser without token": {
+			method: http.MethodPost,
+			header: http.Header{"Content-Type": {"application/json; charset=utf-8"}, "Origin": {"http://example.com"}, "Cookie": {"vv_csrf=foo"}},
+			status: http.StatusForbidden, err: errCSRFToken,
+		},
+		"POST/browser with invalid token": {
+			method: http.MethodPost,
+			header: http.Header{"Content-Type": {"application/json"}, "Origin": {"http://example.com"}, "Cookie": {"vv_csrf=foo"}, "X-Csrf-Token": {"bar"}},
+			status: http.StatusForbidden, err: errCSRFToken,
+		},
+		"POST/browser with token": {
+			method: http.MethodPost,
+			header: http.Header{"Content-Type": {"application/json"}, "Origin": {"http://example.com"}, "Cookie": {"vv_csrf=foo"}, "X-Csrf-Token": {"foo"}},
+			status: http.StatusOK,
+		},
+		"POST/cross origin with token": {
+			method: http.MethodPost,
+			header: http.Header{"Content-Type": {"application/json"}, "Origin": {"http://evil.example.com"}, "Cookie": {"vv_csrf=foo"}, "X-Csrf-Token": {"foo"}},
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(label, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com/api/music", nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			status, err := c.Check(r)
+			if status != tt.status {
+				t.Errorf("got status %d; want %d", status, tt.status)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("got error %v; want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCSRFSetToken(t *testing.T) {
+	c, err := newCSRF(nil)
+	if err != nil {
+		t.Fatalf("newCSRF got error %v; want nil", err)
+	}
+	w := httptest.NewRecorder()
+	if err := c.SetToken(w, httptest.NewRequest(http.MethodGet, "/api/music", nil)); err != nil {
+		t.Fatalf("SetToken got error %v; want nil", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cookieCSRF || len(cookies[0].Value) == 0 || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("got cookies %v; want SameSite=Strict %s cookie", cookies, cookieCSRF)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/music", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	if err := c.SetToken(w, r); err != nil {
+		t.Fatalf("SetToken got error %v; want nil", err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("got cookies %v for request with token; want no cookies", cookies)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"net/http"
+	"sync"
 )
 
 type MPDCurrentSong interface {
@@ -13,6 +14,8 @@ type CurrentSongHandler struct {
 	mpd      MPDCurrentSong
 	cache    *cache
 	songHook func(map[string][]string) map[string][]string
+	data     map[string][]string
+	mu       sync.RWMutex
 }
 
 func NewCurrentSongHandler(mpd MPDCurrentSong, songHook func(map[string][]string) map[string][]string) (*CurrentSongHandler, error) {
@@ -32,8 +35,21 @@ func (a *CurrentSongHandler) Update(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	_, err = a.cache.SetIfModified(a.songHook(l))
-	return err
+	song := a.songHook(l)
+	if _, err := a.cache.SetIfModified(song); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.data = song
+	a.mu.Unlock()
+	return nil
+}
+
+// Cache returns current song.
+func (a *CurrentSongHandler) Cache() map[string][]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.data
 }
 
 func (a *CurrentSongHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
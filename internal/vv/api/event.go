@@ -0,0 +1,310 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event names
+const (
+	EventSongChanged      = "song_changed"
+	EventStateChanged     = "state_changed"
+	EventLibraryUpdated   = "library_updated"
+	EventOutputToggled    = "output_toggled"
+	EventStorageMounted   = "storage_mounted"
+	EventStorageUnmounted = "storage_unmounted"
+)
+
+// Events is a list of all event names.
+var Events = []string{
+	EventSongChanged,
+	EventStateChanged,
+	EventLibraryUpdated,
+	EventOutputToggled,
+	EventStorageMounted,
+	EventStorageUnmounted,
+}
+
+// eventMaxFiles is a max number of file names in library updated event.
+const eventMaxFiles = 100
+
+// Event represents a player or library change.
+type Event struct {
+	Name string      `json:"event"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// EventSong is a data of song changed event.
+type EventSong struct {
+	Song   map[string][]string `json:"song"`
+	Status *Status             `json:"status,omitempty"`
+}
+
+// EventState is a data of state changed event.
+type EventState struct {
+	State    string              `json:"state"`
+	Previous string              `json:"previous"`
+	Song     map[string][]string `json:"song,omitempty"`
+	Status   *Status             `json:"status,omitempty"`
+}
+
+// EventLibrary is a data of library updated event.
+// Added and Removed contain up to 100 file names.
+type EventLibrary struct {
+	Songs        int      `json:"songs"`
+	Added        []string `json:"added"`
+	AddedCount   int      `json:"added_count"`
+	Removed      []string `json:"removed"`
+	RemovedCount int      `json:"removed_count"`
+}
+
+// EventOutput is a data of output toggled event.
+type EventOutput struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// EventStorage is a data of storage mounted and unmounted event.
+type EventStorage struct {
+	Mount string `json:"mount"`
+	URI   string `json:"uri,omitempty"`
+}
+
+// EventHook receives player and library events.
+// Notify is called from single goroutine in order of events and should not block.
+type EventHook interface {
+	Notify(*Event)
+}
+
+// Output is an audio output state for StateHook.
+type Output struct {
+	Name    string `json:"name"`
+	Plugin  string `json:"plugin,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// StateHook receives current player state on each change.
+// Methods are called from api event goroutines and should not block.
+type StateHook interface {
+	UpdateStatus(*Status)
+	UpdateCurrentSong(map[string][]string)
+	UpdateOutputs(map[string]*Output) // outputs by id
+}
+
+// stateOutputs converts outputs api data to StateHook outputs.
+func stateOutputs(outputs map[string]*httpOutput) map[string]*Output {
+	ret := make(map[string]*Output, len(outputs))
+	for id, o := range outputs {
+		ret[id] = &Output{Name: o.Name, Plugin: o.Plugin, Enabled: o.Enabled != nil && *o.Enabled}
+	}
+	return ret
+}
+
+// eventNotifier compares api caches with previous values and notifies events to hooks.
+// First values are used as initial state and do not trigger events.
+// Updates are queued and processed in order by single background goroutine.
+type eventNotifier struct {
+	hooks   []EventHook
+	mu      sync.Mutex
+	closed  bool
+	queue   chan func()
+	done    chan struct{}
+	song    *string
+	state   *string
+	library map[string]struct{}
+	outputs map[string]bool
+	mounts  map[string]string
+}
+
+func newEventNotifier(hooks ...EventHook) *eventNotifier {
+	n := &eventNotifier{
+		hooks: hooks,
+		queue: make(chan func(), 16),
+		done:  make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+func (n *eventNotifier) run() {
+	defer close(n.done)
+	for f := range n.queue {
+		f()
+	}
+}
+
+// do queues f to event goroutine.
+func (n *eventNotifier) do(f func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.queue <- f
+}
+
+// Close waits until queued updates are notified and stops event goroutine.
+func (n *eventNotifier) Close() {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	<-n.done
+}
+
+func (n *eventNotifier) notify(name string, data interface{}) {
+	e := &Event{Name: name, Time: time.Now().UTC(), Data: data}
+	for _, h := range n.hooks {
+		h.Notify(e)
+	}
+}
+
+// updateSong notifies song changed event if song id or file is changed.
+func (n *eventNotifier) updateSong(song map[string][]string, status *Status) {
+	if song == nil {
+		return
+	}
+	n.do(func() {
+		key := songString(song, "Id") + "\x00" + songString(song, "file")
+		if n.song != nil && *n.song != key {
+			n.notify(EventSongChanged, &EventSong{Song: song, Status: status})
+		}
+		n.song = &key
+	})
+}
+
+// updateStatus notifies state changed event if playback state is changed.
+func (n *eventNotifier) updateStatus(status *Status, song map[string][]string) {
+	if status == nil || status.State == nil {
+		return
+	}
+	n.do(func() {
+		state := *status.State
+		if n.state != nil && *n.state != state {
+			n.notify(EventStateChanged, &EventState{State: state, Previous: *n.state, Song: song, Status: status})
+		}
+		n.state = &state
+	})
+}
+
+// updateLibrary notifies library updated event if songs are added or removed.
+func (n *eventNotifier) updateLibrary(songs []map[string][]string) {
+	if songs == nil {
+		return
+	}
+	n.do(func() {
+		files := make(map[string]struct{}, len(songs))
+		for _, s := range songs {
+			files[songString(s, "file")] = struct{}{}
+		}
+		prev := n.library
+		n.library = files
+		if prev == nil {
+			return
+		}
+		data := &EventLibrary{Songs: len(songs), Added: []string{}, Removed: []string{}}
+		for f := range files {
+			if _, ok := prev[f]; !ok {
+				data.AddedCount++
+				data.Added = append(data.Added, f)
+			}
+		}
+		for f := range prev {
+			if _, ok := files[f]; !ok {
+				data.RemovedCount++
+				data.Removed = append(data.Removed, f)
+			}
+		}
+		if data.AddedCount == 0 && data.RemovedCount == 0 {
+			return
+		}
+		sort.Strings(data.Added)
+		sort.Strings(data.Removed)
+		if len(data.Added) > eventMaxFiles {
+			data.Added = data.Added[:eventMaxFiles]
+		}
+		if len(data.Removed) > eventMaxFiles {
+			data.Removed = data.Removed[:eventMaxFiles]
+		}
+		n.notify(EventLibraryUpdated, data)
+	})
+}
+
+// updateOutputs notifies output toggled event for each output which enabled value is changed.
+func (n *eventNotifier) updateOutputs(outputs map[string]*httpOutput) {
+	if outputs == nil {
+		return
+	}
+	n.do(func() {
+		enabled := make(map[string]bool, len(outputs))
+		ids := make([]string, 0, len(outputs))
+		for id, o := range outputs {
+			enabled[id] = o.Enabled != nil && *o.Enabled
+			ids = append(ids, id)
+		}
+		prev := n.outputs
+		n.outputs = enabled
+		if prev == nil {
+			return
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if old, ok := prev[id]; ok && old != enabled[id] {
+				n.notify(EventOutputToggled, &EventOutput{ID: id, Name: outputs[id].Name, Enabled: enabled[id]})
+			}
+		}
+	})
+}
+
+// updateStorage notifies storage mounted and unmounted events.
+func (n *eventNotifier) updateStorage(storage map[string]*httpStorage) {
+	if storage == nil {
+		return
+	}
+	n.do(func() {
+		mounts := make(map[string]string, len(storage))
+		for k, v := range storage {
+			var uri string
+			if v.URI != nil {
+				uri = *v.URI
+			}
+			mounts[k] = uri
+		}
+		prev := n.mounts
+		n.mounts = mounts
+		if prev == nil {
+			return
+		}
+		for _, k := range sortedKeys(prev) {
+			if _, ok := mounts[k]; !ok {
+				n.notify(EventStorageUnmounted, &EventStorage{Mount: k, URI: prev[k]})
+			}
+		}
+		for _, k := range sortedKeys(mounts) {
+			if _, ok := prev[k]; !ok {
+				n.notify(EventStorageMounted, &EventStorage{Mount: k, URI: mounts[k]})
+			}
+		}
+	})
+}
+
+func songString(s map[string][]string, key string) string {
+	if v := s[key]; len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]string) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
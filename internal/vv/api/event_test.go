@@ -0,0 +1,86 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testEventHook []*Event
+
+func (h *testEventHook) Notify(e *Event) { *h = append(*h, e) }
+
+func TestEventNotifier(t *testing.T) {
+	t.Run("song", func(t *testing.T) {
+		hook := &testEventHook{}
+		n := newEventNotifier(hook)
+		n.updateSong(map[string][]string{"Id": {"1"}, "file": {"a.flac"}}, nil)
+		n.updateSong(map[string][]string{"Id": {"1"}, "file": {"a.flac"}, "cover": {"/a.jpg"}}, nil)
+		n.updateSong(map[string][]string{"Id": {"2"}, "file": {"b.flac"}}, &Status{State: stringPtr("play")})
+		n.Close()
+		if len(*hook) != 1 || (*hook)[0].Name != EventSongChanged {
+			t.Fatalf("got %v; want 1 song changed event", *hook)
+		}
+		if got := (*hook)[0].Data.(*EventSong); songString(got.Song, "file") != "b.flac" || *got.Status.State != "play" {
+			t.Errorf("got %+v; want b.flac", got)
+		}
+	})
+	t.Run("state", func(t *testing.T) {
+		hook := &testEventHook{}
+		n := newEventNotifier(hook)
+		n.updateStatus(&Status{State: stringPtr("pause")}, nil)
+		n.updateStatus(&Status{State: stringPtr("pause"), Random: boolPtr(true)}, nil)
+		n.updateStatus(&Status{State: stringPtr("play")}, nil)
+		n.Close()
+		if len(*hook) != 1 {
+			t.Fatalf("got %v; want 1 state changed event", *hook)
+		}
+		if got := (*hook)[0].Data.(*EventState); got.State != "play" || got.Previous != "pause" {
+			t.Errorf("got %+v; want pause to play", got)
+		}
+	})
+	t.Run("library", func(t *testing.T) {
+		hook := &testEventHook{}
+		n := newEventNotifier(hook)
+		n.updateLibrary([]map[string][]string{{"file": {"a"}}, {"file": {"b"}}})
+		n.updateLibrary([]map[string][]string{{"file": {"a"}}, {"file": {"b"}}})
+		n.updateLibrary([]map[string][]string{{"file": {"b"}}, {"file": {"c"}}, {"file": {"d"}}})
+		n.Close()
+		if len(*hook) != 1 {
+			t.Fatalf("got %v; want 1 library updated event", *hook)
+		}
+		want := &EventLibrary{Songs: 3, Added: []string{"c", "d"}, AddedCount: 2, Removed: []string{"a"}, RemovedCount: 1}
+		if got := (*hook)[0].Data; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	})
+	t.Run("outputs", func(t *testing.T) {
+		hook := &testEventHook{}
+		n := newEventNotifier(hook)
+		n.updateOutputs(map[string]*httpOutput{"0": {Name: "alsa", Enabled: boolPtr(true)}, "1": {Name: "http", Enabled: boolPtr(false)}})
+		n.updateOutputs(map[string]*httpOutput{"0": {Name: "alsa", Enabled: boolPtr(false)}, "1": {Name: "http", Enabled: boolPtr(true)}, "2": {Name: "new", Enabled: boolPtr(true)}})
+		n.Close()
+		var got []*EventOutput
+		for _, e := range *hook {
+			got = append(got, e.Data.(*EventOutput))
+		}
+		want := []*EventOutput{{ID: "0", Name: "alsa", Enabled: false}, {ID: "1", Name: "http", Enabled: true}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	})
+	t.Run("storage", func(t *testing.T) {
+		hook := &testEventHook{}
+		n := newEventNotifier(hook)
+		n.updateStorage(map[string]*httpStorage{"": {URI: stringPtr("/music")}, "old": {URI: stringPtr("nfs://old")}})
+		n.updateStorage(map[string]*httpStorage{"": {URI: stringPtr("/music"), Updating: true}, "new": {URI: stringPtr("nfs://new")}})
+		n.Close()
+		var got []string
+		for _, e := range *hook {
+			got = append(got, e.Name+" "+e.Data.(*EventStorage).URI)
+		}
+		want := []string{EventStorageUnmounted + " nfs://old", EventStorageMounted + " nfs://new"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v; want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// fadeMinInterval is a minimum interval to change volume while fading.
+const fadeMinInterval = 100 * time.Millisecond
+
+// fadeVolume changes volume from from to to linearly over d.
+func fadeVolume(ctx context.Context, setVol func(context.Context, int) error, from, to int, d time.Duration) error {
+	steps := to - from
+	if steps < 0 {
+		steps = -steps
+	}
+	if steps == 0 || d <= 0 {
+		return setVol(ctx, to)
+	}
+	interval := d / time.Duration(steps)
+	if interval < fadeMinInterval {
+		interval = fadeMinInterval
+		if steps = int(d / interval); steps == 0 {
+			steps = 1
+		}
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if err := setVol(ctx, from+(to-from)*i/steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,58 +3,96 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/metrics"
 	"github.com/meiraka/vv/internal/mpd"
 	"github.com/meiraka/vv/internal/songs"
 )
 
 const (
 	pathAPIMusicStatus               = "/api/music"
+	pathAPIMusicHistory              = "/api/music/history"
+	pathAPIMusicHistoryCounts        = "/api/music/history/counts"
+	pathAPIMusicHistoryRecent        = "/api/music/history/recent"
 	pathAPIMusicImages               = "/api/music/images"
 	pathAPIMusicLibrary              = "/api/music/library"
 	pathAPIMusicLibrarySongs         = "/api/music/library/songs"
 	pathAPIMusicOutputs              = "/api/music/outputs"
 	pathAPIMusicOutputsStream        = "/api/music/outputs/stream"
+	pathAPIMusicOutputsListeners     = "/api/music/outputs/stream/listeners"
+	pathAPIMusicOutputsHLS           = "/api/music/outputs/hls"
+	pathAPIMusicOutputsRecordings    = "/api/music/outputs/stream/recordings"
 	pathAPIMusicPlaylist             = "/api/music/playlist"
+	pathAPIMusicPlaylistSnapshots    = "/api/music/playlist/snapshots"
 	pathAPIMusicPlaylistSongs        = "/api/music/playlist/songs"
 	pathAPIMusicPlaylistSongsCurrent = "/api/music/playlist/songs/current"
+	pathAPIMusicSchedule             = "/api/music/schedule"
 	pathAPIMusicStats                = "/api/music/stats"
 	pathAPIMusicStorage              = "/api/music/storage"
 	pathAPIMusicStorageNeighbors     = "/api/music/storage/neighbors"
 	pathAPIVersion                   = "/api/version"
+	pathAPIAudit                     = "/api/audit"
 )
 
 // Config is options for api Handler.
 type Config struct {
-	AppVersion        string            // app version string for info
-	BackgroundTimeout time.Duration     // timeout for background mpd cache updating jobs
-	AudioProxy        map[string]string // audio device - mpd http server addr pair to proxy
-	skipInit          bool              // do not initialize mpd cache(for test)
+	AppVersion        string                               // app version string for info
+	BackgroundTimeout time.Duration                        // timeout for background mpd cache updating jobs
+	AudioProxy        map[string]string                    // audio device - mpd http server addr pair to proxy
+	RecordDirectory   string                               // directory to record proxied audio streams; disables recording if empty
+	AllowedOrigins    []string                             // cross origins(scheme://host[:port]) to allow browser requests and websocket
+	CacheDirectory    string                               // directory to store api cache snapshot; initializes mpd cache in background if not empty
+	HistoryDB         string                               // bbolt db path to record play history; disables play history if empty
+	AuditDB           string                               // bbolt db path to record mutating api requests; disables audit log if empty
+	RequestUser       func(context.Context) (string, bool) // returns user name of request to record in audit log
+	Scrobblers        []Scrobbler                          // receives song playback events
+	EventHooks        []EventHook                          // receives player and library events
+	StateHooks        []StateHook                          // receives current player state
+	skipInit          bool                                 // do not initialize mpd cache(for test)
+	RPCMiddleware     func(http.Handler) http.Handler      // wraps websocket rpc handler(e.g. authentication)
+	AllowAlarmOutputs func(*http.Request) bool             // reports whether request can switch outputs by alarm; allows all requests if nil
 	ImageProviders    []ImageProvider
+	Metrics           *metrics.Registry // registers api metrics; metrics are discarded if nil
 	Logger            Logger
 }
 
 // Handler implements http.Handler for vv json api.
 type Handler struct {
 	apiMusic                     *StatusHandler
+	apiMusicHistory              *HistoryHandler
 	apiMusicImages               *ImagesHandler
 	apiMusicLibrary              *LibraryHandler
 	apiMusicLibrarySongs         *LibrarySongsHandler
 	apiMusicOutputs              *OutputsHandler
 	apiMusicOutputsStream        *OutputsStreamHandler
 	apiMusicPlaylist             *PlaylistHandler
+	apiMusicPlaylistSnapshots    *PlaylistSnapshotsHandler
 	apiMusicPlaylistSongs        *PlaylistSongsHandler
 	apiMusicPlaylistSongsCurrent *CurrentSongHandler
+	apiMusicSchedule             *ScheduleHandler
 	apiMusicStats                *StatsHandler
 	apiMusicStorage              *StorageHandler
 	apiMusicStorageNeighbors     *NeighborsHandler
 	apiVersion                   *VersionHandler
+	apiAudit                     *AuditHandler
+	playTracker                  *playTracker
+	events                       *eventNotifier
+	snapshot                     *snapshot
+	csrf                         *csrf
+	metrics                      *handlerMetrics
+	loaded                       atomic.Bool
+	caches                       map[string]*cache
 	songHooks                    []func(s map[string][]string) map[string][]string
 	songsHooks                   []func(s []map[string][]string) []map[string][]string
 	closable                     []interface{ Close() }
@@ -73,11 +111,18 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 	if c.Logger == nil {
 		c.Logger = log.New(io.Discard)
 	}
+	if c.Metrics == nil {
+		c.Metrics = metrics.NewRegistry()
+	}
 	h := &Handler{}
 	var err error
-	if h.apiMusic, err = NewStatusHandler(cl); err != nil {
+	if h.csrf, err = newCSRF(c.AllowedOrigins); err != nil {
+		return nil, err
+	}
+	if h.apiMusic, err = NewStatusHandler(cl, c.Logger); err != nil {
 		return nil, err
 	}
+	h.apiMusic.CheckOrigin(h.csrf.CheckOrigin)
 	h.closable = append(h.closable, h.apiMusic)
 
 	if h.apiMusicImages, err = NewImagesHandler(c.ImageProviders, c.Logger); err != nil {
@@ -106,7 +151,12 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 	if h.apiMusicOutputsStream, err = NewOutputsStreamHandler(c.AudioProxy, c.Logger); err != nil {
 		return nil, err
 	}
+	if len(c.RecordDirectory) != 0 {
+		h.apiMusicOutputsStream.SetRecordDirectory(c.RecordDirectory)
+	}
+	h.closable = append(h.closable, h.apiMusicOutputsStream)
 	h.stoppable = append(h.stoppable, h.apiMusicOutputsStream)
+	h.shutdownable = append(h.shutdownable, h.apiMusicOutputsStream)
 
 	if h.apiMusicPlaylist, err = NewPlaylistHandler(cl, c); err != nil {
 		return nil, err
@@ -114,6 +164,13 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 	h.closable = append(h.closable, h.apiMusicPlaylist)
 	h.shutdownable = append(h.shutdownable, h.apiMusicPlaylist)
 
+	if h.apiMusicPlaylistSnapshots, err = NewPlaylistSnapshotsHandler(cl); err != nil {
+		return nil, err
+	}
+	h.apiMusicPlaylist.SetSnapshotHook(h.apiMusicPlaylistSnapshots.Save)
+	h.apiMusicPlaylistSnapshots.SetPlaylistLockHook(h.apiMusicPlaylist.Exclusive)
+	h.closable = append(h.closable, h.apiMusicPlaylistSnapshots)
+
 	if h.apiMusicPlaylistSongs, err = NewPlaylistSongsHandler(cl, h.songsHook); err != nil {
 		return nil, err
 	}
@@ -124,6 +181,16 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 	}
 	h.closable = append(h.closable, h.apiMusicPlaylistSongsCurrent)
 
+	var schedulePath string
+	if len(c.CacheDirectory) != 0 {
+		schedulePath = filepath.Join(c.CacheDirectory, "schedule.json")
+	}
+	if h.apiMusicSchedule, err = NewScheduleHandler(cl, schedulePath, c); err != nil {
+		return nil, err
+	}
+	h.apiMusicSchedule.SetViewHook(h.apiMusicPlaylist.Sort)
+	h.closable = append(h.closable, h.apiMusicSchedule)
+
 	if h.apiMusicStats, err = NewStatsHandler(cl); err != nil {
 		return nil, err
 	}
@@ -138,6 +205,27 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 	}
 	h.closable = append(h.closable, h.apiMusicStorageNeighbors)
 
+	scrobblers := c.Scrobblers
+	if len(c.HistoryDB) != 0 {
+		if h.apiMusicHistory, err = NewHistoryHandler(c.HistoryDB, c.Logger); err != nil {
+			return nil, err
+		}
+		scrobblers = append([]Scrobbler{h.apiMusicHistory}, scrobblers...)
+	}
+	if len(scrobblers) != 0 {
+		h.playTracker = newPlayTracker(scrobblers...)
+		// close tracker before history to record current song
+		h.closable = append(h.closable, h.playTracker)
+	}
+	if h.apiMusicHistory != nil {
+		h.closable = append(h.closable, h.apiMusicHistory)
+	}
+
+	if len(c.EventHooks) != 0 {
+		h.events = newEventNotifier(c.EventHooks...)
+		h.closable = append(h.closable, h.events)
+	}
+
 	if h.apiVersion, err = NewVersionHandler(cl, c.AppVersion); err != nil {
 		return nil, err
 	}
@@ -147,6 +235,42 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 	}
 	// remove changed event for test stability
 	clearChan(h.apiVersion.Changed())
+	if len(c.AuditDB) != 0 {
+		if h.apiAudit, err = NewAuditHandler(c.AuditDB, c.RequestUser, c.Logger); err != nil {
+			return nil, err
+		}
+		h.closable = append(h.closable, h.apiAudit)
+	}
+	h.caches = map[string]*cache{
+		pathAPIMusicStatus:               h.apiMusic.cache,
+		pathAPIMusicImages:               h.apiMusicImages.cache,
+		pathAPIMusicLibrary:              h.apiMusicLibrary.cache,
+		pathAPIMusicLibrarySongs:         h.apiMusicLibrarySongs.cache,
+		pathAPIMusicOutputs:              h.apiMusicOutputs.cache,
+		pathAPIMusicOutputsListeners:     h.apiMusicOutputsStream.cache,
+		pathAPIMusicOutputsRecordings:    h.apiMusicOutputsStream.recordings,
+		pathAPIMusicPlaylist:             h.apiMusicPlaylist.cache,
+		pathAPIMusicPlaylistSnapshots:    h.apiMusicPlaylistSnapshots.cache,
+		pathAPIMusicPlaylistSongs:        h.apiMusicPlaylistSongs.cache,
+		pathAPIMusicPlaylistSongsCurrent: h.apiMusicPlaylistSongsCurrent.cache,
+		pathAPIMusicSchedule:             h.apiMusicSchedule.cache,
+		pathAPIMusicStats:                h.apiMusicStats.cache,
+		pathAPIMusicStorage:              h.apiMusicStorage.cache,
+		pathAPIMusicStorageNeighbors:     h.apiMusicStorageNeighbors.cache,
+		pathAPIVersion:                   h.apiVersion.cache,
+	}
+	h.metrics = h.newHandlerMetrics(c.Metrics)
+	var rpc http.Handler = http.HandlerFunc(h.serveRPC)
+	if c.RPCMiddleware != nil {
+		rpc = c.RPCMiddleware(rpc)
+	}
+	h.apiMusic.HandleRPC(rpc)
+	if len(c.CacheDirectory) != 0 {
+		if h.snapshot, err = newSnapshot(c.CacheDirectory); err != nil {
+			return nil, err
+		}
+		h.restoreSnapshot(c)
+	}
 	if err := h.hookEvent(ctx, w, c); err != nil {
 		return nil, err
 	}
@@ -155,6 +279,27 @@ func NewHandler(ctx context.Context, cl *mpd.Client, w *mpd.Watcher, c *Config)
 
 // ServeHTTP serves vv json api.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status, err := h.csrf.Check(r); err != nil {
+		writeHTTPError(w, status, err)
+		return
+	}
+	if err := h.csrf.SetToken(w, r); err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.serve(w, r)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
+	defer h.metrics.observe(r, time.Now())
+	if h.apiAudit != nil && r.Method == http.MethodPost && isMutatingPath(r.URL.Path) {
+		h.apiAudit.serve(w, r, h.caches[r.URL.Path], http.HandlerFunc(h.route))
+		return
+	}
+	h.route(w, r)
+}
+
+func (h *Handler) route(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case pathAPIVersion:
 		h.apiVersion.ServeHTTP(w, r)
@@ -164,10 +309,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.apiMusicStats.ServeHTTP(w, r)
 	case pathAPIMusicPlaylist:
 		h.apiMusicPlaylist.ServeHTTP(w, r)
+	case pathAPIMusicPlaylistSnapshots:
+		h.apiMusicPlaylistSnapshots.ServeHTTP(w, r)
 	case pathAPIMusicPlaylistSongs:
 		h.apiMusicPlaylistSongs.ServeHTTP(w, r)
 	case pathAPIMusicPlaylistSongsCurrent:
 		h.apiMusicPlaylistSongsCurrent.ServeHTTP(w, r)
+	case pathAPIMusicSchedule:
+		h.apiMusicSchedule.ServeHTTP(w, r)
 	case pathAPIMusicLibrary:
 		h.apiMusicLibrary.ServeHTTP(w, r)
 	case pathAPIMusicLibrarySongs:
@@ -176,17 +325,54 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.apiMusicOutputs.ServeHTTP(w, r)
 	case pathAPIMusicOutputsStream:
 		h.apiMusicOutputsStream.ServeHTTP(w, r)
+	case pathAPIMusicOutputsListeners:
+		h.apiMusicOutputsStream.ServeListeners(w, r)
+	case pathAPIMusicOutputsHLS:
+		h.apiMusicOutputsStream.ServeHLS(w, r)
+	case pathAPIMusicOutputsRecordings:
+		h.apiMusicOutputsStream.ServeRecordings(w, r)
 	case pathAPIMusicImages:
 		h.apiMusicImages.ServeHTTP(w, r)
+	case pathAPIMusicHistory, pathAPIMusicHistoryCounts, pathAPIMusicHistoryRecent:
+		if h.apiMusicHistory == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.apiMusicHistory.ServeHTTP(w, r)
 	case pathAPIMusicStorage:
 		h.apiMusicStorage.ServeHTTP(w, r)
 	case pathAPIMusicStorageNeighbors:
 		h.apiMusicStorageNeighbors.ServeHTTP(w, r)
+	case pathAPIAudit:
+		if h.apiAudit == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.apiAudit.ServeHTTP(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
+// serveRPC serves websocket rpc request for state changing apis.
+// rpc requests skip csrf token check because websocket origin is checked at upgrade.
+func (h *Handler) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if !isMutatingPath(r.URL.Path) {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("rpc method not found: %s", r.URL.Path))
+		return
+	}
+	h.serve(w, r)
+}
+
+// isMutatingPath reports whether path accepts state changing POST request.
+func isMutatingPath(path string) bool {
+	switch path {
+	case pathAPIMusicStatus, pathAPIMusicPlaylist, pathAPIMusicPlaylistSnapshots, pathAPIMusicSchedule, pathAPIMusicLibrary, pathAPIMusicOutputs, pathAPIMusicOutputsRecordings, pathAPIMusicImages, pathAPIMusicStorage:
+		return true
+	}
+	return false
+}
+
 // Stop stops handlers which cannot stop by (*http.Server) Shutdown.
 func (h *Handler) Stop() {
 	for i := range h.stoppable {
@@ -215,6 +401,43 @@ func (h *Handler) Shutdown(ctx context.Context) error {
 	return <-errs
 }
 
+// restoreSnapshot sets api cache snapshot and marks api caches as stale.
+func (h *Handler) restoreSnapshot(c *Config) {
+	for _, v := range []struct {
+		name    string
+		restore func([]byte) error
+	}{
+		{snapshotLibrarySongs, h.apiMusicLibrarySongs.restore},
+		{snapshotPlaylistSongs, h.apiMusicPlaylistSongs.restore},
+		{snapshotOutputs, h.apiMusicOutputs.restore},
+	} {
+		b, err := h.snapshot.Load(v.name)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				c.Logger.Errorw("vv/api: failed to load snapshot", "name", v.name, "error", err)
+			}
+			continue
+		}
+		if err := v.restore(b); err != nil {
+			c.Logger.Errorw("vv/api: failed to restore snapshot", "name", v.name, "error", err)
+		}
+	}
+	if err := h.apiVersion.SetStale(true); err != nil {
+		c.Logger.Errorw("vv/api: failed to update version", "error", err)
+	}
+}
+
+// saveSnapshot writes api cache snapshot.
+func (h *Handler) saveSnapshot(c *Config, name string, cache *cache) {
+	if h.snapshot == nil {
+		return
+	}
+	b, _ := cache.get()
+	if err := h.snapshot.Save(name, b); err != nil {
+		c.Logger.Errorw("vv/api: failed to save snapshot", "name", name, "error", err)
+	}
+}
+
 func clearChan(c <-chan struct{}) {
 	for {
 		select {
@@ -230,13 +453,22 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 		for range h.apiMusic.Changed() {
 			h.apiMusic.BroadCast(pathAPIMusicStatus)
 			if err := h.apiMusicLibrary.UpdateStatus(h.apiMusic.Cache().Updating); err != nil {
-				c.Logger.Printf("vv/api: %v", err)
+				c.Logger.Errorw("vv/api: failed to apply status", "error", err)
 			}
-			if pos := h.apiMusic.Cache().Song; pos != nil {
+			status := h.apiMusic.Cache()
+			if pos := status.Song; pos != nil {
 				if err := h.apiMusicPlaylist.UpdateCurrent(*pos); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to apply status", "error", err)
 				}
 			}
+			h.apiMusicPlaylist.UpdatePlaying(status.State != nil && *status.State == "play")
+			h.apiMusicSchedule.UpdateStatus(status)
+			if h.events != nil {
+				h.events.updateStatus(status, h.apiMusicPlaylistSongsCurrent.Cache())
+			}
+			for _, hook := range c.StateHooks {
+				hook.UpdateStatus(status)
+			}
 		}
 	}()
 	go func() {
@@ -245,10 +477,10 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 			if !updating {
 				ctx, cancel := context.WithTimeout(context.Background(), c.BackgroundTimeout)
 				if err := h.apiMusicPlaylistSongsCurrent.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to update covers", "error", err)
 				}
 				if err := h.apiMusicLibrarySongs.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to update covers", "error", err)
 				}
 				cancel()
 			}
@@ -263,11 +495,35 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 		for range h.apiMusicLibrarySongs.Changed() {
 			h.apiMusic.BroadCast(pathAPIMusicLibrarySongs)
 			h.apiMusicPlaylist.UpdateLibrarySongs(h.apiMusicLibrarySongs.Cache())
+			h.saveSnapshot(c, snapshotLibrarySongs, h.apiMusicLibrarySongs.cache)
+			if h.events != nil {
+				h.events.updateLibrary(h.apiMusicLibrarySongs.Cache())
+			}
 		}
 	}()
 	go func() {
 		for range h.apiMusicOutputs.Changed() {
 			h.apiMusic.BroadCast(pathAPIMusicOutputs)
+			h.saveSnapshot(c, snapshotOutputs, h.apiMusicOutputs.cache)
+			if h.events != nil {
+				h.events.updateOutputs(h.apiMusicOutputs.outputs())
+			}
+			if len(c.StateHooks) != 0 {
+				outputs := stateOutputs(h.apiMusicOutputs.outputs())
+				for _, hook := range c.StateHooks {
+					hook.UpdateOutputs(outputs)
+				}
+			}
+		}
+	}()
+	go func() {
+		for range h.apiMusicOutputsStream.Changed() {
+			h.apiMusic.BroadCast(pathAPIMusicOutputsListeners)
+		}
+	}()
+	go func() {
+		for range h.apiMusicOutputsStream.RecordingsChanged() {
+			h.apiMusic.BroadCast(pathAPIMusicOutputsRecordings)
 		}
 	}()
 	go func() {
@@ -275,15 +531,35 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 			h.apiMusic.BroadCast(pathAPIMusicPlaylist)
 		}
 	}()
+	go func() {
+		for range h.apiMusicPlaylistSnapshots.Changed() {
+			h.apiMusic.BroadCast(pathAPIMusicPlaylistSnapshots)
+		}
+	}()
 	go func() {
 		for range h.apiMusicPlaylistSongs.Changed() {
 			h.apiMusic.BroadCast(pathAPIMusicPlaylistSongs)
 			h.apiMusicPlaylist.UpdatePlaylistSongs(h.apiMusicPlaylistSongs.Cache())
+			h.apiMusicPlaylistSnapshots.UpdatePlaylistSongs(h.apiMusicPlaylistSongs.Cache())
+			h.apiMusicSchedule.UpdatePlaylistSongs(h.apiMusicPlaylistSongs.Cache())
+			h.saveSnapshot(c, snapshotPlaylistSongs, h.apiMusicPlaylistSongs.cache)
 		}
 	}()
 	go func() {
 		for range h.apiMusicPlaylistSongsCurrent.Changed() {
 			h.apiMusic.BroadCast(pathAPIMusicPlaylistSongsCurrent)
+			h.apiMusicOutputsStream.UpdateCurrentSong(h.apiMusicPlaylistSongsCurrent.Cache())
+			if h.events != nil {
+				h.events.updateSong(h.apiMusicPlaylistSongsCurrent.Cache(), h.apiMusic.Cache())
+			}
+			for _, hook := range c.StateHooks {
+				hook.UpdateCurrentSong(h.apiMusicPlaylistSongsCurrent.Cache())
+			}
+		}
+	}()
+	go func() {
+		for range h.apiMusicSchedule.Changed() {
+			h.apiMusic.BroadCast(pathAPIMusicSchedule)
 		}
 	}()
 	go func() {
@@ -294,6 +570,9 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 	go func() {
 		for range h.apiMusicStorage.Changed() {
 			h.apiMusic.BroadCast(pathAPIMusicStorage)
+			if h.events != nil {
+				h.events.updateStorage(h.apiMusicStorage.storage())
+			}
 		}
 	}()
 	go func() {
@@ -306,6 +585,20 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 			h.apiMusic.BroadCast(pathAPIVersion)
 		}
 	}()
+	if h.apiMusicHistory != nil {
+		go func() {
+			for range h.apiMusicHistory.Changed() {
+				h.apiMusic.BroadCast(pathAPIMusicHistory)
+			}
+		}()
+	}
+	if h.apiAudit != nil {
+		go func() {
+			for range h.apiAudit.Changed() {
+				h.apiMusic.BroadCast(pathAPIAudit)
+			}
+		}()
+	}
 
 	all := []func(context.Context) error{
 		h.apiMusicLibrarySongs.Update,
@@ -323,66 +616,85 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 			switch e {
 			case "reconnecting":
 				if err := h.apiVersion.UpdateNoMPD(); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
+				}
+				if h.snapshot != nil {
+					if err := h.apiVersion.SetStale(true); err != nil {
+						c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
+					}
 				}
+				h.updatePlay(false)
 			case "reconnect":
+				h.metrics.reconnects.Inc()
 				if err := h.apiVersion.Update(); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
+				updated := true
 				for _, v := range all {
 					if err := v(ctx); err != nil {
-						c.Logger.Printf("vv/api: %v", err)
+						updated = false
+						c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
+					}
+				}
+				if updated {
+					h.loaded.Store(true)
+				}
+				if h.snapshot != nil && updated {
+					if err := h.apiVersion.SetStale(false); err != nil {
+						c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 					}
 				}
+				h.updatePlay(updated)
 			case "database":
 				if err := h.apiMusicLibrarySongs.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 				if err := h.apiMusic.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 				// h.apiMusicPlaylistSongsCurrent.Update(ctx) // "currentsong" metadata did not updated until song changes
 				// h.apiMusicPlaylistSongs.Update(ctx) // client does not use this api
 				if err := h.apiMusicStats.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "playlist":
 				if err := h.apiMusicPlaylistSongs.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "player":
 				if err := h.apiMusic.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 				if err := h.apiMusicPlaylistSongsCurrent.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
+				h.updatePlay(true)
 				if err := h.apiMusicStats.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "mixer":
 				if err := h.apiMusic.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "options":
 				if err := h.apiMusic.UpdateOptions(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "update":
 				if err := h.apiMusic.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "output":
 				if err := h.apiMusicOutputs.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "mount":
 				if err := h.apiMusicStorage.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			case "neighbor":
 				if err := h.apiMusicStorageNeighbors.Update(ctx); err != nil {
-					c.Logger.Printf("vv/api: %v", err)
+					c.Logger.Errorw("vv/api: failed to handle mpd event", "event", e, "error", err)
 				}
 			default:
 			}
@@ -395,22 +707,63 @@ func (h *Handler) hookEvent(ctx context.Context, w *mpd.Watcher, c *Config) erro
 	if c.skipInit {
 		return nil
 	}
+	if h.snapshot != nil {
+		// serve snapshot while updating cache
+		go func() {
+			for i := range all {
+				ctx, cancel := context.WithTimeout(context.Background(), c.BackgroundTimeout)
+				err := all[i](ctx)
+				cancel()
+				if err != nil {
+					// retry by reconnect event
+					c.Logger.Errorw("vv/api: failed to initialize cache", "error", err)
+					return
+				}
+			}
+			h.loaded.Store(true)
+			if err := h.apiVersion.SetStale(false); err != nil {
+				c.Logger.Errorw("vv/api: failed to initialize cache", "error", err)
+			}
+		}()
+		return nil
+	}
 	for i := range all {
 		if err := all[i](ctx); err != nil {
 			return err
 		}
 	}
+	h.loaded.Store(true)
 	// update handler cache before return.
 	// for test stability only
-	if pos := h.apiMusic.Cache().Song; pos != nil {
+	status := h.apiMusic.Cache()
+	if pos := status.Song; pos != nil {
 		if err := h.apiMusicPlaylist.UpdateCurrent(*pos); err != nil {
 			return err
 		}
 		clearChan(h.apiMusicPlaylist.Changed())
 	}
+	h.apiMusicPlaylist.UpdatePlaying(status.State != nil && *status.State == "play")
 	return nil
 }
 
+// Loaded reports whether api caches are loaded from mpd at least once.
+func (h *Handler) Loaded() bool {
+	return h.loaded.Load()
+}
+
+// updatePlay updates play tracker by current status.
+// tracker stops current song if connected is false.
+func (h *Handler) updatePlay(connected bool) {
+	if h.playTracker == nil {
+		return
+	}
+	if !connected {
+		h.playTracker.Update(nil, nil, nil)
+		return
+	}
+	h.playTracker.Update(h.apiMusic.Cache(), h.apiMusicPlaylistSongsCurrent.Cache(), h.apiMusicOutputs.Enabled())
+}
+
 func (h *Handler) songHook(s map[string][]string) map[string][]string {
 	s = songs.AddTags(s)
 	for i := range h.songHooks {
@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"sort"
@@ -776,13 +778,12 @@ func TestHandler(t *testing.T) {
 					method: http.MethodPost, path: "/api/music/playlist", body: strings.NewReader(`{"current":0,"sort":["file"],"filters":[]}`),
 					want: map[int]string{http.StatusAccepted: `{"current":1}`},
 					initFunc: func(ctx context.Context, main *mpdtest.Server, sub *mpdtest.Server) {
+						main.Expect(ctx, &mpdtest.WR{Read: "status\n", Write: "volume: -1\nsong: 1\nelapsed: 1.1\nrepeat: 0\nrandom: 0\nsingle: 0\nconsume: 0\nstate: pause\nOK\n"})
 						main.Expect(ctx, &mpdtest.WR{Read: "command_list_ok_begin\n"})
-						main.Expect(ctx, &mpdtest.WR{Read: "clear\n"})
-						main.Expect(ctx, &mpdtest.WR{Read: "add \"bar\"\n"})
-						main.Expect(ctx, &mpdtest.WR{Read: "add \"baz\"\n"})
-						main.Expect(ctx, &mpdtest.WR{Read: "add \"foo\"\n"})
+						main.Expect(ctx, &mpdtest.WR{Read: "addid \"baz\" 2\n"})
+						main.Expect(ctx, &mpdtest.WR{Read: "move 0 2\n"})
 						main.Expect(ctx, &mpdtest.WR{Read: "play 0\n"})
-						main.Expect(ctx, &mpdtest.WR{Read: "command_list_end\n", Write: "list_OK\nlist_OK\nlist_OK\nlist_OK\nlist_OK\nOK\n"})
+						main.Expect(ctx, &mpdtest.WR{Read: "command_list_end\n", Write: "Id: 3\nlist_OK\nlist_OK\nlist_OK\nOK\n"})
 						sub.Expect(ctx, &mpdtest.WR{Read: "idle\n", Write: "changed: playlist\nOK\n"})
 						main.Expect(ctx, &mpdtest.WR{Read: "playlistinfo\n", Write: "file: bar\nfile: baz\nfile: foo\nOK\n"})
 						sub.Expect(ctx, &mpdtest.WR{Read: "idle\n", Write: "changed: player\nOK\n"})
@@ -790,12 +791,13 @@ func TestHandler(t *testing.T) {
 						main.Expect(ctx, &mpdtest.WR{Read: "currentsong\n", Write: "file: bar\nPos: 0\nOK\n"})
 						main.Expect(ctx, &mpdtest.WR{Read: "stats\n", Write: "uptime: 667505\nplaytime: 0\nartists: 835\nalbums: 528\nsongs: 5715\ndb_playtime: 1475220\ndb_update: 1560656023\nOK\n"})
 					},
-					postWebSocket: []string{"/api/music/playlist/songs", "/api/music", "/api/music/playlist", "/api/music/playlist/songs/current", "/api/music/stats"},
+					postWebSocket: []string{"/api/music/playlist/snapshots", "/api/music/playlist/songs", "/api/music", "/api/music/playlist", "/api/music/playlist/songs/current", "/api/music/stats"},
 				},
 				{
 					method: http.MethodGet, path: "/api/music/playlist",
 					want: map[int]string{http.StatusOK: `{"current":0,"sort":["file"]}`},
 				},
+
 				{ // update current song only
 					method: http.MethodPost, path: "/api/music/playlist", body: strings.NewReader(`{"current":1,"sort":["file"],"filters":[]}`),
 					want: map[int]string{
@@ -974,6 +976,9 @@ func TestHandler(t *testing.T) {
 					if err != nil {
 						t.Fatalf("failed to create reuqest: %v", err)
 					}
+					if test.method == http.MethodPost {
+						req.Header.Set("Content-Type", "application/json")
+					}
 					resp, err := testHTTPClient.Do(req)
 					if err != nil {
 						t.Fatalf("failed to request: %v", err)
@@ -1150,6 +1155,105 @@ func TestAPIOutputStreamHandler(t *testing.T) {
 	}()
 }
 
+func TestHandlerSnapshot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	main := mpdtest.NewServer("OK MPD 0.19")
+	defer main.Close()
+	sub := mpdtest.NewServer("OK MPD 0.19")
+	defer sub.Close()
+	c, err := mpd.Dial("tcp", main.URL,
+		&mpd.ClientOptions{Timeout: testTimeout, ReconnectionInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial got error %v; want nil", err)
+	}
+	defer func() {
+		if err := c.Close(ctx); err != nil {
+			t.Errorf("mpd.Client.Close got err %v; want nil", err)
+		}
+	}()
+	wl, err := mpd.NewWatcher("tcp", sub.URL,
+		&mpd.WatcherOptions{Timeout: testTimeout, ReconnectionInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial got error %v; want nil", err)
+	}
+	defer func() {
+		if err := wl.Close(ctx); err != nil {
+			t.Errorf("mpd.Watcher.Close got err %v; want nil", err)
+		}
+	}()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "library_songs.json"), []byte(`[{"file":["old"]}]`), 0666); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	h, err := NewHandler(ctx, c, wl, &Config{AppVersion: "0.0.0", BackgroundTimeout: time.Second, CacheDirectory: dir})
+	if err != nil {
+		t.Fatalf("failed to initialize api handler: %v", err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	get := func(path string) string {
+		t.Helper()
+		resp, err := testHTTPClient.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("failed to request: %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		return string(b)
+	}
+	if got, want := get("/api/music/library/songs"), `[{"file":["old"]}]`; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	version := fmt.Sprintf(`{"app":"0.0.0","go":"%s","mpd":"0.19"`, fmt.Sprintf("%s %s %s", runtime.Version(), runtime.GOOS, runtime.GOARCH))
+	if got, want := get("/api/version"), version+`,"stale":true}`; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	main.Expect(ctx, &mpdtest.WR{Read: "listallinfo \"/\"\n", Write: "file: new\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "playlistinfo\n", Write: "file: new\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "replay_gain_status\n", Write: "replay_gain_mode: off\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "status\n", Write: "volume: -1\nsong: 0\nelapsed: 1.1\nrepeat: 0\nrandom: 0\nsingle: 0\nconsume: 0\nstate: pause\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "currentsong\n", Write: "file: new\nPos: 0\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "outputs\n", Write: "outputid: 0\noutputname: My ALSA Device\noutputenabled: 0\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "stats\n", Write: "uptime: 667505\nplaytime: 0\nartists: 835\nalbums: 528\nsongs: 5715\ndb_playtime: 1475220\ndb_update: 1560656023\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "listmounts\n", Write: "mount: \nstorage: /home/foo/music\nOK\n"})
+	main.Expect(ctx, &mpdtest.WR{Read: "listneighbors\n", Write: "OK\n"})
+	for {
+		if get("/api/version") == version+"}" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("stale flag is not cleared: %v", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	want := `[{"DiscNumber":["0001"],"Length":["00:00"],"TrackNumber":["0000"],"file":["new"]}]`
+	if got := get("/api/music/library/songs"); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	for {
+		if b, _ := os.ReadFile(filepath.Join(dir, "library_songs.json")); string(b) == want {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("snapshot is not updated: %v", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := h.Shutdown(ctx); err != nil {
+		t.Errorf("Handler.Shutdown got err %v; want nil", err)
+	}
+	go func() {
+		sub.Expect(ctx, &mpdtest.WR{Read: "idle\n", Write: ""})
+		sub.Expect(ctx, &mpdtest.WR{Read: "noidle\n", Write: "OK\n"})
+	}()
+}
+
 func sortUniq(s []string) []string {
 	set := map[string]struct{}{}
 	for i := range s {
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/meiraka/vv/internal/mpd"
+)
+
+const (
+	// PathHealthz is a liveness probe path.
+	PathHealthz = "/healthz"
+	// PathReadyz is a readiness probe path.
+	PathReadyz = "/readyz"
+)
+
+type httpHealth struct {
+	Status string `json:"status"`
+}
+
+type httpReady struct {
+	Status      string         `json:"status"`
+	MPD         *httpMPDHealth `json:"mpd"`
+	Watcher     *httpMPDHealth `json:"watcher"`
+	CacheLoaded bool           `json:"cache_loaded"`
+}
+
+type httpMPDHealth struct {
+	Connected        bool       `json:"connected"`
+	LastError        string     `json:"last_error,omitempty"`
+	LastSuccess      *time.Time `json:"last_success,omitempty"`
+	SinceLastSuccess *float64   `json:"since_last_success,omitempty"` // seconds
+}
+
+// MPDHealth represents mpd connection for HealthHandler.
+type MPDHealth interface {
+	Health() mpd.Health
+}
+
+// HealthHandler serves liveness and readiness probes.
+type HealthHandler struct {
+	mpd     MPDHealth
+	watcher MPDHealth
+	loaded  func() bool
+}
+
+// NewHealthHandler creates HealthHandler. loaded reports whether initial api cache loading finished.
+func NewHealthHandler(mpd, watcher MPDHealth, loaded func() bool) (*HealthHandler, error) {
+	return &HealthHandler{
+		mpd:     mpd,
+		watcher: watcher,
+		loaded:  loaded,
+	}, nil
+}
+
+// ServeHTTP responses process liveness for PathHealthz and mpd connectivity for PathReadyz.
+// PathReadyz responses 503 if mpd is not connected or api cache is not loaded.
+func (a *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	switch r.URL.Path {
+	case PathHealthz:
+		writeHealthJSON(w, http.StatusOK, &httpHealth{Status: "ok"})
+	case PathReadyz:
+		now := time.Now()
+		ret := &httpReady{
+			Status:      "ok",
+			MPD:         newHTTPMPDHealth(a.mpd.Health(), now),
+			Watcher:     newHTTPMPDHealth(a.watcher.Health(), now),
+			CacheLoaded: a.loaded(),
+		}
+		status := http.StatusOK
+		if !ret.MPD.Connected || !ret.Watcher.Connected || !ret.CacheLoaded {
+			ret.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+		writeHealthJSON(w, status, ret)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newHTTPMPDHealth(h mpd.Health, now time.Time) *httpMPDHealth {
+	ret := &httpMPDHealth{Connected: h.Connected}
+	if h.LastError != nil {
+		ret.LastError = h.LastError.Error()
+	}
+	if !h.LastSuccess.IsZero() {
+		t := h.LastSuccess.UTC()
+		since := now.Sub(h.LastSuccess).Seconds()
+		ret.LastSuccess = &t
+		ret.SinceLastSuccess = &since
+	}
+	return ret
+}
+
+func writeHealthJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	w.Write(b)
+}
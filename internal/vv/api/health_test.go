@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/mpd"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+type mpdHealth mpd.Health
+
+func (m mpdHealth) Health() mpd.Health { return mpd.Health(m) }
+
+func TestHealthHandler(t *testing.T) {
+	connected := mpdHealth{Connected: true, LastSuccess: time.Now()}
+	disconnected := mpdHealth{LastError: errors.New("dial tcp: connection refused")}
+	for label, tt := range map[string]struct {
+		path         string
+		method       string
+		mpd, watcher mpdHealth
+		loaded       bool
+		want         int
+		wantStatus   string
+	}{
+		"healthz":           {path: "/healthz", mpd: disconnected, watcher: disconnected, want: http.StatusOK, wantStatus: "ok"},
+		"readyz":            {path: "/readyz", mpd: connected, watcher: connected, loaded: true, want: http.StatusOK, wantStatus: "ok"},
+		"readyz/not loaded": {path: "/readyz", mpd: connected, watcher: connected, want: http.StatusServiceUnavailable, wantStatus: "unavailable"},
+		"readyz/no mpd":     {path: "/readyz", mpd: disconnected, watcher: connected, loaded: true, want: http.StatusServiceUnavailable, wantStatus: "unavailable"},
+		"readyz/no watcher": {path: "/readyz", mpd: connected, watcher: disconnected, loaded: true, want: http.StatusServiceUnavailable, wantStatus: "unavailable"},
+		"POST":              {path: "/readyz", method: http.MethodPost, want: http.StatusMethodNotAllowed},
+	} {
+		t.Run(label, func(t *testing.T) {
+			loaded := tt.loaded
+			h, err := api.NewHealthHandler(tt.mpd, tt.watcher, func() bool { return loaded })
+			if err != nil {
+				t.Fatalf("NewHealthHandler got error %v; want nil", err)
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("got status %d; want %d", w.Code, tt.want)
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+			var got struct {
+				Status string `json:"status"`
+				MPD    *struct {
+					Connected        bool     `json:"connected"`
+					LastError        string   `json:"last_error"`
+					SinceLastSuccess *float64 `json:"since_last_success"`
+				} `json:"mpd"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse %s: %v", w.Body.String(), err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("got %s; want status %s", w.Body.String(), tt.wantStatus)
+			}
+			if tt.path == "/readyz" {
+				if got.MPD == nil || got.MPD.Connected != tt.mpd.Connected || (got.MPD.SinceLastSuccess != nil) == tt.mpd.LastSuccess.IsZero() ||
+					(got.MPD.LastError != "") != (tt.mpd.LastError != nil) {
+					t.Errorf("got %s; want mpd health %+v", w.Body.String(), tt.mpd)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/request"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	historyDefaultLimit = 100
+	historyRecentLimit  = 20
+	historyQueueSize    = 64
+)
+
+var (
+	bucketHistory       = []byte("history")
+	bucketHistoryCounts = []byte("counts")
+)
+
+// historyCount represents play count of a song.
+type historyCount struct {
+	Song  map[string][]string `json:"song"`
+	Count int                 `json:"count"`
+	Last  time.Time           `json:"last"`
+}
+
+// HistoryHandler records scrobbled songs and serves play history.
+//
+//	GET /api/music/history?offset=0&limit=100&since=2006-01-02T15:04:05Z&until=2006-01-02T15:04:05Z
+//	GET /api/music/history/recent?limit=20
+//	GET /api/music/history/counts?offset=0&limit=100
+type HistoryHandler struct {
+	db      *bolt.DB
+	logger  Logger
+	changed chan struct{}
+	plays   chan *Play
+	done    chan struct{}
+	date    time.Time
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewHistoryHandler opens history db and creates HistoryHandler.
+func NewHistoryHandler(path string, logger Logger) (*HistoryHandler, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0766); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("obtain history db lock: %w", err)
+		}
+		return nil, err
+	}
+	date := time.Now().UTC()
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, s := range [][]byte{bucketHistory, bucketHistoryCounts} {
+			if _, err := tx.CreateBucketIfNotExists(s); err != nil {
+				return fmt.Errorf("create bucket: %w", err)
+			}
+		}
+		if k, _ := tx.Bucket(bucketHistory).Cursor().Last(); k != nil {
+			date = keyTime(k)
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	a := &HistoryHandler{
+		db:      db,
+		logger:  logger,
+		changed: make(chan struct{}, 1),
+		plays:   make(chan *Play, historyQueueSize),
+		done:    make(chan struct{}),
+		date:    date,
+	}
+	go a.run()
+	return a, nil
+}
+
+// NowPlaying implements Scrobbler; history does not record now playing songs.
+func (a *HistoryHandler) NowPlaying(*Play) {}
+
+// Scrobble queues played song to record in background.
+func (a *HistoryHandler) Scrobble(p *Play) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.plays <- p:
+	default:
+		a.logger.Warnw("vv/api: history: queue is full; dropped play", "file", songString(p.Song, "file"))
+	}
+}
+
+func (a *HistoryHandler) run() {
+	defer close(a.done)
+	for p := range a.plays {
+		a.record(p)
+	}
+}
+
+func (a *HistoryHandler) record(e *Play) {
+	if err := a.db.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		h := tx.Bucket(bucketHistory)
+		k := timeKey(e.Time)
+		// avoid to overwrite entry which has same timestamp
+		for h.Get(k) != nil {
+			binary.BigEndian.PutUint64(k, binary.BigEndian.Uint64(k)+1)
+		}
+		if err := h.Put(k, b); err != nil {
+			return err
+		}
+		c := tx.Bucket(bucketHistoryCounts)
+		file := []byte(songTag(e.Song, "file"))
+		count := &historyCount{}
+		if v := c.Get(file); v != nil {
+			if err := json.Unmarshal(v, count); err != nil {
+				return err
+			}
+		}
+		count.Song = e.Song
+		count.Count++
+		count.Last = e.Time
+		if b, err = json.Marshal(count); err != nil {
+			return err
+		}
+		return c.Put(file, b)
+	}); err != nil {
+		a.logger.Errorw("vv/api: history: failed to record play", "file", songString(e.Song, "file"), "error", err)
+		return
+	}
+	a.mu.Lock()
+	a.date = time.Now().UTC()
+	a.mu.Unlock()
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+// ServeHTTP responses play history as json format.
+func (a *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	q := r.URL.Query()
+	var (
+		v   interface{}
+		err error
+	)
+	switch r.URL.Path {
+	case pathAPIMusicHistory:
+		v, err = a.history(q)
+	case pathAPIMusicHistoryRecent:
+		v, err = a.recent(q)
+	case pathAPIMusicHistoryCounts:
+		v, err = a.counts(q)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		var qerr *queryError
+		if errors.As(err, &qerr) {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.mu.Lock()
+	date := a.date
+	a.mu.Unlock()
+	cb := newCacheBinary(mediaTypeJSON+"; charset=utf-8", b, request.AcceptEncoding(r, cacheEncodings...))
+	serveCacheBinary(w, r, cb, date, `"`+cb.hash+`"`)
+}
+
+// history returns played songs ordered by newest first.
+func (a *HistoryHandler) history(q url.Values) ([]*Play, error) {
+	offset, err := queryInt(q, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(q, "limit", historyDefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	since, err := queryTime(q, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := queryTime(q, "until")
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Play{}
+	err = a.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketHistory).Cursor()
+		k, v := c.Last()
+		if !until.IsZero() {
+			if k, v = c.Seek(timeKey(until)); k == nil {
+				k, v = c.Last()
+			} else if keyTime(k).After(until) {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil && len(ret) < limit; k, v = c.Prev() {
+			if !since.IsZero() && keyTime(k).Before(since) {
+				break
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			e := &Play{}
+			if err := json.Unmarshal(v, e); err != nil {
+				return err
+			}
+			ret = append(ret, e)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// recent returns recently played unique songs ordered by newest first.
+func (a *HistoryHandler) recent(q url.Values) ([]*Play, error) {
+	limit, err := queryInt(q, "limit", historyRecentLimit)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Play{}
+	files := map[string]struct{}{}
+	err = a.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketHistory).Cursor()
+		for k, v := c.Last(); k != nil && len(ret) < limit; k, v = c.Prev() {
+			e := &Play{}
+			if err := json.Unmarshal(v, e); err != nil {
+				return err
+			}
+			file := songTag(e.Song, "file")
+			if _, ok := files[file]; ok {
+				continue
+			}
+			files[file] = struct{}{}
+			ret = append(ret, e)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// counts returns play counts ordered by most played songs.
+func (a *HistoryHandler) counts(q url.Values) ([]*historyCount, error) {
+	offset, err := queryInt(q, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(q, "limit", historyDefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*historyCount{}
+	if err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketHistoryCounts).ForEach(func(_, v []byte) error {
+			c := &historyCount{}
+			if err := json.Unmarshal(v, c); err != nil {
+				return err
+			}
+			ret = append(ret, c)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Last.After(ret[j].Last)
+	})
+	if offset > len(ret) {
+		offset = len(ret)
+	}
+	ret = ret[offset:]
+	if limit < len(ret) {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// Changed returns history update event chan.
+func (a *HistoryHandler) Changed() <-chan struct{} {
+	return a.changed
+}
+
+// Close closes history db and update event chan.
+func (a *HistoryHandler) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.plays)
+	a.mu.Unlock()
+	// waits until queued plays are recorded
+	<-a.done
+	close(a.changed)
+	if err := a.db.Close(); err != nil {
+		a.logger.Errorw("vv/api: history: failed to close db", "error", err)
+	}
+}
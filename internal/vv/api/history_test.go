@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+type testHistoryCount struct {
+	Song  map[string][]string `json:"song"`
+	Count int                 `json:"count"`
+}
+
+func getHistory(t *testing.T, h http.Handler, path string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if v != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: failed to parse json %s: %v", path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestHistoryHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	h, err := api.NewHistoryHandler(path, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("NewHistoryHandler got error %v; want nil", err)
+	}
+	now := time.Now()
+	play := func(file string, t time.Time, outputs ...string) *api.Play {
+		return &api.Play{Time: t, Song: map[string][]string{"file": {file}}, Partition: "default", Outputs: outputs}
+	}
+	scrobble := func(t *testing.T, p *api.Play) {
+		t.Helper()
+		h.Scrobble(p)
+		select {
+		case <-h.Changed():
+		case <-time.After(time.Second):
+			t.Fatalf("got no changed event for scrobbled song")
+		}
+	}
+	h.NowPlaying(play("foo.flac", now))
+	if recieveMsg(h.Changed()) {
+		t.Errorf("got changed event for now playing song; want no event")
+	}
+	scrobble(t, play("bar.flac", now.Add(-time.Hour), "My ALSA Device"))
+	scrobble(t, play("baz.flac", now))
+	t.Run("history", func(t *testing.T) {
+		var got []*api.Play
+		if status := getHistory(t, h, "/api/music/history", &got); status != http.StatusOK {
+			t.Fatalf("got status %d; want %d", status, http.StatusOK)
+		}
+		if len(got) != 2 || got[0].Song["file"][0] != "baz.flac" || got[1].Song["file"][0] != "bar.flac" {
+			t.Fatalf("got %v; want baz.flac, bar.flac", got)
+		}
+		if got[1].Partition != "default" || len(got[1].Outputs) != 1 || got[1].Outputs[0] != "My ALSA Device" {
+			t.Errorf("got partition %q, outputs %v; want default, [My ALSA Device]", got[1].Partition, got[1].Outputs)
+		}
+		until := time.Now().Add(-30 * time.Minute).Format(time.RFC3339)
+		got = nil
+		getHistory(t, h, "/api/music/history?"+url.Values{"until": {until}}.Encode(), &got)
+		if len(got) != 1 || got[0].Song["file"][0] != "bar.flac" {
+			t.Errorf("got %v until %s; want bar.flac", got, until)
+		}
+		got = nil
+		getHistory(t, h, "/api/music/history?offset=1&limit=1", &got)
+		if len(got) != 1 || got[0].Song["file"][0] != "bar.flac" {
+			t.Errorf("got %v for offset=1&limit=1; want bar.flac", got)
+		}
+		if status := getHistory(t, h, "/api/music/history?limit=-1", nil); status != http.StatusBadRequest {
+			t.Errorf("got status %d for invalid limit; want %d", status, http.StatusBadRequest)
+		}
+	})
+	t.Run("counts", func(t *testing.T) {
+		scrobble(t, play("bar.flac", now.Add(time.Minute)))
+		var counts []*testHistoryCount
+		getHistory(t, h, "/api/music/history/counts", &counts)
+		if len(counts) != 2 || counts[0].Song["file"][0] != "bar.flac" || counts[0].Count != 2 || counts[1].Count != 1 {
+			t.Errorf("got %v; want bar.flac: 2, baz.flac: 1", counts)
+		}
+		var recent []*api.Play
+		getHistory(t, h, "/api/music/history/recent", &recent)
+		if len(recent) != 2 || recent[0].Song["file"][0] != "bar.flac" || recent[1].Song["file"][0] != "baz.flac" {
+			t.Errorf("got %v; want bar.flac, baz.flac", recent)
+		}
+	})
+	h.Close()
+	t.Run("reopen", func(t *testing.T) {
+		h, err := api.NewHistoryHandler(path, log.NewTestLogger(t))
+		if err != nil {
+			t.Fatalf("NewHistoryHandler got error %v; want nil", err)
+		}
+		defer h.Close()
+		var got []*api.Play
+		getHistory(t, h, "/api/music/history", &got)
+		if len(got) != 3 {
+			t.Errorf("got %d entries after reopen; want 3", len(got))
+		}
+	})
+}
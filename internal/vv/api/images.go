@@ -103,6 +103,11 @@ func (a *ImagesHandler) UpdateLibrarySongs(songs []map[string][]string) {
 	a.mu.Unlock()
 }
 
+// Progress returns number of processed songs and total songs in the last cover image update.
+func (a *ImagesHandler) Progress() (done, total int) {
+	return a.imgBatch.Progress()
+}
+
 // Changed returns response body changes event chan.
 func (a *ImagesHandler) Changed() <-chan bool {
 	return a.changed
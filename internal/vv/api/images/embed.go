@@ -15,6 +15,7 @@ type Embed struct {
 	httpPrefix string
 	cache      *cache
 	client     *mpd.Client
+	thumbs     *Thumbnails
 }
 
 // NewEmbed initializes Embed Cover Art provider with cacheDir.
@@ -80,6 +81,11 @@ func (s *Embed) Close() error {
 	return s.cache.Close()
 }
 
+// SetThumbnails sets disk cache for resized images; must be called before serving images.
+func (s *Embed) SetThumbnails(t *Thumbnails) {
+	s.thumbs = t
+}
+
 // ServeHTTP serves local cover art with httpPrefix
 func (s *Embed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// strip httpPrefix
@@ -99,7 +105,7 @@ func (s *Embed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	serveImage(path, w, r)
+	serveImage(path, s.thumbs, w, r)
 }
 
 // GetURLs returns cover path for song
@@ -50,31 +50,36 @@ func resizeImage(data io.ReadSeeker, width, height int) ([]byte, error) {
 	return outwriter.Bytes(), nil
 }
 
-func serveImage(rpath string, w http.ResponseWriter, r *http.Request) {
+// serveImage serves rpath image; resizes image if request has width and height query.
+// resized image is cached in thumbs if thumbs is not nil.
+func serveImage(rpath string, thumbs *Thumbnails, w http.ResponseWriter, r *http.Request) {
 	i, err := os.Stat(rpath)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 	l := i.ModTime().UTC()
-	if !modifiedSince(r, l) {
-		w.WriteHeader(http.StatusNotModified)
-		return
-	}
-	f, err := os.Open(rpath)
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-	defer f.Close()
 	q := r.URL.Query()
 	ws, hs := q.Get("width"), q.Get("height")
-	if len(ws) == 0 || len(hs) == 0 {
-		if r.URL.Query().Get("d") != "" || q.Get("v") != "" {
-			w.Header().Add("Cache-Control", "max-age=31536000")
-		} else {
-			w.Header().Add("Cache-Control", "max-age=86400")
+	resize := len(ws) != 0 && len(hs) != 0
+	if !resize || thumbs == nil {
+		if !modifiedSince(r, l) {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
+	}
+	if q.Get("d") != "" || q.Get("v") != "" {
+		w.Header().Add("Cache-Control", "max-age=31536000")
+	} else {
+		w.Header().Add("Cache-Control", "max-age=86400")
+	}
+	if !resize {
+		f, err := os.Open(rpath)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
 		w.Header().Add("Content-Length", strconv.FormatInt(i.Size(), 10))
 		w.Header().Add("Content-Type", mime.TypeByExtension(path.Ext(rpath)))
 		w.Header().Add("Last-Modified", l.Format(http.TimeFormat))
@@ -82,27 +87,40 @@ func serveImage(rpath string, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	wi, err := strconv.Atoi(ws)
-	if err != nil {
+	if err != nil || wi <= 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	hi, err := strconv.Atoi(hs)
-	if err != nil {
+	if err != nil || hi <= 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if thumbs != nil {
+		f, etag, err := thumbs.open(rpath, i, wi, hi)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", l, f)
+		return
+	}
+	f, err := os.Open(rpath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
 	b, err := resizeImage(f, wi, hi)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if q := r.URL.Query(); q.Get("d") != "" || q.Get("v") != "" {
-		w.Header().Add("Cache-Control", "max-age=31536000")
-	} else {
-		w.Header().Add("Cache-Control", "max-age=86400")
-	}
 	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
-	w.Header().Add("Content-Type", mime.TypeByExtension(path.Ext(rpath)))
+	w.Header().Add("Content-Type", "image/jpeg")
 	w.Header().Add("Last-Modified", l.Format(http.TimeFormat))
 	w.Write(b)
 }
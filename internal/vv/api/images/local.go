@@ -21,6 +21,7 @@ type Local struct {
 	url2img        map[string]string
 	img2req        map[string]string
 	mu             sync.RWMutex
+	thumbs         *Thumbnails
 }
 
 // NewLocal creates Local.
@@ -39,6 +40,11 @@ func NewLocal(httpPrefix string, dir string, files []string) (*Local, error) {
 	}, nil
 }
 
+// SetThumbnails sets disk cache for resized images; must be called before serving images.
+func (l *Local) SetThumbnails(t *Thumbnails) {
+	l.thumbs = t
+}
+
 // ServeHTTP serves cover art with httpPrefix
 func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	l.mu.RLock()
@@ -48,7 +54,7 @@ func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	serveImage(path, w, r)
+	serveImage(path, l.thumbs, w, r)
 }
 
 // Update rescans all songs images.
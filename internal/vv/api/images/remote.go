@@ -15,6 +15,7 @@ type Remote struct {
 	httpPrefix string
 	cache      *cache
 	client     *mpd.Client
+	thumbs     *Thumbnails
 }
 
 // NewRemote initializes Remote with cacheDir.
@@ -80,6 +81,11 @@ func (s *Remote) Close() error {
 	return s.cache.Close()
 }
 
+// SetThumbnails sets disk cache for resized images; must be called before serving images.
+func (s *Remote) SetThumbnails(t *Thumbnails) {
+	s.thumbs = t
+}
+
 // ServeHTTP serves local cover art with httpPrefix
 func (s *Remote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// strip httpPrefix
@@ -99,7 +105,7 @@ func (s *Remote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	serveImage(path, w, r)
+	serveImage(path, s.thumbs, w, r)
 }
 
 // GetURLs returns cover path for song
@@ -0,0 +1,217 @@
+package images
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThumbnailSizes is a default list of resized image width and height buckets.
+var DefaultThumbnailSizes = []int{64, 128, 192, 256, 384, 512, 768, 1024}
+
+const (
+	thumbnailExt = ".jpg"
+	// thumbnailTouchInterval is a minimum interval to update file modtime on cache hit.
+	// LRU order is kept in memory; modtime is used only to restore it on start.
+	thumbnailTouchInterval = time.Hour
+)
+
+// Thumbnails is a disk cache of resized cover images with LRU eviction.
+type Thumbnails struct {
+	dir     string
+	maxSize int64
+	sizes   []int
+	lru     *list.List // *thumbnail; front is most recently used
+	files   map[string]*list.Element
+	total   int64
+	running map[string]chan struct{}
+	mu      sync.Mutex
+}
+
+type thumbnail struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// NewThumbnails creates Thumbnails stores resized images up to maxSize bytes in dir.
+// requested image size is rounded up to sizes.
+func NewThumbnails(dir string, maxSize int64, sizes []int) (*Thumbnails, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("images: thumbnails: max size must be positive")
+	}
+	if len(sizes) == 0 {
+		sizes = DefaultThumbnailSizes
+	}
+	sizes = append([]int{}, sizes...)
+	sort.Ints(sizes)
+	if sizes[0] <= 0 {
+		return nil, fmt.Errorf("images: thumbnails: invalid size: %d", sizes[0])
+	}
+	if err := os.MkdirAll(dir, 0766); err != nil {
+		return nil, err
+	}
+	t := &Thumbnails{
+		dir:     dir,
+		maxSize: maxSize,
+		sizes:   sizes,
+		lru:     list.New(),
+		files:   map[string]*list.Element{},
+		running: map[string]chan struct{}{},
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// load restores LRU list from file modtime.
+func (t *Thumbnails) load() error {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]file, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), thumbnailExt) {
+			// removes incomplete file
+			os.Remove(filepath.Join(t.dir, e.Name()))
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{name: e.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, f := range files {
+		t.files[f.name] = t.lru.PushFront(&thumbnail{name: f.name, size: f.size, modTime: f.modTime})
+		t.total += f.size
+	}
+	t.evict()
+	return nil
+}
+
+// bucket rounds up n to thumbnail size.
+func (t *Thumbnails) bucket(n int) int {
+	for _, s := range t.sizes {
+		if n <= s {
+			return s
+		}
+	}
+	return t.sizes[len(t.sizes)-1]
+}
+
+// open returns resized image file of rpath and its etag; creates resized image if not cached.
+func (t *Thumbnails) open(rpath string, info os.FileInfo, width, height int) (*os.File, string, error) {
+	width, height = t.bucket(width), t.bucket(height)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%dx%d", rpath, info.ModTime().UnixNano(), info.Size(), width, height)))
+	key := hex.EncodeToString(sum[:16])
+	name := key + thumbnailExt
+	for {
+		t.mu.Lock()
+		if e, ok := t.files[name]; ok {
+			t.lru.MoveToFront(e)
+			// opens file before unlock to prevent eviction
+			f, err := os.Open(filepath.Join(t.dir, name))
+			if err != nil {
+				t.mu.Unlock()
+				return nil, "", err
+			}
+			v := e.Value.(*thumbnail)
+			now := time.Now()
+			touch := now.Sub(v.modTime) > thumbnailTouchInterval
+			if touch {
+				v.modTime = now
+			}
+			t.mu.Unlock()
+			if touch {
+				os.Chtimes(f.Name(), now, now)
+			}
+			return f, `"` + key + `"`, nil
+		}
+		if done, ok := t.running[name]; ok {
+			t.mu.Unlock()
+			<-done
+			continue
+		}
+		done := make(chan struct{})
+		t.running[name] = done
+		t.mu.Unlock()
+
+		size, err := t.create(rpath, name, width, height)
+
+		t.mu.Lock()
+		delete(t.running, name)
+		close(done)
+		if err != nil {
+			t.mu.Unlock()
+			return nil, "", err
+		}
+		t.files[name] = t.lru.PushFront(&thumbnail{name: name, size: size, modTime: time.Now()})
+		t.total += size
+		t.evict()
+		t.mu.Unlock()
+	}
+}
+
+// create writes resized image as name.
+func (t *Thumbnails) create(rpath, name string, width, height int) (int64, error) {
+	src, err := os.Open(rpath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	b, err := resizeImage(src, width, height)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(t.dir, name+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(t.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return int64(len(b)), nil
+}
+
+// evict removes least recently used files until total size is less than max size; t.mu must be locked.
+func (t *Thumbnails) evict() {
+	for t.total > t.maxSize && t.lru.Len() > 1 {
+		e := t.lru.Back()
+		v := t.lru.Remove(e).(*thumbnail)
+		delete(t.files, v.name)
+		t.total -= v.size
+		os.Remove(filepath.Join(t.dir, v.name))
+	}
+}
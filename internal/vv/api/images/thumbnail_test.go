@@ -0,0 +1,118 @@
+package images
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestThumbnails(t *testing.T) {
+	src := filepath.Join("testdata", "app.png")
+	serve := func(thumbs *Thumbnails, url string, header http.Header) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		serveImage(src, thumbs, w, r)
+		return w.Result()
+	}
+	files := func(dir string) []string {
+		ret, _ := filepath.Glob(filepath.Join(dir, "*"))
+		return ret
+	}
+	t.Run("cache", func(t *testing.T) {
+		dir := t.TempDir()
+		thumbs, err := NewThumbnails(dir, 1<<20, []int{16, 8})
+		if err != nil {
+			t.Fatalf("NewThumbnails got error %v; want nil", err)
+		}
+		resp := serve(thumbs, "/?width=5&height=5", nil)
+		etag := resp.Header.Get("ETag")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" || len(etag) == 0 {
+			t.Fatalf("got %d %s etag %q; want 200 image/jpeg with etag", resp.StatusCode, resp.Header.Get("Content-Type"), etag)
+		}
+		img, _, err := image.DecodeConfig(resp.Body)
+		if err != nil || img.Width > 8 || img.Height > 8 || (img.Width != 8 && img.Height != 8) {
+			t.Errorf("got %dx%d image, %v; want fit in 8x8 bucket", img.Width, img.Height, err)
+		}
+		// same bucket
+		if resp := serve(thumbs, "/?width=7&height=8", nil); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag {
+			t.Errorf("got %d etag %q; want 200 etag %q", resp.StatusCode, resp.Header.Get("ETag"), etag)
+		}
+		if resp := serve(thumbs, "/?width=7&height=8", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("got %d for If-None-Match; want 304", resp.StatusCode)
+		}
+		if got := files(dir); len(got) != 1 {
+			t.Errorf("got cache files %v; want 1 file", got)
+		}
+		// larger than max bucket
+		if resp := serve(thumbs, "/?width=100&height=100", nil); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+			t.Errorf("got %d etag %q; want 200 new etag", resp.StatusCode, resp.Header.Get("ETag"))
+		}
+		if resp := serve(thumbs, "/?width=0&height=8", nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got %d for zero width; want 400", resp.StatusCode)
+		}
+		if got := files(dir); len(got) != 2 {
+			t.Errorf("got cache files %v; want 2 files", got)
+		}
+		reloaded, err := NewThumbnails(dir, 1<<20, []int{8, 16})
+		if err != nil {
+			t.Fatalf("NewThumbnails got error %v; want nil", err)
+		}
+		if reloaded.lru.Len() != 2 || reloaded.total != thumbs.total {
+			t.Errorf("got reloaded %d files %d bytes; want 2 files %d bytes", reloaded.lru.Len(), reloaded.total, thumbs.total)
+		}
+	})
+	t.Run("evict", func(t *testing.T) {
+		dir := t.TempDir()
+		thumbs, err := NewThumbnails(dir, 1, []int{8, 16})
+		if err != nil {
+			t.Fatalf("NewThumbnails got error %v; want nil", err)
+		}
+		serve(thumbs, "/?width=8&height=8", nil)
+		old := files(dir)
+		time.Sleep(10 * time.Millisecond)
+		serve(thumbs, "/?width=16&height=16", nil)
+		if got := files(dir); len(got) != 1 || got[0] == old[0] {
+			t.Errorf("got cache files %v; want 1 new file", got)
+		}
+	})
+	t.Run("touch", func(t *testing.T) {
+		dir := t.TempDir()
+		thumbs, err := NewThumbnails(dir, 1<<20, []int{8})
+		if err != nil {
+			t.Fatalf("NewThumbnails got error %v; want nil", err)
+		}
+		serve(thumbs, "/?width=8&height=8", nil)
+		name := files(dir)[0]
+		for _, tt := range []struct {
+			age     time.Duration
+			touched bool
+		}{
+			{age: time.Minute, touched: false},
+			{age: 2 * thumbnailTouchInterval, touched: true},
+		} {
+			old := time.Now().Add(-tt.age).Truncate(time.Second)
+			if err := os.Chtimes(name, old, old); err != nil {
+				t.Fatalf("failed to change modtime: %v", err)
+			}
+			thumbs, err := NewThumbnails(dir, 1<<20, []int{8})
+			if err != nil {
+				t.Fatalf("NewThumbnails got error %v; want nil", err)
+			}
+			serve(thumbs, "/?width=8&height=8", nil)
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatalf("failed to stat: %v", err)
+			}
+			if got := !info.ModTime().Equal(old); got != tt.touched {
+				t.Errorf("got modtime %v for %v old file; want touched %v", info.ModTime(), tt.age, tt.touched)
+			}
+		}
+	})
+}
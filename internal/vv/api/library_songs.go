@@ -2,10 +2,29 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/meiraka/vv/internal/request"
 )
 
+// librarySongsTags is a list of mpd song tags accepted as filter even if no song has it.
+var librarySongsTags = []string{
+	"file", "Last-Modified", "Format", "duration", "Time",
+	"Artist", "ArtistSort", "Album", "AlbumSort", "AlbumArtist", "AlbumArtistSort",
+	"Title", "TitleSort", "Track", "Name", "Genre", "Mood", "Date", "OriginalDate",
+	"Composer", "ComposerSort", "Performer", "Conductor", "Work", "Ensemble", "Movement", "MovementNumber",
+	"Location", "Grouping", "Comment", "Disc", "Label",
+	"MUSICBRAINZ_ARTISTID", "MUSICBRAINZ_ALBUMID", "MUSICBRAINZ_ALBUMARTISTID", "MUSICBRAINZ_TRACKID",
+	"MUSICBRAINZ_RELEASETRACKID", "MUSICBRAINZ_WORKID", "MUSICBRAINZ_RELEASEGROUPID",
+}
+
 type MPDLibrarySongs interface {
 	ListAllInfo(context.Context, string) ([]map[string][]string, error)
 }
@@ -30,6 +49,7 @@ type LibrarySongsHandler struct {
 	changed   chan struct{}
 	songsHook func([]map[string][]string) []map[string][]string
 	data      []map[string][]string
+	tags      map[string]struct{} // tags in data and librarySongsTags
 	mu        sync.RWMutex
 }
 
@@ -38,13 +58,35 @@ func (a *LibrarySongsHandler) Update(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	v := a.songsHook(l)
+	return a.set(a.songsHook(l))
+}
+
+// restore sets json snapshot as library songs.
+func (a *LibrarySongsHandler) restore(b []byte) error {
+	var v []map[string][]string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return a.set(v)
+}
+
+func (a *LibrarySongsHandler) set(v []map[string][]string) error {
 	// force update to skip []byte compare
 	if err := a.cache.Set(v); err != nil {
 		return err
 	}
+	tags := make(map[string]struct{}, len(librarySongsTags))
+	for _, t := range librarySongsTags {
+		tags[t] = struct{}{}
+	}
+	for i := range v {
+		for k := range v[i] {
+			tags[k] = struct{}{}
+		}
+	}
 	a.mu.Lock()
 	a.data = v
+	a.tags = tags
 	a.mu.Unlock()
 	select {
 	case a.changed <- struct{}{}:
@@ -60,8 +102,150 @@ func (a *LibrarySongsHandler) Cache() []map[string][]string {
 }
 
 // ServeHTTP responses library song list as json format.
+//
+// Query parameters select a part of the library:
+//
+//	offset=10&limit=20   pagination
+//	fields=Title,file    returns only given tags
+//	Artist=foo           returns songs which have tag value (other keys are tag filters)
+//
+// unknown query parameters are rejected with 400.
 func (a *LibrarySongsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	a.cache.ServeHTTP(w, r)
+	if len(r.URL.RawQuery) == 0 {
+		a.cache.ServeHTTP(w, r)
+		return
+	}
+	a.mu.RLock()
+	tags := a.tags
+	a.mu.RUnlock()
+	q, err := parseLibrarySongsQuery(r.URL.Query(), tags)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	data, hash, date := a.cache.dataVersion()
+	mediaType := request.Accept(r, mediaTypeJSON, mediaTypeCBOR)
+	etag := fmt.Sprintf(`"%s-%x"`, hash, q.hash)
+	if mediaType == mediaTypeCBOR {
+		etag = fmt.Sprintf(`"%s-%x.cbor"`, hash, q.hash)
+	}
+	if notModified(r, etag, date) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	songs, _ := data.([]map[string][]string)
+	v := q.apply(songs)
+	encoding := request.AcceptEncoding(r, cacheEncodings...)
+	var b *cacheBinary
+	if mediaType == mediaTypeCBOR {
+		n, err := cbor.Marshal(v)
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		b = newCacheBinary(mediaTypeCBOR, n, encoding)
+	} else {
+		n, err := json.Marshal(v)
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		b = newCacheBinary(mediaTypeJSON+"; charset=utf-8", n, encoding)
+	}
+	serveCacheBinary(w, r, b, date, etag)
+}
+
+type librarySongsQuery struct {
+	offset  int
+	limit   int
+	fields  []string
+	filters map[string][]string
+	hash    uint64
+}
+
+func parseLibrarySongsQuery(v url.Values, tags map[string]struct{}) (*librarySongsQuery, error) {
+	offset, err := queryInt(v, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(v, "limit", -1)
+	if err != nil {
+		return nil, err
+	}
+	q := &librarySongsQuery{offset: offset, limit: limit, filters: map[string][]string{}}
+	for k, vs := range v {
+		switch k {
+		case "offset", "limit":
+		case "fields":
+			for _, f := range strings.Split(v.Get(k), ",") {
+				if f = strings.TrimSpace(f); len(f) != 0 {
+					if _, ok := tags[f]; !ok {
+						return nil, &queryError{key: k, value: f}
+					}
+					q.fields = append(q.fields, f)
+				}
+			}
+		default:
+			if _, ok := tags[k]; !ok {
+				return nil, fmt.Errorf("unknown query parameter: %q", k)
+			}
+			q.filters[k] = vs
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(v.Encode()))
+	q.hash = h.Sum64()
+	return q, nil
+}
+
+// apply returns filtered, paginated and projected songs.
+func (q *librarySongsQuery) apply(s []map[string][]string) []map[string][]string {
+	ret := []map[string][]string{}
+	skip := q.offset
+	for _, song := range s {
+		if q.limit >= 0 && len(ret) >= q.limit {
+			break
+		}
+		if !q.match(song) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if len(q.fields) == 0 {
+			ret = append(ret, song)
+			continue
+		}
+		p := make(map[string][]string, len(q.fields))
+		for _, f := range q.fields {
+			if v, ok := song[f]; ok {
+				p[f] = v
+			}
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+func (q *librarySongsQuery) match(song map[string][]string) bool {
+	for k, want := range q.filters {
+		if !containsAny(song[k], want) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(s, want []string) bool {
+	for i := range s {
+		for j := range want {
+			if s[i] == want[j] {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Changed returns library song list update event chan.
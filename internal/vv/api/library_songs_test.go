@@ -117,6 +117,59 @@ func TestLibrarySongsHandlerGet(t *testing.T) {
 
 }
 
+func TestLibrarySongsHandlerGetQuery(t *testing.T) {
+	mpd := &mpdLibrarySongs{t: t, listAllInfo: func(t *testing.T, path string) ([]map[string][]string, error) {
+		return []map[string][]string{
+			{"file": {"a.mp3"}, "Title": {"a"}, "Artist": {"foo"}},
+			{"file": {"b.mp3"}, "Title": {"b"}, "Artist": {"bar", "foo"}},
+			{"file": {"c.mp3"}, "Title": {"c"}, "Artist": {"bar"}},
+		}, nil
+	}}
+	h, err := api.NewLibrarySongsHandler(mpd, func(s []map[string][]string) []map[string][]string { return s })
+	if err != nil {
+		t.Fatalf("api.NewLibrarySongs() = %v, %v", h, err)
+	}
+	if err := h.Update(context.TODO()); err != nil {
+		t.Fatalf("handler.Update(context.TODO()) = %v; want nil", err)
+	}
+	for _, tt := range []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{query: "?fields=file", status: http.StatusOK, want: `[{"file":["a.mp3"]},{"file":["b.mp3"]},{"file":["c.mp3"]}]`},
+		{query: "?fields=Title,file&offset=1&limit=1", status: http.StatusOK, want: `[{"Title":["b"],"file":["b.mp3"]}]`},
+		{query: "?fields=file&Artist=foo", status: http.StatusOK, want: `[{"file":["a.mp3"]},{"file":["b.mp3"]}]`},
+		{query: "?fields=file&Artist=bar&offset=1", status: http.StatusOK, want: `[{"file":["c.mp3"]}]`},
+		{query: "?Artist=baz", status: http.StatusOK, want: `[]`},
+		{query: "?limit=-1", status: http.StatusBadRequest, want: `{"error":"invalid limit: \"-1\""}`},
+		{query: "?offset=a", status: http.StatusBadRequest, want: `{"error":"invalid offset: \"a\""}`},
+		{query: "?fields=file,Titel", status: http.StatusBadRequest, want: `{"error":"invalid fields: \"Titel\""}`},
+		{query: "?limt=1", status: http.StatusBadRequest, want: `{"error":"unknown query parameter: \"limt\""}`},
+		{query: "?Genre=foo", status: http.StatusOK, want: `[]`},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if status, got := w.Result().StatusCode, w.Body.String(); status != tt.status || got != tt.want {
+				t.Fatalf("ServeHTTP got\n%d %s; want\n%d %s", status, got, tt.status, tt.want)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			etag := w.Result().Header.Get("ETag")
+			r = httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			r.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if status := w.Result().StatusCode; status != http.StatusNotModified {
+				t.Errorf("ServeHTTP with If-None-Match: %s got %d; want %d", etag, status, http.StatusNotModified)
+			}
+		})
+	}
+}
+
 func testSongsHook() (func(s []map[string][]string) []map[string][]string, string) {
 	f, key := testSongHook()
 	return func(s []map[string][]string) []map[string][]string {
@@ -1,8 +1,23 @@
 package api
 
+import (
+	"net/http"
+
+	"github.com/meiraka/vv/internal/log"
+)
+
+// Logger represents logger for api.
 type Logger interface {
 	Printf(string, ...interface{})
 	Println(...interface{})
 	Debugf(string, ...interface{})
 	Debugln(...interface{})
+	Debugw(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// requestFields returns log fields with request id of r.
+func requestFields(r *http.Request, keysAndValues ...interface{}) []interface{} {
+	return append([]interface{}{"request_id", log.RequestID(r.Context())}, keysAndValues...)
 }
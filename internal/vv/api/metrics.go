@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/meiraka/vv/internal/metrics"
+)
+
+// handlerMetrics is a set of api metrics.
+type handlerMetrics struct {
+	reconnects *metrics.Vec
+	duration   *metrics.Histogram
+}
+
+// newHandlerMetrics registers api metrics to r.
+func (h *Handler) newHandlerMetrics(r *metrics.Registry) *handlerMetrics {
+	m := &handlerMetrics{
+		reconnects: r.Counter("vv_mpd_reconnects_total", "Number of mpd reconnections."),
+		duration:   r.Histogram("vv_http_request_duration_seconds", "HTTP api request duration in seconds.", nil, "path", "method"),
+	}
+	subscribers := r.Gauge("vv_websocket_subscribers", "Number of websocket connections.")
+	imagesDone := r.Gauge("vv_images_batch_done", "Number of processed songs in the last cover image update.")
+	imagesTotal := r.Gauge("vv_images_batch_total", "Number of songs in the last cover image update.")
+	imagesUpdating := r.Gauge("vv_images_batch_updating", "Whether cover image update is running.")
+	cacheBytes := r.Gauge("vv_api_cache_bytes", "Size of api json cache in bytes.", "path")
+	uptime := r.Gauge("vv_mpd_uptime_seconds", "mpd daemon uptime in seconds.")
+	playtime := r.Gauge("vv_mpd_playtime_seconds", "mpd playing time in seconds.")
+	dbPlaytime := r.Gauge("vv_mpd_db_playtime_seconds", "Sum of all song durations in mpd database in seconds.")
+	dbUpdate := r.Gauge("vv_mpd_db_update_timestamp_seconds", "Last mpd database update time in unix time.")
+	dbArtists := r.Gauge("vv_mpd_db_artists", "Number of artists in mpd database.")
+	dbAlbums := r.Gauge("vv_mpd_db_albums", "Number of albums in mpd database.")
+	dbSongs := r.Gauge("vv_mpd_db_songs", "Number of songs in mpd database.")
+	r.OnCollect(func() {
+		subscribers.Set(float64(h.apiMusic.Subscribers()))
+		done, total := h.apiMusicImages.Progress()
+		imagesDone.Set(float64(done))
+		imagesTotal.Set(float64(total))
+		var updating float64
+		if done < total {
+			updating = 1
+		}
+		imagesUpdating.Set(updating)
+		for path, c := range h.caches {
+			cacheBytes.Set(float64(c.size()), path)
+		}
+		if s, date := h.apiMusicStats.current(); s != nil {
+			uptime.Set(float64(s.Uptime) + time.Since(date).Seconds())
+			playtime.Set(float64(s.Playtime))
+			dbPlaytime.Set(float64(s.LibraryPlaytime))
+			dbUpdate.Set(float64(s.LibraryUpdate))
+			dbArtists.Set(float64(s.Artists))
+			dbAlbums.Set(float64(s.Albums))
+			dbSongs.Set(float64(s.Songs))
+		}
+	})
+	return m
+}
+
+// observe records api request duration. websocket connections are ignored.
+func (m *handlerMetrics) observe(r *http.Request, start time.Time) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return
+	}
+	path := r.URL.Path
+	if !isAPIPath(path) {
+		path = "other"
+	}
+	m.duration.Observe(time.Since(start).Seconds(), path, r.Method)
+}
+
+// isAPIPath reports whether path is served by Handler. used to limit metrics label values.
+func isAPIPath(path string) bool {
+	switch path {
+	case pathAPIMusicStatus, pathAPIMusicHistory, pathAPIMusicHistoryCounts, pathAPIMusicHistoryRecent,
+		pathAPIMusicImages, pathAPIMusicLibrary, pathAPIMusicLibrarySongs, pathAPIMusicOutputs,
+		pathAPIMusicOutputsStream, pathAPIMusicOutputsListeners, pathAPIMusicOutputsHLS, pathAPIMusicPlaylist,
+		pathAPIMusicPlaylistSnapshots, pathAPIMusicPlaylistSongs, pathAPIMusicPlaylistSongsCurrent, pathAPIMusicSchedule,
+		pathAPIMusicOutputsRecordings, pathAPIMusicStats, pathAPIMusicStorage, pathAPIMusicStorageNeighbors, pathAPIVersion,
+		pathAPIAudit:
+		return true
+	}
+	return false
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -145,6 +146,39 @@ func (a *OutputsHandler) Update(ctx context.Context) error {
 	return err
 }
 
+// Enabled returns enabled output names.
+func (a *OutputsHandler) Enabled() []string {
+	a.cache.mu.RLock()
+	data, _ := a.cache.data.(map[string]*httpOutput)
+	a.cache.mu.RUnlock()
+	var ret []string
+	for _, v := range data {
+		if v.Enabled != nil && *v.Enabled {
+			ret = append(ret, v.Name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// outputs returns outputs by id.
+func (a *OutputsHandler) outputs() map[string]*httpOutput {
+	a.cache.mu.RLock()
+	defer a.cache.mu.RUnlock()
+	data, _ := a.cache.data.(map[string]*httpOutput)
+	return data
+}
+
+// restore sets json snapshot as outputs.
+func (a *OutputsHandler) restore(b []byte) error {
+	var data map[string]*httpOutput
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	_, err := a.cache.SetIfModified(data)
+	return err
+}
+
 // Changed returns outputs update event chan.
 func (a *OutputsHandler) Changed() <-chan struct{} {
 	return a.cache.Changed()
@@ -2,66 +2,255 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+const (
+	streamBufferSize    = 1 << 20 // per-listener buffer; drops listener if overflowed
+	streamChunkSize     = 32 * 1024
+	streamMaxRetry      = 3
+	streamRetryInterval = 500 * time.Millisecond
+	icyMetaInt          = 16000 // audio bytes between ICY metadata blocks
+	icyMaxMetaSize      = 255 * 16
+)
+
+var errStreamStopped = errors.New("api: stream: stopped")
+
 // OutputsStreamHandler is a MPD HTTP audio proxy.
+// OutputsStreamHandler shares one upstream connection per output with all listeners;
+// listeners joined midway get separate connection if stream format has no sync point.
 type OutputsStreamHandler struct {
-	proxy  map[string]string
-	stopCh chan struct{}
-	stopMu sync.Mutex
-	stopB  bool
-	logger Logger
+	proxy      map[string]string
+	sources    map[string]*streamSource
+	hls        map[string]*hlsPackager
+	hlsStates  map[string]*hlsState
+	recorders  map[string]*streamRecorder
+	recordDir  string
+	listeners  map[string]int
+	title      string
+	songKey    string
+	cache      *cache
+	recordings *cache
+	mu         sync.Mutex
+	stopCh     chan struct{}
+	stopMu     sync.Mutex
+	stopB      bool
+	logger     Logger
 }
 
 // NewOutputsStreamHandler initilize OutputsStreamHandler cache with mpd connection.
 func NewOutputsStreamHandler(proxy map[string]string, logger Logger) (*OutputsStreamHandler, error) {
+	listeners := make(map[string]int, len(proxy))
+	for k := range proxy {
+		listeners[k] = 0
+	}
+	c, err := newCache(listeners)
+	if err != nil {
+		return nil, err
+	}
+	recordings := make(map[string]*httpRecording, len(proxy))
+	for k := range proxy {
+		recordings[k] = &httpRecording{}
+	}
+	rc, err := newCache(recordings)
+	if err != nil {
+		return nil, err
+	}
 	return &OutputsStreamHandler{
-		proxy:  proxy,
-		stopCh: make(chan struct{}),
-		logger: logger,
+		proxy:      proxy,
+		sources:    map[string]*streamSource{},
+		hls:        map[string]*hlsPackager{},
+		hlsStates:  map[string]*hlsState{},
+		recorders:  map[string]*streamRecorder{},
+		listeners:  listeners,
+		cache:      c,
+		recordings: rc,
+		stopCh:     make(chan struct{}),
+		logger:     logger,
 	}, nil
 }
 
 // ServeHTTP responses audio stream.
 func (a *OutputsStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	dev := r.URL.Query().Get("name")
-	url, ok := a.proxy[dev]
-	if !ok {
+	if _, ok := a.proxy[dev]; !ok {
 		http.NotFound(w, r)
 		return
 	}
-	ctx, cancel := context.WithCancel(r.Context())
-	defer cancel()
-	pr, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	s, l, err := a.join(dev)
 	if err != nil {
-		a.logger.Println("vv/api: stream:", url, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeHTTPError(w, http.StatusServiceUnavailable, err)
 		return
 	}
-	resp, err := http.DefaultClient.Do(pr)
-	if err != nil {
-		a.logger.Println("vv/api: stream:", url, err)
+	defer a.leave(dev, s, l)
+	ctx := r.Context()
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		return
+	}
+	if s.err != nil {
 		w.WriteHeader(http.StatusBadGateway)
 		return
 	}
-	defer resp.Body.Close()
-	for k, v := range resp.Header {
+	for k, v := range s.header {
+		if k == "Content-Length" {
+			continue
+		}
 		for i := range v {
 			w.Header().Add(k, v[i])
 		}
 	}
-	go func() {
-		select {
-		case <-ctx.Done():
-		case <-a.stopCh:
-			// disconnect audio stream by stop()
-			cancel()
+	var out io.Writer = w
+	if r.Header.Get("Icy-MetaData") == "1" {
+		w.Header().Set("Icy-Metaint", strconv.Itoa(icyMetaInt))
+		out = &icyWriter{w: w, remaining: icyMetaInt, title: a.currentTitle}
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	b := make([]byte, streamChunkSize)
+	for {
+		n, err := l.Read(ctx, b)
+		if err != nil {
+			if err == errStreamSlow {
+				a.logger.Warnw("vv/api: stream: drop listener", requestFields(r, "output", dev, "error", err)...)
+			}
+			return
 		}
-	}()
-	io.Copy(w, resp.Body)
+		if _, err := out.Write(b[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// UpdateCurrentSong sets current song title for ICY metadata and splits recording files.
+func (a *OutputsStreamHandler) UpdateCurrentSong(song map[string][]string) {
+	key := songString(song, "Id") + "\x00" + songString(song, "file")
+	title := songString(song, "Title")
+	if len(title) == 0 {
+		title = path.Base(songString(song, "file"))
+	}
+	if artist := strings.Join(song["Artist"], ", "); len(artist) != 0 && len(title) != 0 {
+		title = artist + " - " + title
+	}
+	a.mu.Lock()
+	a.title = title
+	if key != a.songKey {
+		a.songKey = key
+		a.splitRecordings(title)
+	}
+	a.mu.Unlock()
+}
+
+func (a *OutputsStreamHandler) currentTitle() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.title
+}
+
+// Listeners returns a number of stream listeners by output name.
+func (a *OutputsStreamHandler) Listeners() map[string]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ret := make(map[string]int, len(a.listeners))
+	for k, v := range a.listeners {
+		ret[k] = v
+	}
+	return ret
+}
+
+// ServeListeners responses a number of stream listeners by output name.
+func (a *OutputsStreamHandler) ServeListeners(w http.ResponseWriter, r *http.Request) {
+	a.cache.ServeHTTP(w, r)
+}
+
+// join adds listener to output stream; connects to upstream if listener is first one.
+func (a *OutputsStreamHandler) join(dev string) (*streamSource, *streamBuffer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.stopCh:
+		return nil, nil, errStreamStopped
+	default:
+	}
+	s, ok := a.sources[dev]
+	if !ok || s.isClosed() {
+		s = a.newSource(dev)
+		a.sources[dev] = s
+	}
+	l := newStreamBuffer(streamBufferSize)
+	if !s.add(l) {
+		s = a.newSource(dev)
+		s.add(l)
+	}
+	a.listeners[dev]++
+	a.updateListeners()
+	return s, l, nil
+}
+
+// newSource starts upstream connection; a.mu must be locked.
+func (a *OutputsStreamHandler) newSource(dev string) *streamSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &streamSource{
+		url:       a.proxy[dev],
+		ready:     make(chan struct{}),
+		listeners: map[*streamBuffer]struct{}{},
+		stop:      a.stopCh,
+		cancel:    cancel,
+		logger:    a.logger,
+	}
+	go s.run(ctx)
+	return s
+}
+
+// leave removes listener from output stream; disconnects upstream if no listener is left.
+func (a *OutputsStreamHandler) leave(dev string, s *streamSource, l *streamBuffer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s.remove(l) == 0 {
+		if a.sources[dev] == s {
+			delete(a.sources, dev)
+		}
+		s.cancel()
+	}
+	a.listeners[dev]--
+	a.updateListeners()
+}
+
+func (a *OutputsStreamHandler) updateListeners() {
+	listeners := make(map[string]int, len(a.listeners))
+	for k, v := range a.listeners {
+		listeners[k] = v
+	}
+	if _, err := a.cache.SetIfModified(listeners); err != nil {
+		a.logger.Errorw("vv/api: stream: failed to update listeners", "error", err)
+	}
+}
+
+// Changed returns listeners update event chan.
+func (a *OutputsStreamHandler) Changed() <-chan struct{} {
+	return a.cache.Changed()
+}
+
+// Close closes update event chan.
+func (a *OutputsStreamHandler) Close() {
+	a.cache.Close()
+	a.recordings.Close()
 }
 
 // Stop closes audio streams.
@@ -73,3 +262,243 @@ func (a *OutputsStreamHandler) Stop() {
 	}
 	a.stopMu.Unlock()
 }
+
+// streamSource is a upstream audio stream connection shared by listeners.
+type streamSource struct {
+	url       string
+	ready     chan struct{} // closed when header or err is set
+	header    http.Header
+	err       error
+	listeners map[*streamBuffer]struct{}
+	sync      streamSync // nil if listeners can not join midway
+	written   bool
+	closed    error
+	stop      <-chan struct{}
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	logger    Logger
+}
+
+// add adds listener to source; add returns false if stream format can not be shared with listeners joined midway.
+func (s *streamSource) add(l *streamBuffer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed != nil {
+		l.CloseWithError(s.closed)
+		return true
+	}
+	if s.written {
+		if s.sync == nil {
+			return false
+		}
+		if h := s.sync.header(); len(h) != 0 {
+			l.Write(h)
+		}
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *streamSource) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed != nil
+}
+
+func (s *streamSource) remove(l *streamBuffer) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, l)
+	return len(s.listeners)
+}
+
+// run copies upstream stream to listeners until ctx is canceled.
+// run reconnects to upstream if connection is lost after streaming data.
+func (s *streamSource) run(ctx context.Context) {
+	var streamed bool
+	retry := 0
+	for {
+		n, err := s.copy(ctx)
+		if ctx.Err() != nil {
+			s.close(ctx.Err())
+			return
+		}
+		select {
+		case <-s.stop:
+			s.close(errStreamStopped)
+			return
+		default:
+		}
+		if n != 0 {
+			streamed = true
+			retry = 0
+		}
+		if !streamed || retry >= streamMaxRetry {
+			if err == nil {
+				err = io.EOF
+			}
+			s.logger.Errorw("vv/api: stream: disconnected", "url", s.url, "error", err)
+			s.close(err)
+			return
+		}
+		retry++
+		s.logger.Debugw("vv/api: stream: reconnecting", "url", s.url, "error", err)
+		select {
+		case <-ctx.Done():
+			s.close(ctx.Err())
+			return
+		case <-time.After(streamRetryInterval * time.Duration(retry)):
+		}
+	}
+}
+
+// copy connects to upstream and writes stream data to listeners.
+func (s *streamSource) copy(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		s.setReady(nil, err)
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.setReady(nil, err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("api: stream: unexpected status: %s", resp.Status)
+		s.setReady(nil, err)
+		return 0, err
+	}
+	s.setReady(resp.Header, nil)
+	s.reset(resp.Header.Get("Content-Type"))
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.stop:
+			// disconnect audio stream by Stop()
+			cancel()
+		}
+	}()
+	b := make([]byte, streamChunkSize)
+	var total int64
+	for {
+		n, err := resp.Body.Read(b)
+		if n > 0 {
+			total += int64(n)
+			s.write(b[:n])
+		}
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+	}
+}
+
+// setReady sets first upstream connection result.
+func (s *streamSource) setReady(header http.Header, err error) {
+	select {
+	case <-s.ready:
+		return
+	default:
+	}
+	s.header = header
+	s.err = err
+	close(s.ready)
+}
+
+// reset sets stream format of new upstream connection.
+func (s *streamSource) reset(contentType string) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync = nil
+	if f, ok := streamSyncs[mediaType]; ok {
+		s.sync = f()
+	}
+	s.written = false
+}
+
+// write writes p to listeners and drops slow listeners.
+func (s *streamSource) write(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sync != nil {
+		p = s.sync.write(p)
+	}
+	if len(p) == 0 {
+		return
+	}
+	s.written = true
+	for l := range s.listeners {
+		if err := l.Write(p); err != nil {
+			delete(s.listeners, l)
+		}
+	}
+}
+
+// close disconnects all listeners.
+func (s *streamSource) close(err error) {
+	s.setReady(nil, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = err
+	for l := range s.listeners {
+		l.CloseWithError(err)
+		delete(s.listeners, l)
+	}
+}
+
+// icyWriter interleaves ICY metadata blocks into audio stream every icyMetaInt bytes.
+type icyWriter struct {
+	w         io.Writer
+	remaining int
+	title     func() string
+	sent      string
+}
+
+func (w *icyWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) != 0 {
+		n := len(p)
+		if n > w.remaining {
+			n = w.remaining
+		}
+		n, err := w.w.Write(p[:n])
+		written += n
+		w.remaining -= n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if w.remaining == 0 {
+			if _, err := w.w.Write(w.metadata()); err != nil {
+				return written, err
+			}
+			w.remaining = icyMetaInt
+		}
+	}
+	return written, nil
+}
+
+// metadata returns ICY metadata block; block is empty if title is not changed.
+func (w *icyWriter) metadata() []byte {
+	title := w.title()
+	if title == w.sent {
+		return []byte{0}
+	}
+	w.sent = title
+	meta := "StreamTitle='" + title + "';"
+	if len(meta) > icyMaxMetaSize {
+		meta = strings.ToValidUTF8(meta[:icyMaxMetaSize-2], "") + "';"
+	}
+	size := (len(meta) + 15) / 16
+	b := make([]byte, 1+size*16)
+	b[0] = byte(size)
+	copy(b[1:], meta)
+	return b
+}
@@ -0,0 +1,392 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	hlsSegmentDuration = 4 * time.Second
+	hlsSegments        = 6                // segments in live playlist
+	hlsIdleTimeout     = 30 * time.Second // stops packaging if no client requests playlist or segment
+	hlsTimestampKey    = "com.apple.streaming.transportStreamTimestamp"
+)
+
+var errHLSUnsupported = errors.New("api: hls: unsupported stream format")
+
+// hlsCodec represents packed audio format for HLS.
+type hlsCodec struct {
+	contentType string
+	// frame parses audio frame header; returns frame size and duration in samples.
+	frame func(b []byte) (size, samples, rate int, ok bool)
+	// headerSize is a minimum size to parse frame header.
+	headerSize int
+}
+
+var hlsCodecs = map[string]*hlsCodec{
+	"audio/mpeg": {contentType: "audio/mpeg", frame: mp3Frame, headerSize: 4},
+	"audio/aac":  {contentType: "audio/aac", frame: adtsFrame, headerSize: 7},
+	"audio/aacp": {contentType: "audio/aac", frame: adtsFrame, headerSize: 7},
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, // MPEG-1
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},     // MPEG-2, 2.5
+	}
+	mp3SampleRates = [4]int{44100, 48000, 32000, 0}
+	adtsRates      = [16]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+)
+
+// mp3Frame parses MPEG audio layer III frame header.
+func mp3Frame(b []byte) (size, samples, rate int, ok bool) {
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return 0, 0, 0, false
+	}
+	version := (b[1] >> 3) & 3 // 0: MPEG-2.5, 2: MPEG-2, 3: MPEG-1
+	if version == 1 || (b[1]>>1)&3 != 1 {
+		return 0, 0, 0, false
+	}
+	lsf := 0
+	if version != 3 {
+		lsf = 1
+	}
+	bitrate := mp3Bitrates[lsf][b[2]>>4] * 1000
+	rate = mp3SampleRates[(b[2]>>2)&3]
+	if bitrate == 0 || rate == 0 {
+		return 0, 0, 0, false
+	}
+	switch version {
+	case 2:
+		rate /= 2
+	case 0:
+		rate /= 4
+	}
+	padding := int(b[2]>>1) & 1
+	if lsf == 0 {
+		return 144*bitrate/rate + padding, 1152, rate, true
+	}
+	return 72*bitrate/rate + padding, 576, rate, true
+}
+
+// adtsFrame parses AAC ADTS frame header.
+func adtsFrame(b []byte) (size, samples, rate int, ok bool) {
+	if b[0] != 0xff || b[1]&0xf6 != 0xf0 {
+		return 0, 0, 0, false
+	}
+	rate = adtsRates[(b[2]>>2)&0xf]
+	size = int(b[3]&3)<<11 | int(b[4])<<3 | int(b[5]>>5)
+	if rate == 0 || size < 7 {
+		return 0, 0, 0, false
+	}
+	return size, (int(b[6]&3) + 1) * 1024, rate, true
+}
+
+// hlsSegment is a packed audio segment.
+type hlsSegment struct {
+	data     []byte
+	duration float64
+}
+
+// hlsState is a position of stopped packager to continue media sequence and timestamp.
+type hlsState struct {
+	sequence int // next media sequence number
+	restarts int // number of discontinuities
+	elapsed  float64
+	stopped  time.Time
+}
+
+// hlsPackager splits audio stream into rolling HLS segments.
+type hlsPackager struct {
+	codec    *hlsCodec
+	segments []*hlsSegment
+	sequence int // media sequence number of segments[0]
+	start    int // media sequence number of first segment
+	restarts int // number of restarts; first segment has discontinuity if not zero
+	ready    chan struct{}
+	err      error
+	access   time.Time
+	mu       sync.Mutex
+
+	buf     []byte  // unparsed stream data
+	seg     []byte  // current segment frames
+	samples int     // current segment samples
+	rate    int     // current segment sample rate
+	elapsed float64 // total seconds of finished segments
+}
+
+// newHLSPackager creates packager; continues media sequence and timestamp from previous packager state if not nil.
+func newHLSPackager(prev *hlsState) *hlsPackager {
+	p := &hlsPackager{ready: make(chan struct{}), access: time.Now()}
+	if prev != nil {
+		p.sequence, p.start, p.restarts = prev.sequence, prev.sequence, prev.restarts+1
+		p.elapsed = prev.elapsed + time.Since(prev.stopped).Seconds()
+	}
+	return p
+}
+
+// state returns position to continue by next packager; returns nil if no segment is published.
+func (p *hlsPackager) state() *hlsState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sequence == p.start && len(p.segments) == 0 {
+		return nil
+	}
+	return &hlsState{
+		sequence: p.sequence + len(p.segments),
+		restarts: p.restarts,
+		elapsed:  p.elapsed,
+		stopped:  time.Now(),
+	}
+}
+
+// ServeHLS responses HLS live playlist or segment of audio stream.
+func (a *OutputsStreamHandler) ServeHLS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dev := q.Get("name")
+	if _, ok := a.proxy[dev]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	p := a.hlsPackager(dev)
+	select {
+	case <-p.ready:
+	case <-r.Context().Done():
+		return
+	}
+	if p.err != nil {
+		status := http.StatusBadGateway
+		if p.err == errHLSUnsupported {
+			status = http.StatusNotImplemented
+		} else if p.err == errStreamStopped {
+			status = http.StatusServiceUnavailable
+		}
+		writeHTTPError(w, status, p.err)
+		return
+	}
+	if s := q.Get("segment"); len(s) != 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("api: hls: invalid segment: %q", s))
+			return
+		}
+		seg, ok := p.segment(n)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", p.codec.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(seg.data)))
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(hlsSegmentDuration*hlsSegments/time.Second)))
+		w.Write(seg.data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(p.playlist(dev))
+}
+
+// hlsPackager returns running packager for output; starts new one if not exists.
+func (a *OutputsStreamHandler) hlsPackager(dev string) *hlsPackager {
+	a.mu.Lock()
+	p, ok := a.hls[dev]
+	if !ok {
+		p = newHLSPackager(a.hlsStates[dev])
+		a.hls[dev] = p
+	}
+	a.mu.Unlock()
+	if !ok {
+		go a.runHLS(dev, p)
+	}
+	return p
+}
+
+// runHLS reads audio stream as a listener and packs it into segments until packager is idle.
+func (a *OutputsStreamHandler) runHLS(dev string, p *hlsPackager) {
+	err := a.packHLS(dev, p)
+	a.mu.Lock()
+	if a.hls[dev] == p {
+		delete(a.hls, dev)
+	}
+	// media sequence must not go backwards for clients resumed after idle
+	if st := p.state(); st != nil {
+		a.hlsStates[dev] = st
+	}
+	a.mu.Unlock()
+	p.close(err)
+}
+
+func (a *OutputsStreamHandler) packHLS(dev string, p *hlsPackager) error {
+	s, l, err := a.join(dev)
+	if err != nil {
+		return err
+	}
+	defer a.leave(dev, s, l)
+	<-s.ready
+	if s.err != nil {
+		return s.err
+	}
+	mediaType, _, _ := mime.ParseMediaType(s.header.Get("Content-Type"))
+	codec, ok := hlsCodecs[mediaType]
+	if !ok {
+		return errHLSUnsupported
+	}
+	p.codec = codec
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if p.idle() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	b := make([]byte, streamChunkSize)
+	for {
+		n, err := l.Read(ctx, b)
+		if err != nil {
+			return err
+		}
+		p.write(b[:n])
+	}
+}
+
+// write parses audio frames and finishes segment if segment duration is reached.
+func (p *hlsPackager) write(b []byte) {
+	p.buf = append(p.buf, b...)
+	i := 0
+	for len(p.buf)-i >= p.codec.headerSize {
+		size, samples, rate, ok := p.codec.frame(p.buf[i:])
+		if !ok {
+			// resync; skips ID3 tag or broken data
+			i++
+			continue
+		}
+		if len(p.buf)-i < size {
+			break
+		}
+		if rate != p.rate || time.Duration(p.samples+samples)*time.Second > hlsSegmentDuration*time.Duration(rate) {
+			p.flush()
+			p.rate = rate
+		}
+		p.seg = append(p.seg, p.buf[i:i+size]...)
+		p.samples += samples
+		i += size
+	}
+	p.buf = append(p.buf[:0], p.buf[i:]...)
+}
+
+// flush publishes current segment with ID3 timestamp tag.
+func (p *hlsPackager) flush() {
+	if p.samples == 0 {
+		return
+	}
+	duration := float64(p.samples) / float64(p.rate)
+	data := append(id3Timestamp(uint64(p.elapsed*90000)), p.seg...)
+	p.elapsed += duration
+	p.seg = p.seg[:0]
+	p.samples = 0
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.segments = append(p.segments, &hlsSegment{data: data, duration: duration})
+	if len(p.segments) > hlsSegments {
+		p.segments = p.segments[1:]
+		p.sequence++
+	}
+	select {
+	case <-p.ready:
+	default:
+		close(p.ready)
+	}
+}
+
+// close stops packager with err; waiting clients receive err if no segment is published.
+func (p *hlsPackager) close(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready:
+	default:
+		p.err = err
+		close(p.ready)
+	}
+}
+
+func (p *hlsPackager) idle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Since(p.access) > hlsIdleTimeout
+}
+
+// segment returns segment by media sequence number.
+func (p *hlsPackager) segment(n int) (*hlsSegment, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.access = time.Now()
+	if i := n - p.sequence; i >= 0 && i < len(p.segments) {
+		return p.segments[i], true
+	}
+	return nil, false
+}
+
+// playlist returns live media playlist.
+func (p *hlsPackager) playlist(dev string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.access = time.Now()
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(hlsSegmentDuration/time.Second))
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.sequence)
+	if p.restarts != 0 {
+		// discontinuity tags before first segment in playlist
+		seq := p.restarts
+		if p.sequence == p.start {
+			seq--
+		}
+		fmt.Fprintf(&b, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", seq)
+	}
+	for i, s := range p.segments {
+		if p.restarts != 0 && p.sequence+i == p.start {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", s.duration)
+		b.WriteString(path.Base(pathAPIMusicOutputsHLS) + "?" + url.Values{"name": {dev}, "segment": {strconv.Itoa(p.sequence + i)}}.Encode() + "\n")
+	}
+	return b.Bytes()
+}
+
+// id3Timestamp returns ID3v2.4 tag with MPEG-2 transport stream timestamp for packed audio segment.
+func id3Timestamp(ts uint64) []byte {
+	frame := append([]byte(hlsTimestampKey+"\x00"), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(frame[len(frame)-8:], ts&0x1ffffffff)
+	b := []byte{'I', 'D', '3', 4, 0, 0}
+	b = append(b, syncsafe(10+len(frame))...)
+	b = append(b, 'P', 'R', 'I', 'V')
+	b = append(b, syncsafe(len(frame))...)
+	b = append(b, 0, 0)
+	return append(b, frame...)
+}
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestHLSPackagerRestart(t *testing.T) {
+	// MPEG-1 layer III 128kbps 44.1kHz; 153 frames per segment
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 413)...)
+	pack := func(prev *hlsState, segments int) *hlsPackager {
+		p := newHLSPackager(prev)
+		p.codec = hlsCodecs["audio/mpeg"]
+		p.write(bytes.Repeat(frame, 153*segments+1))
+		return p
+	}
+	timestamp := func(p *hlsPackager, n int) uint64 {
+		s, ok := p.segment(n)
+		if !ok {
+			t.Fatalf("segment %d not found", n)
+		}
+		return binary.BigEndian.Uint64(s.data[65:73])
+	}
+	first := pack(nil, 8)
+	if got := string(first.playlist("out")); strings.Contains(got, "DISCONTINUITY") || !strings.Contains(got, "#EXT-X-MEDIA-SEQUENCE:2\n") {
+		t.Errorf("got first playlist\n%s; want media sequence 2 without discontinuity", got)
+	}
+	last := timestamp(first, 7)
+
+	// restarted after idle
+	second := pack(first.state(), 2)
+	if got, want := string(second.playlist("out")), "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:8\n#EXT-X-DISCONTINUITY-SEQUENCE:0\n#EXT-X-DISCONTINUITY\n#EXTINF:3.997,\nhls?name=out&segment=8\n#EXTINF:3.997,\nhls?name=out&segment=9\n"; got != want {
+		t.Errorf("got restarted playlist\n%s; want\n%s", got, want)
+	}
+	if got := timestamp(second, 8); got <= last {
+		t.Errorf("got restarted timestamp %d; want greater than %d", got, last)
+	}
+
+	// discontinuity is removed from playlist
+	second.write(bytes.Repeat(frame, 153*6))
+	if got := string(second.playlist("out")); strings.Contains(got, "#EXT-X-DISCONTINUITY\n") || !strings.Contains(got, "#EXT-X-MEDIA-SEQUENCE:10\n#EXT-X-DISCONTINUITY-SEQUENCE:1\n") {
+		t.Errorf("got playlist\n%s; want media sequence 10 and discontinuity sequence 1", got)
+	}
+}
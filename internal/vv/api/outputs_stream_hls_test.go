@@ -0,0 +1,117 @@
+package api_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+func TestOutputsStreamHandlerHLS(t *testing.T) {
+	// MPEG-1 layer III 128kbps 44.1kHz
+	mp3 := append([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 413)...)
+	// AAC LC 44.1kHz stereo 200 bytes
+	aac := append([]byte{0xff, 0xf1, 0x50, 0x80, 200 >> 3, (200&7)<<5 | 0x1f, 0xfc}, make([]byte, 193)...)
+	for _, tt := range []struct {
+		label       string
+		contentType string
+		frame       []byte
+		frames      int // frames per segment
+		want        string
+	}{
+		{
+			label:       "mp3",
+			contentType: "audio/mpeg",
+			frame:       mp3,
+			frames:      153,
+			want:        "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:3.997,\nhls?name=out&segment=0\n#EXTINF:3.997,\nhls?name=out&segment=1\n",
+		},
+		{
+			label:       "aac",
+			contentType: "audio/aac",
+			frame:       aac,
+			frames:      172,
+			want:        "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:3.994,\nhls?name=out&segment=0\n#EXTINF:3.994,\nhls?name=out&segment=1\n",
+		},
+	} {
+		t.Run(tt.label, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				// garbage before first frame
+				w.Write([]byte("ID3"))
+				w.Write(bytes.Repeat(tt.frame, 400))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			}))
+			defer upstream.Close()
+			h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+			if err != nil {
+				t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+			}
+			defer h.Stop()
+			get := func(url string) *http.Response {
+				w := httptest.NewRecorder()
+				h.ServeHLS(w, httptest.NewRequest(http.MethodGet, url, nil))
+				return w.Result()
+			}
+			resp := get("/api/music/outputs/hls?name=out")
+			// playlist may be requested before second segment is published
+			for i := 0; i < 100; i++ {
+				b, _ := io.ReadAll(resp.Body)
+				if string(b) == tt.want {
+					break
+				}
+				if i == 99 {
+					t.Fatalf("got playlist\n%s; want\n%s", b, tt.want)
+				}
+				time.Sleep(10 * time.Millisecond)
+				resp = get("/api/music/outputs/hls?name=out")
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+				t.Errorf("got playlist Content-Type %q; want application/vnd.apple.mpegurl", ct)
+			}
+			resp = get("/api/music/outputs/hls?name=out&segment=1")
+			b, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("got segment %d %s; want 200 %s", resp.StatusCode, resp.Header.Get("Content-Type"), tt.contentType)
+			}
+			if !bytes.HasPrefix(b, []byte("ID3\x04")) || !bytes.Contains(b, []byte("com.apple.streaming.transportStreamTimestamp\x00")) {
+				t.Errorf("got segment without ID3 timestamp tag")
+			}
+			if want := bytes.Repeat(tt.frame, tt.frames); !bytes.HasSuffix(b, want) || len(b) != len(want)+73 {
+				t.Errorf("got %d bytes segment; want id3 tag(73 bytes) and %d frames(%d bytes)", len(b), tt.frames, len(want))
+			}
+			if resp := get("/api/music/outputs/hls?name=out&segment=2"); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("got unpublished segment status %d; want 404", resp.StatusCode)
+			}
+			if resp := get("/api/music/outputs/hls?name=notfound"); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("got unknown output status %d; want 404", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestOutputsStreamHandlerHLSUnsupported(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/ogg")
+		w.Write([]byte("OggS"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	w := httptest.NewRecorder()
+	h.ServeHLS(w, httptest.NewRequest(http.MethodGet, "/api/music/outputs/hls?name=out", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d; want %d", w.Code, http.StatusNotImplemented)
+	}
+}
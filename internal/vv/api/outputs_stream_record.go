@@ -0,0 +1,405 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordExtensions is a list of file extensions by stream content type which can be split by song.
+// mp3 and aac are split at frame boundary, ogg is split at beginning of chained stream;
+// other formats can not be split without re-encoding.
+var recordExtensions = map[string]string{
+	"audio/mpeg":      "mp3",
+	"audio/aac":       "aac",
+	"audio/aacp":      "aac",
+	"audio/ogg":       "ogg",
+	"application/ogg": "ogg",
+}
+
+var errRecordUnsupported = errors.New("api: record: stream format can not be split by song")
+
+type httpRecording struct {
+	Recording bool   `json:"recording"`
+	File      string `json:"file,omitempty"`
+}
+
+// SetRecordDirectory enables recording api to save output streams in dir.
+func (a *OutputsStreamHandler) SetRecordDirectory(dir string) {
+	a.mu.Lock()
+	a.recordDir = dir
+	a.mu.Unlock()
+}
+
+// ServeRecordings responses recording status by output name; starts or stops recording by POST request.
+func (a *OutputsStreamHandler) ServeRecordings(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	dir := a.recordDir
+	a.mu.Unlock()
+	if len(dir) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		a.recordings.ServeHTTP(w, r)
+		return
+	}
+	var req map[string]*httpRecording
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	for k := range req {
+		if _, ok := a.proxy[k]; !ok {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("api: record: unknown output: %q", k))
+			return
+		}
+	}
+	for k, v := range req {
+		if v == nil {
+			continue
+		}
+		if v.Recording {
+			if err := a.startRecording(r.Context(), k); err != nil {
+				status := http.StatusBadGateway
+				if errors.Is(err, errRecordUnsupported) {
+					status = http.StatusBadRequest
+				} else if errors.Is(err, errStreamStopped) {
+					status = http.StatusServiceUnavailable
+				}
+				writeHTTPError(w, status, err)
+				return
+			}
+		} else if err := a.stopRecording(r.Context(), k); err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	r.Method = http.MethodGet
+	a.recordings.ServeHTTP(w, r)
+}
+
+// RecordingsChanged returns recording status update event chan.
+func (a *OutputsStreamHandler) RecordingsChanged() <-chan struct{} {
+	return a.recordings.Changed()
+}
+
+// Shutdown stops recordings.
+func (a *OutputsStreamHandler) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	devs := make([]string, 0, len(a.recorders))
+	for k := range a.recorders {
+		devs = append(devs, k)
+	}
+	a.mu.Unlock()
+	for _, dev := range devs {
+		if err := a.stopRecording(ctx, dev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startRecording connects to output stream and starts recording if stream format can be split by song.
+func (a *OutputsStreamHandler) startRecording(ctx context.Context, dev string) error {
+	a.mu.Lock()
+	_, ok := a.recorders[dev]
+	a.mu.Unlock()
+	if ok {
+		return nil
+	}
+	s, l, err := a.join(dev)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		a.leave(dev, s, l)
+		return ctx.Err()
+	}
+	if s.err != nil {
+		a.leave(dev, s, l)
+		return s.err
+	}
+	mediaType, _, _ := mime.ParseMediaType(s.header.Get("Content-Type"))
+	ext, ok := recordExtensions[mediaType]
+	if !ok {
+		a.leave(dev, s, l)
+		return fmt.Errorf("%w: %q", errRecordUnsupported, mediaType)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.recorders[dev]; ok {
+		go a.leave(dev, s, l)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &streamRecorder{
+		dir:    filepath.Join(a.recordDir, dev),
+		ext:    ext,
+		codec:  hlsCodecs[mediaType],
+		title:  a.title,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r.opened = func() {
+		a.mu.Lock()
+		a.updateRecordings()
+		a.mu.Unlock()
+	}
+	a.recorders[dev] = r
+	a.updateRecordings()
+	go a.runRecording(ctx, dev, r, s, l)
+	return nil
+}
+
+func (a *OutputsStreamHandler) stopRecording(ctx context.Context, dev string) error {
+	a.mu.Lock()
+	r, ok := a.recorders[dev]
+	if ok {
+		delete(a.recorders, dev)
+		a.updateRecordings()
+	}
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runRecording records output stream until recording is stopped or stream is closed.
+func (a *OutputsStreamHandler) runRecording(ctx context.Context, dev string, r *streamRecorder, s *streamSource, l *streamBuffer) {
+	defer close(r.done)
+	err := r.record(ctx, l)
+	a.leave(dev, s, l)
+	if ctx.Err() == nil && !errors.Is(err, errStreamStopped) {
+		a.logger.Errorw("vv/api: record: stopped", "output", dev, "error", err)
+	}
+	if err := r.close(); err != nil {
+		a.logger.Errorw("vv/api: record: failed to close file", "output", dev, "error", err)
+	}
+	a.mu.Lock()
+	if a.recorders[dev] == r {
+		delete(a.recorders, dev)
+	}
+	a.updateRecordings()
+	a.mu.Unlock()
+}
+
+// splitRecordings starts new recording files for new song.
+func (a *OutputsStreamHandler) splitRecordings(title string) {
+	for _, r := range a.recorders {
+		r.split(title)
+	}
+}
+
+// updateRecordings updates recording status cache; a.mu must be locked.
+func (a *OutputsStreamHandler) updateRecordings() {
+	recordings := make(map[string]*httpRecording, len(a.proxy))
+	for k := range a.proxy {
+		recordings[k] = &httpRecording{}
+	}
+	for k, r := range a.recorders {
+		recordings[k] = &httpRecording{Recording: true, File: r.filename()}
+	}
+	if _, err := a.recordings.SetIfModified(recordings); err != nil {
+		a.logger.Errorw("vv/api: record: failed to update recordings", "error", err)
+	}
+}
+
+// streamRecorder writes output stream to files split by song.
+type streamRecorder struct {
+	dir    string
+	ext    string
+	codec  *hlsCodec // nil if stream is ogg
+	opened func()
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	buf    []byte
+	file   *os.File
+	name   string
+	title  string // song title for next file
+	splitB bool
+	bos    bool // last ogg page is BOS
+	mu     sync.Mutex
+}
+
+// record writes stream data from l until ctx is canceled or stream is closed.
+func (r *streamRecorder) record(ctx context.Context, l *streamBuffer) error {
+	b := make([]byte, streamChunkSize)
+	for {
+		n, err := l.Read(ctx, b)
+		if err != nil {
+			return err
+		}
+		if err := r.write(b[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// split closes current file and opens new file for title at next frame.
+func (r *streamRecorder) split(title string) {
+	r.mu.Lock()
+	r.title = title
+	r.splitB = true
+	r.mu.Unlock()
+}
+
+// filename returns current file path relative to record directory.
+func (r *streamRecorder) filename() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.name) == 0 {
+		return ""
+	}
+	return filepath.Join(filepath.Base(r.dir), r.name)
+}
+
+func (r *streamRecorder) write(b []byte) error {
+	r.buf = append(r.buf, b...)
+	if r.codec == nil {
+		var err error
+		i := oggPages(r.buf, func(p []byte) {
+			if err == nil {
+				err = r.writePage(p)
+			}
+		})
+		r.buf = append(r.buf[:0], r.buf[i:]...)
+		return err
+	}
+	i := 0
+	for len(r.buf)-i >= r.codec.headerSize {
+		size, _, _, ok := r.codec.frame(r.buf[i:])
+		if !ok {
+			i++
+			continue
+		}
+		if len(r.buf)-i < size {
+			break
+		}
+		if err := r.writeFrame(r.buf[i : i+size]); err != nil {
+			return err
+		}
+		i += size
+	}
+	r.buf = append(r.buf[:0], r.buf[i:]...)
+	return nil
+}
+
+func (r *streamRecorder) writeFrame(b []byte) error {
+	r.mu.Lock()
+	split := r.splitB
+	r.splitB = false
+	title := r.title
+	r.mu.Unlock()
+	if split {
+		if err := r.close(); err != nil {
+			return err
+		}
+	}
+	if r.file == nil {
+		if err := r.open(title); err != nil {
+			return err
+		}
+	}
+	_, err := r.file.Write(b)
+	return err
+}
+
+// writePage writes ogg page; opens new file at first BOS page of chained stream.
+func (r *streamRecorder) writePage(p []byte) error {
+	bos := oggBOS(p)
+	split := bos && !r.bos
+	r.bos = bos
+	r.mu.Lock()
+	r.splitB = false
+	title := r.title
+	r.mu.Unlock()
+	if split {
+		if err := r.close(); err != nil {
+			return err
+		}
+	}
+	if r.file == nil {
+		if err := r.open(title); err != nil {
+			return err
+		}
+	}
+	_, err := r.file.Write(p)
+	return err
+}
+
+func (r *streamRecorder) open(title string) error {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	base := time.Now().Format("20060102-150405")
+	if title = recordFileName(title); len(title) != 0 {
+		base += " " + title
+	}
+	for i := 0; ; i++ {
+		name := base + "." + r.ext
+		if i != 0 {
+			name = base + " (" + strconv.Itoa(i) + ")." + r.ext
+		}
+		f, err := os.OpenFile(filepath.Join(r.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.file = f
+		r.name = name
+		r.mu.Unlock()
+		if r.opened != nil {
+			r.opened()
+		}
+		return nil
+	}
+}
+
+func (r *streamRecorder) close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// recordFileName removes path separators and control characters from title.
+func recordFileName(title string) string {
+	title = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, title)
+	if len(title) > 200 {
+		title = strings.ToValidUTF8(title[:200], "")
+	}
+	return strings.TrimSpace(title)
+}
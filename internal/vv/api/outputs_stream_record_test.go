@@ -0,0 +1,237 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+func TestOutputsStreamHandlerRecordings(t *testing.T) {
+	// MPEG-1 layer III 128kbps 44.1kHz
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 413)...)
+	data := make(chan []byte)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case b := <-data:
+				w.Write(b)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	serve := func(method, body string) (int, map[string]map[string]interface{}) {
+		w := httptest.NewRecorder()
+		h.ServeRecordings(w, httptest.NewRequest(method, "/api/music/outputs/stream/recordings", strings.NewReader(body)))
+		var ret map[string]map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &ret)
+		return w.Code, ret
+	}
+	if status, _ := serve(http.MethodGet, ""); status != http.StatusNotFound {
+		t.Errorf("got status %d without record directory; want 404", status)
+	}
+	dir := t.TempDir()
+	h.SetRecordDirectory(dir)
+	if status, _ := serve(http.MethodPost, `{"notfound":{"recording":true}}`); status != http.StatusBadRequest {
+		t.Errorf("got status %d for unknown output; want 400", status)
+	}
+
+	h.UpdateCurrentSong(map[string][]string{"Id": {"1"}, "file": {"foo.flac"}, "Artist": {"baz"}, "Title": {"foo/bar"}})
+	if status, got := serve(http.MethodPost, `{"out":{"recording":true}}`); status != http.StatusOK || got["out"]["recording"] != true {
+		t.Fatalf("got %d %v; want 200 recording", status, got)
+	}
+	waitFile := func(size int) string {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			_, got := serve(http.MethodGet, "")
+			if name, _ := got["out"]["file"].(string); len(name) != 0 {
+				if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Size() == int64(size) {
+					return name
+				}
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("recording file is not written: %v", got)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	// partial frame is written with next chunk
+	data <- bytes.Repeat(frame, 3)[:len(frame)*3-100]
+	data <- frame[len(frame)-100:]
+	first := waitFile(len(frame) * 3)
+	h.UpdateCurrentSong(map[string][]string{"Id": {"2"}, "file": {"qux.flac"}})
+	data <- bytes.Repeat(frame, 2)
+	second := waitFile(len(frame) * 2)
+	if status, got := serve(http.MethodPost, `{"out":{"recording":false}}`); status != http.StatusOK || got["out"]["recording"] != false {
+		t.Errorf("got %d %v; want 200 not recording", status, got)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "out", "*"))
+	sort.Strings(files)
+	if len(files) != 2 || first == second {
+		t.Fatalf("got files %v; want 2 files", files)
+	}
+	for name, suffix := range map[string]string{first: " baz - foo_bar.mp3", second: " qux.flac.mp3"} {
+		if !strings.HasPrefix(name, "out"+string(filepath.Separator)) || !strings.HasSuffix(name, suffix) {
+			t.Errorf("got file %q; want out/<date>%s", name, suffix)
+		}
+	}
+}
+
+func TestOutputsStreamHandlerRecordingsOgg(t *testing.T) {
+	data := make(chan []byte)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/ogg")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case b := <-data:
+				w.Write(b)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	dir := t.TempDir()
+	h.SetRecordDirectory(dir)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	post := func(body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeRecordings(w, httptest.NewRequest(http.MethodPost, "/api/music/outputs/stream/recordings", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d %s; want 200", w.Code, w.Body.String())
+		}
+	}
+
+	// starts recording midway
+	resp, err := http.Get(ts.URL + "/?name=out")
+	if err != nil {
+		t.Fatalf("failed to get stream: %v", err)
+	}
+	defer resp.Body.Close()
+	headers := append(oggPage(0x02, 0, "OpusHead"), oggPage(0, 0, "OpusTags")...)
+	audio := [][]byte{oggPage(0, 960, "audio1"), oggPage(0, 1920, "audio2"), oggPage(0, 2880, "audio3")}
+	data <- append(append([]byte{}, headers...), audio[0]...)
+	if _, err := io.ReadFull(resp.Body, make([]byte, len(headers)+len(audio[0]))); err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	h.UpdateCurrentSong(map[string][]string{"Id": {"1"}, "file": {"foo.flac"}})
+	post(`{"out":{"recording":true}}`)
+	wait := func(f func() bool) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for !f() {
+			select {
+			case <-timeout:
+				t.Fatal("timed out")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	wait(func() bool { return h.Listeners()["out"] == 2 })
+	data <- audio[1]
+	wait(func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "out", "*"))
+		if len(files) != 1 {
+			return false
+		}
+		info, err := os.Stat(files[0])
+		return err == nil && info.Size() == int64(len(headers)+len(audio[1]))
+	})
+	// mpd starts new chained stream for new song
+	h.UpdateCurrentSong(map[string][]string{"Id": {"2"}, "file": {"bar.flac"}})
+	next := append(append(oggPage(0x02, 0, "OpusHead2"), oggPage(0, 0, "OpusTags2")...), audio[2]...)
+	data <- next
+	if _, err := io.ReadFull(resp.Body, make([]byte, len(audio[1])+len(next))); err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	want := map[string][]byte{
+		" foo.flac.ogg": append(append([]byte{}, headers...), audio[1]...),
+		" bar.flac.ogg": next,
+	}
+	wait(func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "out", "*"))
+		size := 0
+		for _, f := range files {
+			if info, err := os.Stat(f); err == nil {
+				size += int(info.Size())
+			}
+		}
+		return size == len(want[" foo.flac.ogg"])+len(want[" bar.flac.ogg"])
+	})
+	post(`{"out":{"recording":false}}`)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "out", "*"))
+	if len(files) != 2 {
+		t.Fatalf("got files %v; want 2 files", files)
+	}
+	for _, f := range files {
+		var suffix string
+		for k := range want {
+			if strings.HasSuffix(f, k) {
+				suffix = k
+			}
+		}
+		if got, err := os.ReadFile(f); err != nil || !bytes.Equal(got, want[suffix]) {
+			t.Errorf("got %s %q, %v; want %q, nil", f, got, err, want[suffix])
+		}
+	}
+}
+
+func TestOutputsStreamHandlerRecordingsUnsupported(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/flac")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	dir := t.TempDir()
+	h.SetRecordDirectory(dir)
+	w := httptest.NewRecorder()
+	h.ServeRecordings(w, httptest.NewRequest(http.MethodPost, "/api/music/outputs/stream/recordings", strings.NewReader(`{"out":{"recording":true}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d %s; want 400", w.Code, w.Body.String())
+	}
+	if got := h.Listeners()["out"]; got != 0 {
+		t.Errorf("got %d listeners; want 0", got)
+	}
+}
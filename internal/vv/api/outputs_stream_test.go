@@ -1,10 +1,16 @@
 package api_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/meiraka/vv/internal/log"
 	"github.com/meiraka/vv/internal/vv/api"
@@ -77,3 +83,295 @@ func TestOutputsStreamHandlerGET(t *testing.T) {
 	}
 
 }
+
+func TestOutputsStreamHandlerFanOut(t *testing.T) {
+	conns := make(chan chan string)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		data := make(chan string)
+		select {
+		case conns <- data:
+		case <-r.Context().Done():
+			return
+		}
+		for s := range data {
+			io.WriteString(w, s)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	listeners := func() string {
+		w := httptest.NewRecorder()
+		h.ServeListeners(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Body.String()
+	}
+	if got, want := listeners(), `{"out":0}`; got != want {
+		t.Errorf("got listeners %s; want %s", got, want)
+	}
+	var bodies []io.ReadCloser
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(ts.URL + "/?name=out")
+		if err != nil {
+			t.Fatalf("failed to get stream: %v", err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "audio/mpeg" {
+			t.Errorf("got Content-Type %q; want %q", ct, "audio/mpeg")
+		}
+		bodies = append(bodies, resp.Body)
+	}
+	if got, want := listeners(), `{"out":2}`; got != want {
+		t.Errorf("got listeners %s; want %s", got, want)
+	}
+	wantRead := func(want string) {
+		t.Helper()
+		for i, body := range bodies {
+			b := make([]byte, len(want))
+			if _, err := io.ReadFull(body, b); err != nil || string(b) != want {
+				t.Errorf("listener #%d got %q, %v; want %q, nil", i, b, err, want)
+			}
+		}
+	}
+	var data chan string
+	select {
+	case data = <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("upstream is not connected")
+	}
+	data <- "foo"
+	wantRead("foo")
+	select {
+	case <-conns:
+		t.Fatal("got second upstream connection; want shared one")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// reconnect
+	close(data)
+	select {
+	case data = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream is not reconnected")
+	}
+	data <- "bar"
+	wantRead("bar")
+	close(data)
+
+	for _, body := range bodies {
+		body.Close()
+	}
+	timeout := time.After(time.Second)
+	for {
+		if listeners() == `{"out":0}` {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("got listeners %s; want {\"out\":0}", listeners())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestOutputsStreamHandlerICY(t *testing.T) {
+	data := make(chan []byte)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case b := <-data:
+				w.Write(b)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	h.UpdateCurrentSong(map[string][]string{"file": {"foo/bar.flac"}, "Artist": {"baz", "qux"}, "Title": {"bar"}})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/?name=out", nil)
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to get stream: %v", err)
+	}
+	defer resp.Body.Close()
+	metaint, err := strconv.Atoi(resp.Header.Get("Icy-Metaint"))
+	if err != nil {
+		t.Fatalf("got Icy-Metaint %q; want number", resp.Header.Get("Icy-Metaint"))
+	}
+	for i, tt := range []struct {
+		song map[string][]string
+		want string
+	}{
+		{want: "StreamTitle='baz, qux - bar';"},
+		{want: ""},
+		{song: map[string][]string{"file": {"foo/notitle.flac"}}, want: "StreamTitle='notitle.flac';"},
+	} {
+		if tt.song != nil {
+			h.UpdateCurrentSong(tt.song)
+		}
+		// split audio data to check metadata position
+		data <- bytes.Repeat([]byte{'a'}, metaint-10)
+		data <- bytes.Repeat([]byte{'a'}, 10)
+		audio := make([]byte, metaint+1)
+		if _, err := io.ReadFull(resp.Body, audio); err != nil {
+			t.Fatalf("#%d: failed to read audio: %v", i, err)
+		}
+		if !bytes.Equal(audio[:metaint], bytes.Repeat([]byte{'a'}, metaint)) {
+			t.Errorf("#%d: got unexpected audio data", i)
+		}
+		meta := make([]byte, int(audio[metaint])*16)
+		if _, err := io.ReadFull(resp.Body, meta); err != nil {
+			t.Fatalf("#%d: failed to read metadata: %v", i, err)
+		}
+		if got := string(bytes.TrimRight(meta, "\x00")); got != tt.want {
+			t.Errorf("#%d: got metadata %q; want %q", i, got, tt.want)
+		}
+	}
+}
+
+// oggPage returns Ogg page; crc is not calculated.
+func oggPage(headerType byte, granule uint64, body string) []byte {
+	b := []byte("OggS\x00")
+	b = append(b, headerType)
+	b = binary.LittleEndian.AppendUint64(b, granule)
+	b = append(b, make([]byte, 12)...) // serial, sequence and crc
+	b = append(b, 1, byte(len(body)))
+	return append(b, body...)
+}
+
+func TestOutputsStreamHandlerJoinMidway(t *testing.T) {
+	contentType := "audio/ogg"
+	conns := make(chan chan []byte, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		data := make(chan []byte)
+		conns <- data
+		for {
+			select {
+			case b := <-data:
+				w.Write(b)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+	h, err := api.NewOutputsStreamHandler(map[string]string{"out": upstream.URL}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to init OutputsStreamHandler: %v", err)
+	}
+	defer h.Stop()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	get := func() io.ReadCloser {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/?name=out")
+		if err != nil {
+			t.Fatalf("failed to get stream: %v", err)
+		}
+		return resp.Body
+	}
+	read := func(body io.Reader, want []byte) {
+		t.Helper()
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(body, got); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("got %q, %v; want %q, nil", got, err, want)
+		}
+	}
+	recv := func() chan []byte {
+		t.Helper()
+		select {
+		case data := <-conns:
+			return data
+		case <-time.After(time.Second):
+			t.Fatal("upstream is not connected")
+		}
+		return nil
+	}
+	waitListeners := func(want string) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			w := httptest.NewRecorder()
+			h.ServeListeners(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Body.String() == want {
+				return
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("got listeners %s; want %s", w.Body.String(), want)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	t.Run("ogg", func(t *testing.T) {
+		first := get()
+		defer first.Close()
+		data := recv()
+		headers := append(oggPage(0x02, 0, "OpusHead"), oggPage(0, 0, "OpusTags")...)
+		audio := []byte{}
+		for i := 1; i <= 3; i++ {
+			audio = append(audio, oggPage(0, uint64(i*960), fmt.Sprintf("audio%d", i))...)
+		}
+		page := len(audio) / 3
+		data <- headers
+		data <- audio[:page]
+		read(first, append(append([]byte{}, headers...), audio[:page]...))
+		// partial page is not sent to listeners
+		data <- audio[page : page+page/2]
+
+		second := get()
+		defer second.Close()
+		waitListeners(`{"out":2}`)
+		select {
+		case <-conns:
+			t.Fatal("got second upstream connection; want shared one")
+		default:
+		}
+		data <- audio[page+page/2:]
+		read(first, audio[page:])
+		read(second, append(append([]byte{}, headers...), audio[page:]...))
+	})
+	waitListeners(`{"out":0}`)
+	t.Run("wav", func(t *testing.T) {
+		contentType = "audio/wav"
+		first := get()
+		defer first.Close()
+		data := recv()
+		data <- []byte("RIFFfoo")
+		read(first, []byte("RIFFfoo"))
+
+		// wav can not be shared with listener joined midway
+		second := get()
+		defer second.Close()
+		data2 := recv()
+		data2 <- []byte("RIFFbar")
+		read(second, []byte("RIFFbar"))
+		data <- []byte("baz")
+		read(first, []byte("baz"))
+	})
+}
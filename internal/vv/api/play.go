@@ -0,0 +1,230 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// playMaxThreshold is a max play time to record song as played.
+	playMaxThreshold = 4 * time.Minute
+	// playReplayMargin is a max distance from song start and end to detect repeated song.
+	playReplayMargin = 5 * time.Second
+)
+
+// Play represents a song playback.
+type Play struct {
+	Time      time.Time           `json:"time"` // playback start time
+	Song      map[string][]string `json:"song"`
+	Partition string              `json:"partition,omitempty"`
+	Outputs   []string            `json:"outputs,omitempty"`
+}
+
+// Scrobbler receives song playback events.
+// Methods are called in order of playback and should not block.
+type Scrobbler interface {
+	// NowPlaying is called when song starts playing.
+	NowPlaying(*Play)
+	// Scrobble is called once song has played for more than half its length or four minutes.
+	Scrobble(*Play)
+}
+
+// playState is a play time of current song.
+type playState struct {
+	key       string
+	play      *Play
+	threshold time.Duration
+	duration  time.Duration // zero if unknown
+	played    time.Duration // play time until last pause
+	resumed   time.Time     // zero if not playing
+	elapsed   time.Duration // song elapsed time at elapsedAt
+	elapsedAt time.Time
+	started   bool
+	scrobbled bool
+}
+
+func (s *playState) playTime(now time.Time) time.Duration {
+	if s.resumed.IsZero() {
+		return s.played
+	}
+	return s.played + now.Sub(s.resumed)
+}
+
+// position returns expected song elapsed time.
+func (s *playState) position(now time.Time) time.Duration {
+	if s.resumed.IsZero() {
+		return s.elapsed
+	}
+	return s.elapsed + now.Sub(s.elapsedAt)
+}
+
+// replayed returns true if song restarts from beginning after reaching its end; e.g. song is repeated by single mode.
+// other backward jumps are seek in current play.
+func (s *playState) replayed(status *Status, now time.Time) bool {
+	if status == nil || status.SongElapsed == nil || s.duration == 0 {
+		return false
+	}
+	margin := playReplayMargin
+	if m := s.duration / 4; m < margin {
+		margin = m
+	}
+	return songElapsed(status) < margin && s.position(now) >= s.duration-margin
+}
+
+// playTracker tracks play time of current song by mpd status and notifies playback events to scrobblers.
+type playTracker struct {
+	scrobblers []Scrobbler
+	state      *playState
+	timer      *time.Timer
+	closed     bool
+	mu         sync.Mutex
+}
+
+func newPlayTracker(scrobblers ...Scrobbler) *playTracker {
+	return &playTracker{scrobblers: scrobblers}
+}
+
+// Update updates current song status.
+// stops tracking current song if status or song is nil.
+func (t *playTracker) Update(status *Status, song map[string][]string, outputs []string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	var key string
+	if status != nil && len(song) != 0 {
+		key = songTag(song, "Id") + "\n" + songTag(song, "file")
+	}
+	if t.state != nil && (t.state.key != key || t.state.replayed(status, now)) {
+		t.stop(now)
+	}
+	if len(key) == 0 {
+		return
+	}
+	if t.state == nil {
+		start := now
+		if status.SongElapsed != nil {
+			start = now.Add(-songElapsed(status))
+		}
+		duration, _ := songDuration(song)
+		t.state = &playState{
+			key: key,
+			play: &Play{
+				Time:      start.UTC(),
+				Song:      song,
+				Partition: status.Partition,
+				Outputs:   outputs,
+			},
+			threshold: playThreshold(song),
+			duration:  duration,
+		}
+	}
+	if status.SongElapsed != nil {
+		t.state.elapsed, t.state.elapsedAt = songElapsed(status), now
+	}
+	playing := status.State != nil && *status.State == "play"
+	if playing && t.state.resumed.IsZero() {
+		t.state.resumed = now
+		if !t.state.started {
+			t.state.started = true
+			for _, s := range t.scrobblers {
+				s.NowPlaying(t.state.play)
+			}
+		}
+	} else if !playing && !t.state.resumed.IsZero() {
+		t.state.played = t.state.playTime(now)
+		t.state.resumed = time.Time{}
+	}
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if playing && !t.state.scrobbled {
+		remain := t.state.threshold - t.state.playTime(now)
+		if remain < 0 {
+			remain = 0
+		}
+		state := t.state
+		t.timer = time.AfterFunc(remain, func() { t.check(state) })
+	}
+}
+
+// stop stops tracking current song; scrobbles song if it has played enough.
+func (t *playTracker) stop(now time.Time) {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if !t.state.scrobbled && t.state.playTime(now) >= t.state.threshold {
+		t.scrobble(t.state)
+	}
+	t.state = nil
+}
+
+// check scrobbles state if it is current song and has played enough.
+func (t *playTracker) check(state *playState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.state != state || state.scrobbled || state.playTime(time.Now()) < state.threshold {
+		return
+	}
+	t.scrobble(state)
+}
+
+func (t *playTracker) scrobble(state *playState) {
+	state.scrobbled = true
+	for _, s := range t.scrobblers {
+		s.Scrobble(state.play)
+	}
+}
+
+// Close scrobbles current song if it has played enough and stops tracking.
+func (t *playTracker) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	if t.state != nil {
+		t.stop(time.Now())
+	}
+	t.closed = true
+}
+
+// playThreshold returns play time to scrobble song.
+func playThreshold(song map[string][]string) time.Duration {
+	d, ok := songDuration(song)
+	if !ok {
+		return playMaxThreshold
+	}
+	if t := d / 2; t < playMaxThreshold {
+		return t
+	}
+	return playMaxThreshold
+}
+
+// songElapsed returns status song elapsed time.
+func songElapsed(status *Status) time.Duration {
+	return time.Duration(*status.SongElapsed * float64(time.Second))
+}
+
+// songDuration returns song duration by duration or Time tag.
+func songDuration(song map[string][]string) (time.Duration, bool) {
+	d, err := strconv.ParseFloat(songTag(song, "duration"), 64)
+	if err != nil {
+		if d, err = strconv.ParseFloat(songTag(song, "Time"), 64); err != nil {
+			return 0, false
+		}
+	}
+	return time.Duration(d * float64(time.Second)), true
+}
+
+func songTag(song map[string][]string, key string) string {
+	if v, ok := song[key]; ok && len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
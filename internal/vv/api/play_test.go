@@ -0,0 +1,129 @@
+package api
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testScrobbler struct {
+	mu         sync.Mutex
+	nowPlaying []string
+	scrobbled  []string
+	changed    chan struct{}
+}
+
+func (s *testScrobbler) NowPlaying(p *Play) {
+	s.mu.Lock()
+	s.nowPlaying = append(s.nowPlaying, songTag(p.Song, "file"))
+	s.mu.Unlock()
+}
+
+func (s *testScrobbler) Scrobble(p *Play) {
+	s.mu.Lock()
+	s.scrobbled = append(s.scrobbled, songTag(p.Song, "file"))
+	s.mu.Unlock()
+	s.changed <- struct{}{}
+}
+
+func (s *testScrobbler) get() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.nowPlaying...), append([]string{}, s.scrobbled...)
+}
+
+func TestPlayTracker(t *testing.T) {
+	song := func(id, file, duration string) map[string][]string {
+		return map[string][]string{"Id": {id}, "file": {file}, "duration": {duration}}
+	}
+	status := func(state string) *Status {
+		elapsed := 0.0
+		return &Status{State: &state, SongElapsed: &elapsed}
+	}
+	s := &testScrobbler{changed: make(chan struct{}, 10)}
+	tracker := newPlayTracker(s)
+	defer tracker.Close()
+
+	tracker.Update(status("pause"), song("1", "paused.flac", "0.1"), nil)
+	time.Sleep(200 * time.Millisecond)
+	tracker.Update(status("play"), song("2", "played.flac", "0.1"), nil)
+	select {
+	case <-s.changed:
+	case <-time.After(time.Second):
+		t.Fatalf("got no scrobble event for played song")
+	}
+	// song is scrobbled once
+	tracker.Update(status("pause"), song("2", "played.flac", "0.1"), nil)
+	tracker.Update(status("play"), song("2", "played.flac", "0.1"), nil)
+	tracker.Update(status("play"), song("3", "skipped.flac", "60"), nil)
+	tracker.Update(nil, nil, nil)
+	nowPlaying, scrobbled := s.get()
+	if want := []string{"played.flac", "skipped.flac"}; len(nowPlaying) != len(want) || nowPlaying[0] != want[0] || nowPlaying[1] != want[1] {
+		t.Errorf("got now playing %v; want %v", nowPlaying, want)
+	}
+	if len(scrobbled) != 1 || scrobbled[0] != "played.flac" {
+		t.Errorf("got scrobbled %v; want [played.flac]", scrobbled)
+	}
+}
+
+func TestPlayTrackerRepeat(t *testing.T) {
+	status := func(elapsed float64) *Status {
+		state := "play"
+		return &Status{State: &state, SongElapsed: &elapsed}
+	}
+	wait := func(t *testing.T, s *testScrobbler) {
+		t.Helper()
+		select {
+		case <-s.changed:
+		case <-time.After(time.Second):
+			t.Fatalf("got no scrobble event")
+		}
+	}
+	t.Run("repeat", func(t *testing.T) {
+		song := map[string][]string{"Id": {"1"}, "file": {"repeat.flac"}, "duration": {"0.1"}}
+		s := &testScrobbler{changed: make(chan struct{}, 10)}
+		tracker := newPlayTracker(s)
+		defer tracker.Close()
+		tracker.Update(status(0), song, nil)
+		wait(t, s)
+		time.Sleep(100 * time.Millisecond)
+		// restarts from beginning by single mode
+		tracker.Update(status(0), song, nil)
+		wait(t, s)
+		nowPlaying, scrobbled := s.get()
+		if len(nowPlaying) != 2 || len(scrobbled) != 2 {
+			t.Errorf("got now playing %v, scrobbled %v; want 2 repeat.flac for both", nowPlaying, scrobbled)
+		}
+	})
+	t.Run("seek", func(t *testing.T) {
+		song := map[string][]string{"Id": {"1"}, "file": {"seek.flac"}, "duration": {"0.4"}}
+		s := &testScrobbler{changed: make(chan struct{}, 10)}
+		tracker := newPlayTracker(s)
+		tracker.Update(status(0), song, nil)
+		wait(t, s)
+		// seeks to beginning after scrobbled
+		tracker.Update(status(0), song, nil)
+		time.Sleep(300 * time.Millisecond)
+		tracker.Close()
+		nowPlaying, scrobbled := s.get()
+		if len(nowPlaying) != 1 || len(scrobbled) != 1 {
+			t.Errorf("got now playing %v, scrobbled %v; want 1 seek.flac for both", nowPlaying, scrobbled)
+		}
+	})
+}
+
+func TestPlayThreshold(t *testing.T) {
+	for _, tt := range []struct {
+		song map[string][]string
+		want time.Duration
+	}{
+		{song: map[string][]string{"duration": {"200.5"}}, want: 100250 * time.Millisecond},
+		{song: map[string][]string{"Time": {"180"}}, want: 90 * time.Second},
+		{song: map[string][]string{"duration": {"3600"}}, want: playMaxThreshold},
+		{song: map[string][]string{}, want: playMaxThreshold},
+	} {
+		if got := playThreshold(tt.song); got != tt.want {
+			t.Errorf("playThreshold(%v) = %v; want %v", tt.song, got, tt.want)
+		}
+	}
+}
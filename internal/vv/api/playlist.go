@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"sync"
 	"time"
@@ -32,6 +33,8 @@ type PlaylistHandler struct {
 	mu          sync.RWMutex
 	sem         chan struct{}
 	config      *Config
+	snapshot    func(context.Context) error
+	playing     bool
 }
 
 type MPDPlaylist interface {
@@ -55,6 +58,14 @@ func NewPlaylistHandler(mpd MPDPlaylist, config *Config) (*PlaylistHandler, erro
 	}, nil
 }
 
+// SetSnapshotHook sets function to take snapshot of playlist before replacing it.
+// playlist is not replaced if f returns error.
+func (a *PlaylistHandler) SetSnapshotHook(f func(context.Context) error) {
+	a.mu.Lock()
+	a.snapshot = f
+	a.mu.Unlock()
+}
+
 func (a *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		a.cache.ServeHTTP(w, r)
@@ -79,17 +90,7 @@ func (a *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.mu.Lock()
-	librarySort, filters, newpos := songs.WeakFilterSort(a.library, req.Sort, req.Filters, req.Must, 9999, *req.Current)
-	a.librarySort = librarySort
-	update := !songs.SortEqual(a.playlist, a.librarySort)
-	a.mu.Unlock()
-	cl := &mpd.CommandList{}
-	cl.Clear()
-	for i := range a.librarySort {
-		cl.Add(a.librarySort[i]["file"][0])
-	}
-	cl.Play(newpos)
+	cl, filters, newpos, update, snapshot := a.commands(&req)
 	if !update {
 		defer func() { a.sem <- struct{}{} }()
 		a.updateSort(req.Sort, filters, req.Must)
@@ -112,13 +113,88 @@ func (a *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		defer func() { a.sem <- struct{}{} }()
 		ctx, cancel := context.WithTimeout(context.Background(), a.config.BackgroundTimeout)
 		defer cancel()
+		if snapshot != nil {
+			if err := snapshot(ctx); err != nil {
+				a.config.Logger.Errorw("vv/api: failed to take playlist snapshot", requestFields(r, "error", err)...)
+				return
+			}
+		}
 		if err := a.mpd.ExecCommandList(ctx, cl); err != nil {
+			a.config.Logger.Errorw("vv/api: failed to update playlist", requestFields(r, "error", err)...)
 			return
 		}
 		a.updateSort(req.Sort, filters, req.Must)
 	}()
 }
 
+// Exclusive runs f while no other playlist update is running.
+func (a *PlaylistHandler) Exclusive(ctx context.Context, f func(context.Context) error) error {
+	select {
+	case <-a.sem:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { a.sem <- struct{}{} }()
+	return f(ctx)
+}
+
+// Sort replaces playlist by library songs sorted by sort and filters and plays song at pos in sorted songs.
+func (a *PlaylistHandler) Sort(ctx context.Context, sort []string, filters [][2]*string, must, pos int) error {
+	select {
+	case <-a.sem:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { a.sem <- struct{}{} }()
+	req := &httpPlaylistInfo{Current: &pos, Sort: sort, Filters: filters, Must: must}
+	cl, filters, newpos, update, snapshot := a.commands(req)
+	if !update {
+		if err := a.mpd.Play(ctx, newpos); err != nil {
+			return err
+		}
+	} else {
+		if snapshot != nil {
+			if err := snapshot(ctx); err != nil {
+				return err
+			}
+		}
+		if err := a.mpd.ExecCommandList(ctx, cl); err != nil {
+			return err
+		}
+	}
+	a.updateSort(sort, filters, must)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err := a.cache.SetIfModified(a.data)
+	return err
+}
+
+// commands sorts library songs by req and returns commands to replace playlist.
+func (a *PlaylistHandler) commands(req *httpPlaylistInfo) (cl *mpd.CommandList, filters [][2]*string, newpos int, update bool, snapshot func(context.Context) error) {
+	a.mu.Lock()
+	var librarySort []map[string][]string
+	librarySort, filters, newpos = songs.WeakFilterSort(a.library, req.Sort, req.Filters, req.Must, math.MaxInt, *req.Current)
+	a.librarySort = librarySort
+	update = !songs.SortEqual(a.playlist, a.librarySort)
+	snapshot = a.snapshot
+	cl = &mpd.CommandList{}
+	if !update {
+		a.mu.Unlock()
+		return
+	}
+	cur := -1
+	if a.data.Current != nil {
+		cur = *a.data.Current
+	}
+	from, to, playing := songFiles(a.playlist), songFiles(librarySort), a.playing
+	a.mu.Unlock()
+	// keeps current song to avoid interrupting playback
+	if keep := playlistEdit(cl, from, cur, to, newpos); !keep || !playing {
+		cl.Play(newpos)
+	}
+	return
+}
+
 func (a *PlaylistHandler) UpdateCurrent(pos int) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -136,6 +212,13 @@ func (a *PlaylistHandler) UpdateCurrent(pos int) error {
 	return nil
 }
 
+// UpdatePlaying sets mpd player state to keep current song playing while updating playlist.
+func (a *PlaylistHandler) UpdatePlaying(playing bool) {
+	a.mu.Lock()
+	a.playing = playing
+	a.mu.Unlock()
+}
+
 func (a *PlaylistHandler) updateSort(sort []string, filters [][2]*string, must int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -161,6 +244,16 @@ func (a *PlaylistHandler) UpdatePlaylistSongs(i []map[string][]string) {
 	}
 }
 
+func songFiles(s []map[string][]string) []string {
+	ret := make([]string, len(s))
+	for i := range s {
+		if f := s[i]["file"]; len(f) != 0 {
+			ret[i] = f[0]
+		}
+	}
+	return ret
+}
+
 func (a *PlaylistHandler) UpdateLibrarySongs(i []map[string][]string) {
 	a.mu.Lock()
 	a.library = songs.Copy(i)
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/meiraka/vv/internal/mpd"
+)
+
+// playlistEditMinOps is a number of edit commands always allowed regardless of playlist length.
+const playlistEditMinOps = 16
+
+// playlistEdit appends delete, move and addid commands to cl to change playlist from to to.
+// song at cur in from is kept untouched if it equals to[newpos]. playlistEdit reports whether it is kept.
+// playlistEdit replaces all songs instead if edit commands are more than about half of to.
+func playlistEdit(cl *mpd.CommandList, from []string, cur int, to []string, newpos int) bool {
+	keep := cur >= 0 && cur < len(from) && newpos >= 0 && newpos < len(to) && from[cur] == to[newpos]
+
+	// match songs in from to songs in to by file
+	targets := map[string][]int{}
+	for i := range to {
+		if keep && i == newpos {
+			continue
+		}
+		targets[to[i]] = append(targets[to[i]], i)
+	}
+	match := make([]int, len(from))
+	for i := range from {
+		if keep && i == cur {
+			match[i] = newpos
+			continue
+		}
+		if t := targets[from[i]]; len(t) != 0 {
+			match[i] = t[0]
+			targets[from[i]] = t[1:]
+		} else {
+			match[i] = -1
+		}
+	}
+
+	var ops []func(*mpd.CommandList)
+	// delete unmatched songs from the end to keep positions
+	for end := len(from); end > 0; {
+		if match[end-1] != -1 {
+			end--
+			continue
+		}
+		start := end - 1
+		for start > 0 && match[start-1] == -1 {
+			start--
+		}
+		s, e := start, end
+		ops = append(ops, func(cl *mpd.CommandList) { cl.Delete(s, e) })
+		end = start
+	}
+	q := make([]int, 0, len(to))
+	anchor := -1
+	for i := range match {
+		if match[i] == -1 {
+			continue
+		}
+		if keep && i == cur {
+			anchor = len(q)
+		}
+		q = append(q, match[i])
+	}
+
+	// songs in the longest increasing subsequence stay in place; others are moved
+	fixed := make([]bool, len(to))
+	for _, i := range longestIncreasingWith(q, anchor) {
+		fixed[q[i]] = true
+	}
+
+	// each song is placed right after the previous song in to, so moved and added songs are
+	// lined up behind the nearest preceding fixed song. slots are laid out in final order:
+	// songs following the head of playlist, then each song in q followed by songs following it.
+	// positions are counted by occupied slots.
+	index := make([]int, len(to)) // index in q by song in to
+	for i := range index {
+		index[i] = -1
+	}
+	for k, i := range q {
+		index[i] = k
+	}
+	following := make([][]int, len(to)+1) // songs following fixed song i at following[i+1]
+	last := -1
+	for i := range to {
+		if index[i] != -1 && fixed[i] {
+			last = i
+			continue
+		}
+		following[last+1] = append(following[last+1], i)
+	}
+	n := 0
+	newSlot := make([]int, len(to))
+	oldSlot := make([]int, len(q))
+	layout := func(i int) {
+		for _, j := range following[i+1] {
+			newSlot[j] = n
+			n++
+		}
+	}
+	layout(-1)
+	for k, i := range q {
+		oldSlot[k] = n
+		n++
+		if fixed[i] {
+			layout(i)
+		}
+	}
+	slots := make(fenwick, n)
+	for k := range q {
+		slots.add(oldSlot[k], 1)
+	}
+	for i := range to {
+		k := index[i]
+		if k != -1 && fixed[i] {
+			continue
+		}
+		if k == -1 {
+			p, file := slots.sum(newSlot[i]), to[i]
+			ops = append(ops, func(cl *mpd.CommandList) { cl.AddID(file, p) })
+			slots.add(newSlot[i], 1)
+			continue
+		}
+		j := slots.sum(oldSlot[k])
+		slots.add(oldSlot[k], -1)
+		p := slots.sum(newSlot[i])
+		slots.add(newSlot[i], 1)
+		if j != p {
+			ops = append(ops, func(cl *mpd.CommandList) { cl.Move(j, p) })
+		}
+	}
+
+	if len(ops) > playlistEditMinOps && len(ops) > len(to)/2 {
+		playlistReplace(cl, len(from), cur, to, newpos, keep)
+		return keep
+	}
+	for _, op := range ops {
+		op(cl)
+	}
+	return keep
+}
+
+// playlistReplace appends commands to cl to replace all songs by to; keeps song at cur if keep is true.
+func playlistReplace(cl *mpd.CommandList, length, cur int, to []string, newpos int, keep bool) {
+	if !keep {
+		cl.Clear()
+		for i := range to {
+			cl.Add(to[i])
+		}
+		return
+	}
+	if cur+1 < length {
+		cl.Delete(cur+1, length)
+	}
+	if cur > 0 {
+		cl.Delete(0, cur)
+	}
+	for i := range to {
+		if i != newpos {
+			cl.AddID(to[i], i)
+		}
+	}
+}
+
+// fenwick is a binary indexed tree to count occupied slots.
+type fenwick []int
+
+// add adds v to slot i.
+func (f fenwick) add(i, v int) {
+	for i++; i <= len(f); i += i & -i {
+		f[i-1] += v
+	}
+}
+
+// sum returns total of slots before i.
+func (f fenwick) sum(i int) int {
+	ret := 0
+	for ; i > 0; i -= i & -i {
+		ret += f[i-1]
+	}
+	return ret
+}
+
+// longestIncreasingWith returns indexes of the longest increasing subsequence of s including s[at].
+// at is ignored if it is out of range.
+func longestIncreasingWith(s []int, at int) []int {
+	if at < 0 || at >= len(s) {
+		return longestIncreasing(s, nil)
+	}
+	before, after := []int{}, []int{}
+	for i := range s {
+		if i < at && s[i] < s[at] {
+			before = append(before, i)
+		} else if i > at && s[i] > s[at] {
+			after = append(after, i)
+		}
+	}
+	ret := longestIncreasing(s, before)
+	ret = append(ret, at)
+	return append(ret, longestIncreasing(s, after)...)
+}
+
+// longestIncreasing returns indexes of the longest increasing subsequence of s limited to indexes idx.
+// all indexes are used if idx is nil.
+func longestIncreasing(s []int, idx []int) []int {
+	if idx == nil {
+		idx = make([]int, len(s))
+		for i := range idx {
+			idx[i] = i
+		}
+	}
+	// tails[k] is a position in idx of the smallest tail of increasing subsequences with length k+1
+	tails := []int{}
+	parent := make([]int, len(idx))
+	for i := range idx {
+		v := s[idx[i]]
+		k := sort.Search(len(tails), func(k int) bool { return s[idx[tails[k]]] >= v })
+		if k > 0 {
+			parent[i] = tails[k-1]
+		} else {
+			parent[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	ret := make([]int, len(tails))
+	if len(tails) == 0 {
+		return ret
+	}
+	for i, k := tails[len(tails)-1], len(tails)-1; k >= 0; i, k = parent[i], k-1 {
+		ret[k] = idx[i]
+	}
+	return ret
+}
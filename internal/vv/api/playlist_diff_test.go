@@ -0,0 +1,128 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/meiraka/vv/internal/mpd"
+)
+
+func TestPlaylistEdit(t *testing.T) {
+	songs := func(prefix string, n int) []string {
+		ret := make([]string, n)
+		for i := range ret {
+			ret[i] = prefix + strconv.Itoa(i)
+		}
+		return ret
+	}
+	reversed := func(s []string) []string {
+		ret := make([]string, len(s))
+		for i := range s {
+			ret[len(s)-1-i] = s[i]
+		}
+		return ret
+	}
+	large := songs("a", 1000)
+	for label, tt := range map[string]struct {
+		from     []string
+		cur      int
+		to       []string
+		newpos   int
+		want     func(*mpd.CommandList)
+		wantKeep bool
+	}{
+		"add": {
+			from: []string{}, cur: -1,
+			to: []string{"a", "b"}, newpos: 0,
+			want: func(cl *mpd.CommandList) {
+				cl.AddID("a", 0)
+				cl.AddID("b", 1)
+			},
+		},
+		"move": {
+			from: []string{"a", "b", "c", "d"}, cur: -1,
+			to: []string{"b", "c", "d", "a"}, newpos: 3,
+			want: func(cl *mpd.CommandList) {
+				cl.Move(0, 3)
+			},
+		},
+		"move backward": {
+			from: []string{"c", "a", "b"}, cur: 1,
+			to: []string{"a", "b", "c"}, newpos: 1,
+			want: func(cl *mpd.CommandList) {
+				cl.Move(0, 2)
+			},
+		},
+		"keep current": {
+			from: []string{"a", "b", "c", "d"}, cur: 0,
+			to: []string{"b", "c", "d", "a"}, newpos: 3,
+			want: func(cl *mpd.CommandList) {
+				cl.Move(1, 0)
+				cl.Move(2, 1)
+				cl.Move(3, 2)
+			},
+			wantKeep: true,
+		},
+		"delete and add": {
+			from: []string{"a", "x", "b", "y", "z"}, cur: 2,
+			to: []string{"a", "b", "c"}, newpos: 1,
+			want: func(cl *mpd.CommandList) {
+				cl.Delete(3, 5)
+				cl.Delete(1, 2)
+				cl.AddID("c", 2)
+			},
+			wantKeep: true,
+		},
+		"duplicated": {
+			from: []string{"a", "a", "b"}, cur: 1,
+			to: []string{"b", "a"}, newpos: 0,
+			want: func(cl *mpd.CommandList) {
+				cl.Delete(1, 2)
+				cl.Move(0, 1)
+			},
+		},
+		"large": {
+			from: large, cur: 500,
+			to: append(append([]string{large[999], "b"}, large[:500]...), large[500:999]...), newpos: 502,
+			want: func(cl *mpd.CommandList) {
+				cl.Move(999, 0)
+				cl.AddID("b", 1)
+			},
+			wantKeep: true,
+		},
+		"replace": {
+			from: songs("a", 40), cur: 5,
+			to: reversed(songs("a", 40)), newpos: 0,
+			want: func(cl *mpd.CommandList) {
+				cl.Clear()
+				for _, s := range reversed(songs("a", 40)) {
+					cl.Add(s)
+				}
+			},
+		},
+		"replace and keep current": {
+			from: songs("a", 40), cur: 5,
+			to: reversed(songs("a", 40)), newpos: 34,
+			want: func(cl *mpd.CommandList) {
+				cl.Delete(6, 40)
+				cl.Delete(0, 5)
+				for i, s := range reversed(songs("a", 40)) {
+					if i != 34 {
+						cl.AddID(s, i)
+					}
+				}
+			},
+			wantKeep: true,
+		},
+	} {
+		t.Run(label, func(t *testing.T) {
+			got := &mpd.CommandList{}
+			keep := playlistEdit(got, tt.from, tt.cur, tt.to, tt.newpos)
+			want := &mpd.CommandList{}
+			tt.want(want)
+			if !mpd.CommandListEqual(got, want) || keep != tt.wantKeep {
+				t.Errorf("playlistEdit got\n%v, %v; want\n%v, %v", got, keep, want, tt.wantKeep)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/mpd"
+)
+
+// playlistSnapshotLimit is a max number of playlist snapshots.
+const playlistSnapshotLimit = 10
+
+type httpPlaylistSnapshot struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Songs   int       `json:"songs"`
+	Current *int      `json:"current,omitempty"`
+	Elapsed float64   `json:"elapsed"`
+	State   string    `json:"state,omitempty"`
+}
+
+type httpPlaylistSnapshotRestore struct {
+	ID *int `json:"id"`
+}
+
+type playlistSnapshot struct {
+	info  *httpPlaylistSnapshot
+	files []string
+}
+
+type MPDPlaylistSnapshots interface {
+	Status(context.Context) (map[string]string, error)
+	ExecCommandList(context.Context, *mpd.CommandList) error
+}
+
+// PlaylistSnapshotsHandler keeps snapshots of playlist before replacing it and restores them.
+//
+//	GET /api/music/playlist/snapshots: lists snapshots ordered by newest first
+//	POST /api/music/playlist/snapshots {"id": 1}: restores playlist and resumes playback
+type PlaylistSnapshotsHandler struct {
+	mpd      MPDPlaylistSnapshots
+	cache    *cache
+	playlist []string
+	stack    []*playlistSnapshot
+	nextID   int
+	mu       sync.Mutex
+	lock     func(context.Context, func(context.Context) error) error
+}
+
+func NewPlaylistSnapshotsHandler(mpd MPDPlaylistSnapshots) (*PlaylistSnapshotsHandler, error) {
+	c, err := newCache([]*httpPlaylistSnapshot{})
+	if err != nil {
+		return nil, err
+	}
+	return &PlaylistSnapshotsHandler{
+		mpd:    mpd,
+		cache:  c,
+		nextID: 1,
+	}, nil
+}
+
+// SetPlaylistLockHook sets function to restore playlist exclusively with other playlist updates.
+func (a *PlaylistSnapshotsHandler) SetPlaylistLockHook(f func(context.Context, func(context.Context) error) error) {
+	a.mu.Lock()
+	a.lock = f
+	a.mu.Unlock()
+}
+
+// UpdatePlaylistSongs sets current playlist songs to take snapshot.
+func (a *PlaylistSnapshotsHandler) UpdatePlaylistSongs(i []map[string][]string) {
+	files := make([]string, 0, len(i))
+	for _, s := range i {
+		if f, ok := s["file"]; ok && len(f) != 0 {
+			files = append(files, f[0])
+		}
+	}
+	a.mu.Lock()
+	a.playlist = files
+	a.mu.Unlock()
+}
+
+// Save takes snapshot of current playlist, song position and elapsed time.
+// empty playlist is ignored.
+func (a *PlaylistSnapshotsHandler) Save(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.save(ctx)
+}
+
+func (a *PlaylistSnapshotsHandler) save(ctx context.Context) error {
+	if len(a.playlist) == 0 {
+		return nil
+	}
+	s, err := a.mpd.Status(ctx)
+	if err != nil {
+		return err
+	}
+	info := &httpPlaylistSnapshot{
+		ID:    a.nextID,
+		Time:  time.Now().UTC(),
+		Songs: len(a.playlist),
+		State: s["state"],
+	}
+	if pos, err := strconv.Atoi(s["song"]); err == nil {
+		info.Current = &pos
+		if elapsed, err := strconv.ParseFloat(s["elapsed"], 64); err == nil {
+			info.Elapsed = elapsed
+		}
+	}
+	a.nextID++
+	a.stack = append(a.stack, &playlistSnapshot{info: info, files: a.playlist})
+	if len(a.stack) > playlistSnapshotLimit {
+		a.stack = a.stack[len(a.stack)-playlistSnapshotLimit:]
+	}
+	return a.updateCache()
+}
+
+func (a *PlaylistSnapshotsHandler) updateCache() error {
+	data := make([]*httpPlaylistSnapshot, len(a.stack))
+	for i := range a.stack {
+		data[len(a.stack)-1-i] = a.stack[i].info
+	}
+	_, err := a.cache.SetIfModified(data)
+	return err
+}
+
+func (a *PlaylistSnapshotsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.cache.ServeHTTP(w, r)
+		return
+	}
+	var req httpPlaylistSnapshotRestore
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.ID == nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("id field is required"))
+		return
+	}
+	a.mu.Lock()
+	lock := a.lock
+	a.mu.Unlock()
+	var now time.Time
+	restore := func(ctx context.Context) (err error) {
+		now, err = a.restore(ctx, *req.ID)
+		return err
+	}
+	var err error
+	if lock != nil {
+		err = lock(r.Context(), restore)
+	} else {
+		err = restore(r.Context())
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errPlaylistSnapshotNotFound) {
+			status = http.StatusNotFound
+		}
+		writeHTTPError(w, status, err)
+		return
+	}
+	r.Method = http.MethodGet
+	a.cache.ServeHTTP(w, setUpdateTime(r, now))
+}
+
+var errPlaylistSnapshotNotFound = errors.New("snapshot not found")
+
+func (a *PlaylistSnapshotsHandler) restore(ctx context.Context, id int) (time.Time, error) {
+	a.mu.Lock()
+	var s *playlistSnapshot
+	for i := range a.stack {
+		if a.stack[i].info.ID == id {
+			s = a.stack[i]
+		}
+	}
+	if s == nil {
+		a.mu.Unlock()
+		return time.Time{}, fmt.Errorf("%w: %d", errPlaylistSnapshotNotFound, id)
+	}
+	// take snapshot of current playlist to undo restoring
+	if err := a.save(ctx); err != nil {
+		a.mu.Unlock()
+		return time.Time{}, err
+	}
+	a.mu.Unlock()
+	cl := &mpd.CommandList{}
+	cl.Clear()
+	for i := range s.files {
+		cl.Add(s.files[i])
+	}
+	if s.info.Current != nil && *s.info.Current < len(s.files) && s.info.State != "stop" {
+		cl.Seek(*s.info.Current, s.info.Elapsed)
+		if s.info.State == "pause" {
+			cl.Pause(true)
+		}
+	}
+	now := time.Now().UTC()
+	return now, a.mpd.ExecCommandList(ctx, cl)
+}
+
+// Changed returns snapshot list update event chan.
+func (a *PlaylistSnapshotsHandler) Changed() <-chan struct{} {
+	return a.cache.Changed()
+}
+
+// Close closes update event chan.
+func (a *PlaylistSnapshotsHandler) Close() {
+	a.cache.Close()
+}
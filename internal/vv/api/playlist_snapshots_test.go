@@ -0,0 +1,175 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meiraka/vv/internal/mpd"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+type mpdPlaylistSnapshots struct {
+	t               *testing.T
+	status          func() (map[string]string, error)
+	execCommandList func(*testing.T, *mpd.CommandList) error
+}
+
+func (m *mpdPlaylistSnapshots) Status(context.Context) (map[string]string, error) {
+	m.t.Helper()
+	if m.status == nil {
+		m.t.Fatal("no Status mock function")
+	}
+	return m.status()
+}
+
+func (m *mpdPlaylistSnapshots) ExecCommandList(ctx context.Context, i *mpd.CommandList) error {
+	m.t.Helper()
+	if m.execCommandList == nil {
+		m.t.Fatal("no ExecCommandList mock function")
+	}
+	return m.execCommandList(m.t, i)
+}
+
+type testPlaylistSnapshot struct {
+	ID      int     `json:"id"`
+	Songs   int     `json:"songs"`
+	Current *int    `json:"current"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+func getPlaylistSnapshots(t *testing.T, h http.Handler) []*testPlaylistSnapshot {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var ret []*testPlaylistSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatalf("failed to parse json %s: %v", w.Body.String(), err)
+	}
+	return ret
+}
+
+func TestPlaylistSnapshotsHandler(t *testing.T) {
+	m := &mpdPlaylistSnapshots{t: t}
+	h, err := api.NewPlaylistSnapshotsHandler(m)
+	if err != nil {
+		t.Fatalf("NewPlaylistSnapshotsHandler got error %v; want nil", err)
+	}
+	defer h.Close()
+	ctx := context.TODO()
+
+	// empty playlist is ignored
+	if err := h.Save(ctx); err != nil {
+		t.Errorf("Save got error %v; want nil", err)
+	}
+	if got := getPlaylistSnapshots(t, h); len(got) != 0 {
+		t.Errorf("got %d snapshots for empty playlist; want 0", len(got))
+	}
+
+	m.status = func() (map[string]string, error) { return map[string]string{"song": "1", "elapsed": "12.5"}, nil }
+	h.UpdatePlaylistSongs(testSongs[:2])
+	if err := h.Save(ctx); err != nil {
+		t.Fatalf("Save got error %v; want nil", err)
+	}
+	if !recieveMsg(h.Changed()) {
+		t.Errorf("got no changed event after Save")
+	}
+	got := getPlaylistSnapshots(t, h)
+	if len(got) != 1 || got[0].ID != 1 || got[0].Songs != 2 || got[0].Current == nil || *got[0].Current != 1 || got[0].Elapsed != 12.5 {
+		t.Fatalf("got %+v; want id 1, 2 songs at 1: 12.5", got)
+	}
+
+	// restore takes snapshot of current playlist and resumes playback
+	h.UpdatePlaylistSongs(testSongs[2:])
+	m.status = func() (map[string]string, error) { return map[string]string{}, nil }
+	m.execCommandList = func(t *testing.T, got *mpd.CommandList) error {
+		t.Helper()
+		want := &mpd.CommandList{}
+		want.Clear()
+		want.Add("/foo/bar.mp3")
+		want.Add("/foo/foo.mp3")
+		want.Seek(1, 12.5)
+		if !mpd.CommandListEqual(got, want) {
+			t.Errorf("call mpd.ExecCommandList(ctx,\n%v); want mpd.ExecCommandList(ctx,\n%v)", got, want)
+		}
+		return nil
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1}`)))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("POST got status %d %s; want %d", w.Code, w.Body.String(), http.StatusAccepted)
+	}
+	if got := getPlaylistSnapshots(t, h); len(got) != 2 || got[0].ID != 2 || got[0].Current != nil || got[1].ID != 1 {
+		t.Errorf("got %+v; want id 2 and 1", got)
+	}
+
+	for body, status := range map[string]int{
+		`{"id":100}`: http.StatusNotFound,
+		`{}`:         http.StatusBadRequest,
+		`invalid`:    http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != status {
+			t.Errorf("POST %s got status %d; want %d", body, w.Code, status)
+		}
+	}
+
+	// restore keeps paused and stopped state exclusively with playlist updates
+	var locked int
+	h.SetPlaylistLockHook(func(ctx context.Context, f func(context.Context) error) error {
+		locked++
+		return f(ctx)
+	})
+	for _, tt := range []struct {
+		state string
+		id    int
+		want  func(*mpd.CommandList)
+	}{
+		{state: "pause", id: 3, want: func(cl *mpd.CommandList) { cl.Seek(0, 3); cl.Pause(true) }},
+		{state: "stop", id: 5, want: func(*mpd.CommandList) {}},
+	} {
+		t.Run(tt.state, func(t *testing.T) {
+			m.status = func() (map[string]string, error) {
+				return map[string]string{"song": "0", "elapsed": "3", "state": tt.state}, nil
+			}
+			if err := h.Save(ctx); err != nil {
+				t.Fatalf("Save got error %v; want nil", err)
+			}
+			m.execCommandList = func(t *testing.T, got *mpd.CommandList) error {
+				t.Helper()
+				want := &mpd.CommandList{}
+				want.Clear()
+				want.Add("/baz/qux.mp3")
+				want.Add("/baz/baz.mp3")
+				tt.want(want)
+				if !mpd.CommandListEqual(got, want) {
+					t.Errorf("call mpd.ExecCommandList(ctx,\n%v); want mpd.ExecCommandList(ctx,\n%v)", got, want)
+				}
+				return nil
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(fmt.Sprintf(`{"id":%d}`, tt.id))))
+			if w.Code != http.StatusAccepted {
+				t.Errorf("POST got status %d %s; want %d", w.Code, w.Body.String(), http.StatusAccepted)
+			}
+		})
+	}
+	if locked != 2 {
+		t.Errorf("got %d playlist lock hook calls; want 2", locked)
+	}
+
+	// snapshots are bounded
+	for i := 0; i < 20; i++ {
+		if err := h.Save(ctx); err != nil {
+			t.Fatalf("Save got error %v; want nil", err)
+		}
+	}
+	if got := getPlaylistSnapshots(t, h); len(got) != 10 || got[0].ID != 26 {
+		t.Errorf("got %d snapshots, latest %d; want 10 snapshots, latest 26", len(got), got[0].ID)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"sync"
 )
@@ -38,7 +39,19 @@ func (a *PlaylistSongsHandler) Update(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	v := a.songsHook(l)
+	return a.set(a.songsHook(l))
+}
+
+// restore sets json snapshot as playlist songs.
+func (a *PlaylistSongsHandler) restore(b []byte) error {
+	var v []map[string][]string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return a.set(v)
+}
+
+func (a *PlaylistSongsHandler) set(v []map[string][]string) error {
 	changed, err := a.cache.SetIfModified(v)
 	if err != nil {
 		return err
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/meiraka/vv/internal/log"
 	"github.com/meiraka/vv/internal/mpd"
 	"github.com/meiraka/vv/internal/songs"
 	"github.com/meiraka/vv/internal/vv/api"
@@ -29,6 +30,7 @@ func TestPlaylistHandler(t *testing.T) {
 		library    []map[string][]string
 		playlist   []map[string][]string
 		pos        *int
+		playing    bool
 		want       string
 		wantStatus int
 		mpd        *mpdPlaylist
@@ -54,11 +56,10 @@ func TestPlaylistHandler(t *testing.T) {
 			mpd: &mpdPlaylist{
 				execCommandList: func(t *testing.T, got *mpd.CommandList) error {
 					want := &mpd.CommandList{}
-					want.Clear()
-					want.Add("/baz/baz.mp3")
-					want.Add("/baz/qux.mp3")
-					want.Add("/foo/bar.mp3")
-					want.Add("/foo/foo.mp3")
+					want.AddID("/baz/baz.mp3", 0)
+					want.AddID("/baz/qux.mp3", 1)
+					want.AddID("/foo/bar.mp3", 2)
+					want.AddID("/foo/foo.mp3", 3)
 					want.Play(1)
 					t.Helper()
 					if !mpd.CommandListEqual(got, want) {
@@ -82,6 +83,29 @@ func TestPlaylistHandler(t *testing.T) {
 			want:       `{"current":1}`,
 			wantStatus: http.StatusOK,
 		}},
+		"ok/sort/keep current song": {{
+			label:      `POST/{"current":2,"filters":[],"sort":["Album","Title"]}`,
+			library:    songs.Copy(testSongs),
+			playlist:   []map[string][]string{testSongs[0], testSongs[1]},
+			pos:        intptr(0),
+			playing:    true,
+			method:     http.MethodPost,
+			body:       strings.NewReader(`{"current":2,"filters":[],"sort":["Album","Title"]}`),
+			want:       `{"current":0}`,
+			wantStatus: http.StatusAccepted,
+			mpd: &mpdPlaylist{
+				execCommandList: func(t *testing.T, got *mpd.CommandList) error {
+					want := &mpd.CommandList{}
+					want.AddID("/baz/baz.mp3", 0)
+					want.AddID("/baz/qux.mp3", 1)
+					t.Helper()
+					if !mpd.CommandListEqual(got, want) {
+						t.Errorf("call mpd.ExecCommandList(ctx,\n%v); want mpd.ExecCommandList(ctx,\n%v)", got, want)
+					}
+					return nil
+				},
+			},
+		}},
 		"error/sort": {{
 			label:      `POST/{"current":1,"filters":[["Album","baz"],["Title","qux"]],"sort":["Album","Title"]}`,
 			library:    songs.Copy(testSongs),
@@ -92,11 +116,10 @@ func TestPlaylistHandler(t *testing.T) {
 			mpd: &mpdPlaylist{
 				execCommandList: func(t *testing.T, got *mpd.CommandList) error {
 					want := &mpd.CommandList{}
-					want.Clear()
-					want.Add("/baz/baz.mp3")
-					want.Add("/baz/qux.mp3")
-					want.Add("/foo/bar.mp3")
-					want.Add("/foo/foo.mp3")
+					want.AddID("/baz/baz.mp3", 0)
+					want.AddID("/baz/qux.mp3", 1)
+					want.AddID("/foo/bar.mp3", 2)
+					want.AddID("/foo/foo.mp3", 3)
 					want.Play(1)
 					t.Helper()
 					if !mpd.CommandListEqual(got, want) {
@@ -142,7 +165,7 @@ func TestPlaylistHandler(t *testing.T) {
 	} {
 		t.Run(label, func(t *testing.T) {
 			mpd := &mpdPlaylist{t: t}
-			h, err := api.NewPlaylistHandler(mpd, &api.Config{BackgroundTimeout: time.Second})
+			h, err := api.NewPlaylistHandler(mpd, &api.Config{BackgroundTimeout: time.Second, Logger: log.New(io.Discard)})
 			if err != nil {
 				t.Fatalf("api.NewPlaylistHandler(mpd, config) = %v", err)
 			}
@@ -163,6 +186,7 @@ func TestPlaylistHandler(t *testing.T) {
 					if tt[i].pos != nil {
 						h.UpdateCurrent(*tt[i].pos)
 					}
+					h.UpdatePlaying(tt[i].playing)
 
 					r := httptest.NewRequest(tt[i].method, "/", tt[i].body)
 					w := httptest.NewRecorder()
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// queryError is an invalid query parameter error.
+type queryError struct {
+	key   string
+	value string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("invalid %s: %q", e.key, e.value)
+}
+
+// queryInt returns non-negative integer query parameter or value if not set.
+func queryInt(q url.Values, key string, value int) (int, error) {
+	v := q.Get(key)
+	if len(v) == 0 {
+		return value, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, &queryError{key: key, value: v}
+	}
+	return i, nil
+}
+
+// queryTime returns RFC3339 time query parameter or zero time if not set.
+func queryTime(q url.Values, key string) (time.Time, error) {
+	v := q.Get(key)
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, &queryError{key: key, value: v}
+	}
+	return t, nil
+}
+
+// timeKey returns sortable bolt key for t.
+func timeKey(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+// keyTime returns time of bolt key created by timeKey.
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k))).UTC()
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// rpcRequest represents websocket rpc request message.
+//
+//	{"id": 1, "method": "/api/music", "params": {"volume": 50}}
+//
+// method is an api path and params is a POST request body for the path.
+type rpcRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// rpcResponse represents websocket rpc response message.
+//
+//	{"id": 1, "status": 202, "result": {"volume": 50}}
+//	{"id": 1, "status": 500, "error": "error message"}
+//
+// error is same as writeHTTPError json error message.
+type rpcResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+var errRPCInvalidRequest = errors.New("invalid rpc request")
+
+// rpcResponseWriter records http response for rpc.
+type rpcResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *rpcResponseWriter) Header() http.Header { return w.header }
+
+func (w *rpcResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *rpcResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// serveRPC serves websocket rpc message msg by h as POST request.
+// r is a websocket upgrade request to inherit context, remote address and headers.
+func serveRPC(h http.Handler, r *http.Request, msg []byte) []byte {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return rpcError(nil, http.StatusBadRequest, err)
+	}
+	if len(req.ID) == 0 || !strings.HasPrefix(req.Method, "/") {
+		return rpcError(req.ID, http.StatusBadRequest, errRPCInvalidRequest)
+	}
+	params := req.Params
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	pr, err := http.NewRequestWithContext(r.Context(), http.MethodPost, req.Method, bytes.NewReader(params))
+	if err != nil {
+		return rpcError(req.ID, http.StatusBadRequest, err)
+	}
+	pr.RemoteAddr = r.RemoteAddr
+	pr.Header = r.Header.Clone()
+	for _, k := range []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol", "Accept-Encoding", "If-None-Match", "If-Modified-Since"} {
+		pr.Header.Del(k)
+	}
+	pr.Header.Set("Content-Type", "application/json")
+	w := &rpcResponseWriter{header: http.Header{}}
+	h.ServeHTTP(w, pr)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(w.body.Bytes(), &e); err != nil || len(e.Error) == 0 {
+			e.Error = strings.TrimSpace(w.body.String())
+		}
+		return rpcError(req.ID, w.status, errors.New(e.Error))
+	}
+	resp := &rpcResponse{ID: req.ID, Status: w.status}
+	if json.Valid(w.body.Bytes()) {
+		resp.Result = w.body.Bytes()
+	}
+	b, _ := json.Marshal(resp)
+	return b
+}
+
+func rpcError(id json.RawMessage, status int, err error) []byte {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	b, _ := json.Marshal(&rpcResponse{ID: id, Status: status, Error: err.Error()})
+	return b
+}
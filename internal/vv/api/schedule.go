@@ -0,0 +1,637 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/mpd"
+)
+
+const (
+	scheduleActionPause = "pause"
+	scheduleActionStop  = "stop"
+	scheduleActionAlarm = "alarm"
+
+	scheduleEndSong  = "song"
+	scheduleEndAlbum = "album"
+
+	scheduleAlarmLayout = "15:04"
+)
+
+type httpScheduleJob struct {
+	ID     int        `json:"id"`
+	Action string     `json:"action"`
+	At     *time.Time `json:"at,omitempty"`
+	End    string     `json:"end,omitempty"`
+	Fade   float64    `json:"fade,omitempty"`
+	// alarm
+	Time     string            `json:"time,omitempty"`
+	Outputs  []string          `json:"outputs,omitempty"`
+	Playlist string            `json:"playlist,omitempty"`
+	View     *httpPlaylistInfo `json:"view,omitempty"`
+	Volume   *int              `json:"volume,omitempty"`
+	Next     *time.Time        `json:"next,omitempty"`
+}
+
+type httpScheduleRequest struct {
+	httpScheduleJob
+	Minutes *float64 `json:"minutes"`
+	Delete  bool     `json:"delete"`
+}
+
+// scheduleJob is a persistent job and its runtime state.
+type scheduleJob struct {
+	httpScheduleJob
+	LastID string `json:"last_id,omitempty"` // last song id to stop at end of song or album
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+	armed  bool
+	volume *int // volume before fading out
+}
+
+func (j *scheduleJob) fade() time.Duration {
+	return time.Duration(j.Fade * float64(time.Second))
+}
+
+type MPDSchedule interface {
+	SetVol(context.Context, int) error
+	Pause(context.Context, bool) error
+	Stop(context.Context) error
+	Play(context.Context, int) error
+	OneShot(context.Context) error
+	EnableOutput(context.Context, string) error
+	ExecCommandList(context.Context, *mpd.CommandList) error
+}
+
+// ScheduleHandler runs sleep timers and alarms.
+//
+//	GET /api/music/schedule: lists jobs
+//	POST /api/music/schedule {"action": "pause", "minutes": 30, "fade": 10}: pauses after 30 minutes
+//	POST /api/music/schedule {"action": "stop", "end": "album"}: stops at end of current album
+//	POST /api/music/schedule {"action": "alarm", "time": "07:00", "outputs": ["0"], "playlist": "morning", "volume": 40, "fade": 60}: plays every day; outputs may be restricted by Config.AllowAlarmOutputs
+//	POST /api/music/schedule {"id": 1, "delete": true}: removes job
+type ScheduleHandler struct {
+	mpd      MPDSchedule
+	cache    *cache
+	store    *snapshot
+	name     string
+	config   *Config
+	view     func(context.Context, []string, [][2]*string, int, int) error
+	jobs     []*scheduleJob
+	nextID   int
+	status   *Status
+	playlist []map[string][]string
+	closed   bool
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewScheduleHandler creates ScheduleHandler and starts jobs stored in path.
+// jobs are not persisted if path is empty.
+func NewScheduleHandler(mpd MPDSchedule, path string, config *Config) (*ScheduleHandler, error) {
+	c, err := newCache([]*httpScheduleJob{})
+	if err != nil {
+		return nil, err
+	}
+	a := &ScheduleHandler{
+		mpd:    mpd,
+		cache:  c,
+		config: config,
+		nextID: 1,
+	}
+	if len(path) != 0 {
+		if a.store, err = newSnapshot(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+		a.name = filepath.Base(path)
+		if err := a.load(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// SetViewHook sets function to replace playlist by library view for alarms.
+func (a *ScheduleHandler) SetViewHook(f func(ctx context.Context, sort []string, filters [][2]*string, must, pos int) error) {
+	a.mu.Lock()
+	a.view = f
+	a.mu.Unlock()
+}
+
+func (a *ScheduleHandler) load() error {
+	b, err := a.store.Load(a.name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var jobs []*scheduleJob
+	if err := json.Unmarshal(b, &jobs); err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, j := range jobs {
+		if j.ID >= a.nextID {
+			a.nextID = j.ID + 1
+		}
+		// sleep timer is meaningless after restart
+		if j.At != nil && j.At.Before(now) {
+			continue
+		}
+		a.start(j)
+	}
+	return a.updateCache()
+}
+
+// UpdateStatus sets current mpd status to run jobs at end of song or album.
+func (a *ScheduleHandler) UpdateStatus(s *Status) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = s
+	if a.closed {
+		return
+	}
+	for _, j := range append([]*scheduleJob{}, a.jobs...) {
+		if len(j.End) != 0 {
+			a.checkEnd(j)
+		}
+	}
+}
+
+// UpdatePlaylistSongs sets current playlist songs to find end of song or album.
+func (a *ScheduleHandler) UpdatePlaylistSongs(i []map[string][]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.playlist = i
+	if a.closed {
+		return
+	}
+	for _, j := range append([]*scheduleJob{}, a.jobs...) {
+		if len(j.End) != 0 {
+			a.checkEnd(j)
+		}
+	}
+}
+
+func (a *ScheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.cache.ServeHTTP(w, r)
+		return
+	}
+	var req httpScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Outputs) != 0 && a.config.AllowAlarmOutputs != nil && !a.config.AllowAlarmOutputs(r) {
+		writeHTTPError(w, http.StatusForbidden, errors.New("outputs field is not allowed"))
+		return
+	}
+	now := time.Now()
+	a.mu.Lock()
+	if req.Delete {
+		var found bool
+		for _, j := range a.jobs {
+			if j.ID == req.ID {
+				a.remove(j)
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.mu.Unlock()
+			writeHTTPError(w, http.StatusNotFound, fmt.Errorf("job not found: %d", req.ID))
+			return
+		}
+	} else {
+		j, err := a.newJob(&req, now)
+		if err != nil {
+			a.mu.Unlock()
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		a.start(j)
+	}
+	err := a.save()
+	a.mu.Unlock()
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	r.Method = http.MethodGet
+	a.cache.ServeHTTP(w, r)
+}
+
+// newJob validates request and creates job.
+func (a *ScheduleHandler) newJob(req *httpScheduleRequest, now time.Time) (*scheduleJob, error) {
+	j := &scheduleJob{httpScheduleJob: req.httpScheduleJob}
+	j.Next = nil
+	if j.Fade < 0 {
+		return nil, errors.New("fade must be positive")
+	}
+	switch j.Action {
+	case scheduleActionPause, scheduleActionStop:
+		if len(j.Time) != 0 || len(j.Outputs) != 0 || len(j.Playlist) != 0 || j.View != nil || j.Volume != nil {
+			return nil, fmt.Errorf("time, outputs, playlist, view and volume fields are not supported for %s", j.Action)
+		}
+		n := 0
+		for _, ok := range []bool{j.At != nil, req.Minutes != nil, len(j.End) != 0} {
+			if ok {
+				n++
+			}
+		}
+		if n != 1 {
+			return nil, errors.New("one of at, minutes and end fields is required")
+		}
+		if req.Minutes != nil {
+			if *req.Minutes <= 0 {
+				return nil, errors.New("minutes must be positive")
+			}
+			at := now.Add(time.Duration(*req.Minutes * float64(time.Minute)))
+			j.At = &at
+		}
+		if j.At != nil && !j.At.After(now) {
+			return nil, errors.New("at must be future time")
+		}
+		if len(j.End) != 0 {
+			last, err := a.lastID(j.End)
+			if err != nil {
+				return nil, err
+			}
+			j.LastID = last
+		}
+	case scheduleActionAlarm:
+		if j.At != nil || len(j.End) != 0 || req.Minutes != nil {
+			return nil, errors.New("at, minutes and end fields are not supported for alarm")
+		}
+		if _, err := time.Parse(scheduleAlarmLayout, j.Time); err != nil {
+			return nil, fmt.Errorf("invalid time: %w", err)
+		}
+		if len(j.Playlist) != 0 && j.View != nil {
+			return nil, errors.New("playlist and view fields are exclusive")
+		}
+		if j.View != nil && (j.View.Current == nil || j.View.Sort == nil) {
+			return nil, errors.New("current and sort fields are required for view")
+		}
+		if j.Volume != nil && (*j.Volume < 0 || *j.Volume > 100) {
+			return nil, errors.New("volume must be 0-100")
+		}
+	default:
+		return nil, fmt.Errorf("unknown action: %q", j.Action)
+	}
+	j.ID = a.nextID
+	a.nextID++
+	return j, nil
+}
+
+// lastID returns song id of current song or last song of current album in playlist.
+func (a *ScheduleHandler) lastID(end string) (string, error) {
+	if end != scheduleEndSong && end != scheduleEndAlbum {
+		return "", fmt.Errorf("unknown end: %q", end)
+	}
+	if a.status == nil || a.status.Song == nil || a.status.State == nil || *a.status.State == "stop" || *a.status.Song >= len(a.playlist) {
+		return "", errors.New("no current song")
+	}
+	pos := *a.status.Song
+	if end == scheduleEndAlbum {
+		album := songTag(a.playlist[pos], "Album")
+		artist := songTag(a.playlist[pos], "AlbumArtist")
+		for pos+1 < len(a.playlist) && songTag(a.playlist[pos+1], "Album") == album && songTag(a.playlist[pos+1], "AlbumArtist") == artist {
+			pos++
+		}
+	}
+	id := songTag(a.playlist[pos], "Id")
+	if len(id) == 0 {
+		return "", errors.New("no song id")
+	}
+	return id, nil
+}
+
+// start registers and starts job. a.mu must be locked.
+func (a *ScheduleHandler) start(j *scheduleJob) {
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	a.jobs = append(a.jobs, j)
+	switch {
+	case j.At != nil:
+		j.timer = time.AfterFunc(time.Until(j.At.Add(-j.fade())), func() { a.run(j, a.sleep) })
+	case len(j.End) != 0:
+		a.checkEnd(j)
+	case j.Action == scheduleActionAlarm:
+		a.startAlarm(j)
+	}
+	if err := a.updateCache(); err != nil {
+		a.config.Logger.Errorw("vv/api: schedule: failed to update cache", "error", err)
+	}
+}
+
+func (a *ScheduleHandler) startAlarm(j *scheduleJob) {
+	t, err := time.Parse(scheduleAlarmLayout, j.Time)
+	if err != nil {
+		a.config.Logger.Errorw("vv/api: schedule: invalid alarm time", "id", j.ID, "error", err)
+		return
+	}
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	j.Next = &next
+	j.timer = time.AfterFunc(time.Until(next), func() { a.run(j, a.alarm) })
+}
+
+// remove stops and unregisters job. a.mu must be locked.
+func (a *ScheduleHandler) remove(j *scheduleJob) {
+	for i := range a.jobs {
+		if a.jobs[i] == j {
+			a.jobs = append(a.jobs[:i], a.jobs[i+1:]...)
+			break
+		}
+	}
+	j.cancel()
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	if err := a.updateCache(); err != nil {
+		a.config.Logger.Errorw("vv/api: schedule: failed to update cache", "error", err)
+	}
+}
+
+// run runs f in background if job is not removed.
+func (a *ScheduleHandler) run(j *scheduleJob, f func(context.Context, *scheduleJob)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.runLocked(j, f)
+}
+
+// runLocked runs f in background if job is not removed. a.mu must be locked.
+func (a *ScheduleHandler) runLocked(j *scheduleJob, f func(context.Context, *scheduleJob)) {
+	if a.closed || j.ctx.Err() != nil {
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		f(j.ctx, j)
+	}()
+}
+
+// volume returns current volume or -1 if mpd mixer is not available.
+func (a *ScheduleHandler) volume() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.status == nil || a.status.Volume == nil {
+		return -1
+	}
+	return *a.status.Volume
+}
+
+// restoreVolume sets volume regardless of job cancellation.
+func (a *ScheduleHandler) restoreVolume(vol int) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.BackgroundTimeout)
+	defer cancel()
+	if err := a.mpd.SetVol(ctx, vol); err != nil {
+		a.config.Logger.Errorw("vv/api: schedule: failed to restore volume", "volume", vol, "error", err)
+	}
+}
+
+// sleep fades out and pauses or stops playback.
+func (a *ScheduleHandler) sleep(ctx context.Context, j *scheduleJob) {
+	vol := a.volume()
+	faded := j.Fade > 0 && vol > 0
+	if faded {
+		defer a.restoreVolume(vol)
+		if err := fadeVolume(ctx, a.mpd.SetVol, vol, 0, j.fade()); err != nil {
+			if ctx.Err() == nil {
+				a.config.Logger.Errorw("vv/api: schedule: failed to fade out", "id", j.ID, "error", err)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	var err error
+	if j.Action == scheduleActionPause {
+		err = a.mpd.Pause(ctx, true)
+	} else {
+		err = a.mpd.Stop(ctx)
+	}
+	if err != nil {
+		a.config.Logger.Errorw("vv/api: schedule: failed to run job", "id", j.ID, "action", j.Action, "error", err)
+	}
+	a.done(j)
+}
+
+// checkEnd stops playback at end of song or album by mpd single oneshot mode or
+// pauses playback when next song is started. a.mu must be locked.
+func (a *ScheduleHandler) checkEnd(j *scheduleJob) {
+	if a.status == nil || a.playlist == nil {
+		return
+	}
+	current := ""
+	if pos := a.status.Song; pos != nil && *pos < len(a.playlist) {
+		current = songTag(a.playlist[*pos], "Id")
+	}
+	state := ""
+	if a.status.State != nil {
+		state = *a.status.State
+	}
+	if !j.armed {
+		found := false
+		for i := range a.playlist {
+			if songTag(a.playlist[i], "Id") == j.LastID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			// playlist is replaced
+			a.remove(j)
+			a.persist()
+			return
+		}
+		if current != j.LastID || state != "play" {
+			return
+		}
+		j.armed = true
+		if j.Action == scheduleActionStop {
+			a.runLocked(j, func(ctx context.Context, j *scheduleJob) {
+				if err := a.mpd.OneShot(ctx); err != nil {
+					a.config.Logger.Errorw("vv/api: schedule: failed to enable single oneshot", "id", j.ID, "error", err)
+				}
+			})
+		}
+	}
+	if state == "stop" || current != j.LastID {
+		// next song is started
+		pause := j.Action == scheduleActionPause && state == "play"
+		if v := j.volume; pause || v != nil {
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				if pause {
+					ctx, cancel := context.WithTimeout(context.Background(), a.config.BackgroundTimeout)
+					defer cancel()
+					if err := a.mpd.Pause(ctx, true); err != nil {
+						a.config.Logger.Errorw("vv/api: schedule: failed to run job", "id", j.ID, "action", j.Action, "error", err)
+					}
+				}
+				if v != nil {
+					a.restoreVolume(*v)
+				}
+			}()
+		}
+		a.remove(j)
+		a.persist()
+		return
+	}
+	if j.Fade <= 0 || j.volume != nil {
+		return
+	}
+	if j.timer != nil {
+		j.timer.Stop()
+		j.timer = nil
+	}
+	if state != "play" || a.status.SongElapsed == nil {
+		return
+	}
+	duration, ok := songDuration(a.playlist[*a.status.Song])
+	if !ok {
+		return
+	}
+	remain := duration - time.Duration(*a.status.SongElapsed*float64(time.Second))
+	j.timer = time.AfterFunc(remain-j.fade(), func() { a.run(j, a.fadeOut) })
+}
+
+// fadeOut fades out volume until current song ends.
+func (a *ScheduleHandler) fadeOut(ctx context.Context, j *scheduleJob) {
+	vol := a.volume()
+	if vol <= 0 {
+		return
+	}
+	a.mu.Lock()
+	j.volume = &vol
+	a.mu.Unlock()
+	if err := fadeVolume(ctx, a.mpd.SetVol, vol, 0, j.fade()); err != nil && ctx.Err() == nil {
+		a.config.Logger.Errorw("vv/api: schedule: failed to fade out", "id", j.ID, "error", err)
+	}
+}
+
+// alarm enables outputs, loads songs and fades in volume.
+func (a *ScheduleHandler) alarm(ctx context.Context, j *scheduleJob) {
+	target := a.volume()
+	if j.Volume != nil {
+		target = *j.Volume
+	}
+	faded := j.Fade > 0 && target > 0 && a.volume() >= 0
+	logf := func(err error) {
+		if err != nil {
+			a.config.Logger.Errorw("vv/api: schedule: failed to run alarm", "id", j.ID, "error", err)
+		}
+	}
+	if faded {
+		logf(a.mpd.SetVol(ctx, 0))
+	}
+	for _, id := range j.Outputs {
+		logf(a.mpd.EnableOutput(ctx, id))
+	}
+	a.mu.Lock()
+	view := a.view
+	a.mu.Unlock()
+	switch {
+	case len(j.Playlist) != 0:
+		cl := &mpd.CommandList{}
+		cl.Clear()
+		cl.Load(j.Playlist)
+		cl.Play(0)
+		logf(a.mpd.ExecCommandList(ctx, cl))
+	case j.View != nil && view != nil:
+		logf(view(ctx, j.View.Sort, j.View.Filters, j.View.Must, *j.View.Current))
+	default:
+		logf(a.mpd.Play(ctx, -1))
+	}
+	if faded {
+		logf(fadeVolume(ctx, a.mpd.SetVol, 0, target, j.fade()))
+	} else if j.Volume != nil {
+		logf(a.mpd.SetVol(ctx, target))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if j.ctx.Err() == nil {
+		a.startAlarm(j)
+		if err := a.updateCache(); err != nil {
+			a.config.Logger.Errorw("vv/api: schedule: failed to update cache", "error", err)
+		}
+	}
+}
+
+// done removes finished job.
+func (a *ScheduleHandler) done(j *scheduleJob) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if j.ctx.Err() != nil {
+		return
+	}
+	a.remove(j)
+	a.persist()
+}
+
+// persist saves jobs and logs error. a.mu must be locked.
+func (a *ScheduleHandler) persist() {
+	if err := a.save(); err != nil {
+		a.config.Logger.Errorw("vv/api: schedule: failed to save jobs", "error", err)
+	}
+}
+
+// save writes jobs to store. a.mu must be locked.
+func (a *ScheduleHandler) save() error {
+	if a.store == nil {
+		return nil
+	}
+	b, err := json.Marshal(a.jobs)
+	if err != nil {
+		return err
+	}
+	return a.store.Save(a.name, b)
+}
+
+func (a *ScheduleHandler) updateCache() error {
+	data := make([]*httpScheduleJob, len(a.jobs))
+	for i := range a.jobs {
+		j := a.jobs[i].httpScheduleJob
+		data[i] = &j
+	}
+	_, err := a.cache.SetIfModified(data)
+	return err
+}
+
+// Changed returns schedule list update event chan.
+func (a *ScheduleHandler) Changed() <-chan struct{} {
+	return a.cache.Changed()
+}
+
+// Close stops all jobs and closes update event chan. stored jobs are restarted by NewScheduleHandler.
+func (a *ScheduleHandler) Close() {
+	a.mu.Lock()
+	a.closed = true
+	for _, j := range a.jobs {
+		j.cancel()
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+	a.cache.Close()
+}
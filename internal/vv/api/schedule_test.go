@@ -0,0 +1,211 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/mpd"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+// mpdSchedule records called mpd commands.
+type mpdSchedule struct {
+	calls chan string
+}
+
+func (m *mpdSchedule) call(format string, a ...interface{}) error {
+	m.calls <- fmt.Sprintf(format, a...)
+	return nil
+}
+
+func (m *mpdSchedule) SetVol(ctx context.Context, i int) error { return m.call("SetVol(%d)", i) }
+func (m *mpdSchedule) Pause(ctx context.Context, b bool) error { return m.call("Pause(%v)", b) }
+func (m *mpdSchedule) Stop(ctx context.Context) error          { return m.call("Stop()") }
+func (m *mpdSchedule) Play(ctx context.Context, i int) error   { return m.call("Play(%d)", i) }
+func (m *mpdSchedule) OneShot(ctx context.Context) error       { return m.call("OneShot()") }
+func (m *mpdSchedule) EnableOutput(ctx context.Context, id string) error {
+	return m.call("EnableOutput(%s)", id)
+}
+func (m *mpdSchedule) ExecCommandList(ctx context.Context, cl *mpd.CommandList) error {
+	return m.call("ExecCommandList(%v)", cl)
+}
+
+func (m *mpdSchedule) expect(t *testing.T, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-m.calls:
+			if got != w {
+				t.Errorf("got mpd call %s; want %s", got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got no mpd call; want %s", w)
+		}
+	}
+}
+
+type testScheduleJob struct {
+	ID     int        `json:"id"`
+	Action string     `json:"action"`
+	Time   string     `json:"time"`
+	Next   *time.Time `json:"next"`
+}
+
+func getSchedule(t *testing.T, h http.Handler) []*testScheduleJob {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var ret []*testScheduleJob
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatalf("failed to parse json %s: %v", w.Body.String(), err)
+	}
+	return ret
+}
+
+func postSchedule(t *testing.T, h http.Handler, body string, want int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if w.Code != want {
+		t.Errorf("POST %s got %d %s; want %d", body, w.Code, w.Body.String(), want)
+	}
+}
+
+func TestScheduleHandler(t *testing.T) {
+	m := &mpdSchedule{calls: make(chan string, 10)}
+	conf := &api.Config{BackgroundTimeout: time.Second, Logger: log.NewTestLogger(t)}
+	h, err := api.NewScheduleHandler(m, "", conf)
+	if err != nil {
+		t.Fatalf("NewScheduleHandler got error %v; want nil", err)
+	}
+	defer h.Close()
+	vol := 50
+	h.UpdateStatus(&api.Status{Volume: &vol, State: strptr("play"), Song: intptr(0)})
+
+	t.Run("pause", func(t *testing.T) {
+		at := time.Now().Add(100 * time.Millisecond).Format(time.RFC3339Nano)
+		postSchedule(t, h, `{"action":"pause","at":"`+at+`"}`, http.StatusOK)
+		if got := getSchedule(t, h); len(got) != 1 || got[0].Action != "pause" {
+			t.Errorf("got %+v; want 1 pause job", got)
+		}
+		m.expect(t, "Pause(true)")
+		time.Sleep(10 * time.Millisecond)
+		if got := getSchedule(t, h); len(got) != 0 {
+			t.Errorf("got %+v; want no jobs after run", got)
+		}
+	})
+	t.Run("stop with fade", func(t *testing.T) {
+		at := time.Now().Add(300 * time.Millisecond).Format(time.RFC3339Nano)
+		postSchedule(t, h, `{"action":"stop","at":"`+at+`","fade":0.2}`, http.StatusOK)
+		m.expect(t, "SetVol(25)", "SetVol(0)", "Stop()", "SetVol(50)")
+	})
+	t.Run("delete", func(t *testing.T) {
+		postSchedule(t, h, `{"action":"pause","minutes":30}`, http.StatusOK)
+		got := getSchedule(t, h)
+		if len(got) != 1 {
+			t.Fatalf("got %+v; want 1 job", got)
+		}
+		postSchedule(t, h, fmt.Sprintf(`{"id":%d,"delete":true}`, got[0].ID), http.StatusOK)
+		postSchedule(t, h, fmt.Sprintf(`{"id":%d,"delete":true}`, got[0].ID), http.StatusNotFound)
+		if got := getSchedule(t, h); len(got) != 0 {
+			t.Errorf("got %+v; want no jobs", got)
+		}
+	})
+	t.Run("end of album", func(t *testing.T) {
+		h.UpdatePlaylistSongs([]map[string][]string{
+			{"file": {"a"}, "Id": {"1"}, "Album": {"foo"}},
+			{"file": {"b"}, "Id": {"2"}, "Album": {"foo"}},
+			{"file": {"c"}, "Id": {"3"}, "Album": {"bar"}},
+		})
+		postSchedule(t, h, `{"action":"stop","end":"album"}`, http.StatusOK)
+		h.UpdateStatus(&api.Status{Volume: &vol, State: strptr("play"), Song: intptr(1)})
+		m.expect(t, "OneShot()")
+		h.UpdateStatus(&api.Status{Volume: &vol, State: strptr("stop"), Song: intptr(2)})
+		if got := getSchedule(t, h); len(got) != 0 {
+			t.Errorf("got %+v; want no jobs after stopped", got)
+		}
+	})
+	t.Run("pause at end of song", func(t *testing.T) {
+		h.UpdateStatus(&api.Status{Volume: &vol, State: strptr("play"), Song: intptr(2)})
+		postSchedule(t, h, `{"action":"pause","end":"song"}`, http.StatusOK)
+		h.UpdateStatus(&api.Status{Volume: &vol, State: strptr("play"), Song: intptr(0)})
+		m.expect(t, "Pause(true)")
+		if got := getSchedule(t, h); len(got) != 0 {
+			t.Errorf("got %+v; want no jobs after paused", got)
+		}
+	})
+	t.Run("outputs requires permission", func(t *testing.T) {
+		conf := &api.Config{BackgroundTimeout: time.Second, Logger: log.NewTestLogger(t), AllowAlarmOutputs: func(r *http.Request) bool {
+			return r.Header.Get("X-Admin") == "1"
+		}}
+		h, err := api.NewScheduleHandler(m, "", conf)
+		if err != nil {
+			t.Fatalf("NewScheduleHandler got error %v; want nil", err)
+		}
+		defer h.Close()
+		for admin, want := range map[string]int{"": http.StatusForbidden, "1": http.StatusOK} {
+			r := httptest.NewRequest(http.MethodPost, "/api/music/schedule", strings.NewReader(`{"action":"alarm","time":"07:00","outputs":["0"]}`))
+			r.Header.Set("X-Admin", admin)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != want {
+				t.Errorf("got %d %s; want %d", w.Code, w.Body.String(), want)
+			}
+		}
+		postSchedule(t, h, `{"action":"pause","minutes":1}`, http.StatusOK)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`invalid`,
+			`{"action":"foo"}`,
+			`{"action":"pause"}`,
+			`{"action":"pause","minutes":-1}`,
+			`{"action":"pause","minutes":1,"end":"song"}`,
+			`{"action":"pause","at":"2000-01-01T00:00:00Z"}`,
+			`{"action":"stop","end":"foo"}`,
+			`{"action":"alarm","time":"25:00"}`,
+			`{"action":"alarm","time":"07:00","playlist":"foo","view":{"current":0,"sort":[]}}`,
+			`{"action":"alarm","time":"07:00","volume":101}`,
+		} {
+			postSchedule(t, h, body, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestScheduleHandlerAlarm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	m := &mpdSchedule{calls: make(chan string, 10)}
+	conf := &api.Config{BackgroundTimeout: time.Second, Logger: log.NewTestLogger(t)}
+	h, err := api.NewScheduleHandler(m, path, conf)
+	if err != nil {
+		t.Fatalf("NewScheduleHandler got error %v; want nil", err)
+	}
+	postSchedule(t, h, `{"action":"alarm","time":"07:00","outputs":["1"],"playlist":"morning","volume":40}`, http.StatusOK)
+	got := getSchedule(t, h)
+	if len(got) != 1 || got[0].Time != "07:00" || got[0].Next == nil || got[0].Next.Hour() != 7 || time.Until(*got[0].Next) > 24*time.Hour {
+		t.Fatalf("got %+v; want alarm at next 07:00", got)
+	}
+	h.Close()
+
+	// alarms are restored
+	h, err = api.NewScheduleHandler(m, path, conf)
+	if err != nil {
+		t.Fatalf("NewScheduleHandler got error %v; want nil", err)
+	}
+	defer h.Close()
+	if restored := getSchedule(t, h); len(restored) != 1 || restored[0].ID != got[0].ID || restored[0].Time != "07:00" {
+		t.Errorf("got %+v; want restored alarm", restored)
+	}
+	postSchedule(t, h, `{"action":"pause","minutes":1}`, http.StatusOK)
+	if got := getSchedule(t, h); len(got) != 2 || got[1].ID != got[0].ID+1 {
+		t.Errorf("got %+v; want new job id after restored job", got)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	snapshotLibrarySongs  = "library_songs.json"
+	snapshotPlaylistSongs = "playlist_songs.json"
+	snapshotOutputs       = "outputs.json"
+)
+
+// snapshot stores api cache json to serve it before mpd connection.
+type snapshot struct {
+	dir string
+}
+
+func newSnapshot(dir string) (*snapshot, error) {
+	if err := os.MkdirAll(dir, 0766); err != nil {
+		return nil, err
+	}
+	return &snapshot{dir: dir}, nil
+}
+
+// Save writes json binary b as name.
+func (s *snapshot) Save(name string, b []byte) error {
+	f, err := os.CreateTemp(s.dir, name+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, name))
+}
+
+// Load reads json binary by name.
+func (s *snapshot) Load(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, name))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type httpMusicStats struct {
@@ -95,6 +96,14 @@ func (a *StatsHandler) update(ctx context.Context) error {
 	return a.cache.Set(ret)
 }
 
+// current returns last stats and its updated time.
+func (a *StatsHandler) current() (*httpMusicStats, time.Time) {
+	a.cache.mu.RLock()
+	defer a.cache.mu.RUnlock()
+	s, _ := a.cache.data.(*httpMusicStats)
+	return s, a.cache.date
+}
+
 // ServeHTTP responses stats as json format.
 func (a *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.cache.ServeHTTP(w, r)
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -24,11 +25,21 @@ type Status struct {
 	ReplayGain  *string  `json:"replay_gain,omitempty"`
 	Crossfade   *int     `json:"crossfade,omitempty"`
 
-	Updating bool    `json:"-"`
-	Error    *string `json:"-"`
-	Song     *int    `json:"-"`
+	Updating  bool    `json:"-"`
+	Error     *string `json:"-"`
+	Song      *int    `json:"-"`
+	Partition string  `json:"-"`
 }
 
+// httpStatusRequest is a Status POST body.
+type httpStatusRequest struct {
+	Status
+	Fade *float64 `json:"fade,omitempty"` // seconds to fade volume or state change
+}
+
+// statusFadeRestoreTimeout is a timeout to restore volume after fading.
+const statusFadeRestoreTimeout = 10 * time.Second
+
 type MPDStatus interface {
 	Status(context.Context) (map[string]string, error)
 	ReplayGainStatus(context.Context) (map[string]string, error)
@@ -43,12 +54,14 @@ type MPDStatus interface {
 	Crossfade(context.Context, time.Duration) error
 	Play(context.Context, int) error
 	Pause(context.Context, bool) error
+	Stop(context.Context) error
 	Next(context.Context) error
 	Previous(context.Context) error
 }
 
 type StatusHandler struct {
 	mpd        MPDStatus
+	logger     Logger
 	cache      *cache
 	data       *Status
 	replayGain map[string]string
@@ -57,9 +70,15 @@ type StatusHandler struct {
 	upgrader websocket.Upgrader
 	mu       sync.RWMutex
 	subs     []chan string
+	rpc      http.Handler
+
+	fadeMu     sync.Mutex
+	fadeCancel context.CancelFunc
+	fadeDone   chan struct{}
+	fadeTarget int // volume after fade
 }
 
-func NewStatusHandler(mpd MPDStatus) (*StatusHandler, error) {
+func NewStatusHandler(mpd MPDStatus, logger Logger) (*StatusHandler, error) {
 	data := &Status{}
 	c, err := newCache(data)
 	if err != nil {
@@ -67,6 +86,7 @@ func NewStatusHandler(mpd MPDStatus) (*StatusHandler, error) {
 	}
 	return &StatusHandler{
 		mpd:     mpd,
+		logger:  logger,
 		cache:   c,
 		data:    data,
 		changed: make(chan struct{}, cap(c.Changed())),
@@ -86,6 +106,20 @@ func (a *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.cache.ServeHTTP(w, r)
 }
 
+// HandleRPC sets http handler to serve websocket rpc requests.
+// websocket messages are discarded if h is nil.
+func (a *StatusHandler) HandleRPC(h http.Handler) {
+	a.mu.Lock()
+	a.rpc = h
+	a.mu.Unlock()
+}
+
+// CheckOrigin sets websocket origin checker.
+// f should return true if the request Origin header is acceptable.
+func (a *StatusHandler) CheckOrigin(f func(r *http.Request) bool) {
+	a.upgrader.CheckOrigin = f
+}
+
 // Broadcast broadcasts messages to websocket mpds.
 func (a *StatusHandler) BroadCast(s string) {
 	a.mu.Lock()
@@ -146,9 +180,10 @@ func (a *StatusHandler) Update(ctx context.Context) error {
 		ReplayGain:  &replayGain,
 		Crossfade:   &crossfade,
 
-		Song:     pos,
-		Updating: updating,
-		Error:    errstr,
+		Song:      pos,
+		Updating:  updating,
+		Error:     errstr,
+		Partition: s["partition"],
 	}
 	// force update to update Last-Modified header to calc current SongElapsed
 	a.mu.Lock()
@@ -181,26 +216,191 @@ func (a *StatusHandler) Cache() *Status {
 	return a.data
 }
 
+// Subscribers returns number of websocket connections.
+func (a *StatusHandler) Subscribers() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.subs)
+}
+
 // Changed returns status update event chan.
 func (a *StatusHandler) Changed() <-chan struct{} {
 	return a.changed
 }
 
-// Close closes update event chan.
+// Close stops volume fading and closes update event chan.
 func (a *StatusHandler) Close() {
+	a.stopFade()
 	a.cache.Close()
 	close(a.changed)
 }
 
+// startFade stops running fade and runs f in background.
+// f must set volume to target even if fading is canceled.
+func (a *StatusHandler) startFade(target int, f func(context.Context)) {
+	a.fadeMu.Lock()
+	defer a.fadeMu.Unlock()
+	a.stopFadeLocked()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	a.fadeCancel, a.fadeDone, a.fadeTarget = cancel, done, target
+	go func() {
+		defer close(done)
+		defer cancel()
+		f(ctx)
+	}()
+}
+
+// stopFade cancels running fade and waits until volume is restored.
+// returns restored volume if fade was running; status cache may not have it yet.
+func (a *StatusHandler) stopFade() (int, bool) {
+	a.fadeMu.Lock()
+	defer a.fadeMu.Unlock()
+	return a.stopFadeLocked()
+}
+
+func (a *StatusHandler) stopFadeLocked() (int, bool) {
+	if a.fadeCancel == nil {
+		return 0, false
+	}
+	running := true
+	select {
+	case <-a.fadeDone:
+		running = false
+	default:
+	}
+	a.fadeCancel()
+	<-a.fadeDone
+	a.fadeCancel, a.fadeDone = nil, nil
+	return a.fadeTarget, running
+}
+
+// setVolAfterFade sets volume even if fading is canceled.
+func (a *StatusHandler) setVolAfterFade(vol int) {
+	ctx, cancel := context.WithTimeout(context.Background(), statusFadeRestoreTimeout)
+	defer cancel()
+	if err := a.mpd.SetVol(ctx, vol); err != nil {
+		a.logger.Errorw("vv/api: failed to restore volume after fade", "volume", vol, "error", err)
+	}
+}
+
+// fadeFailed logs fade error; canceled fade is not an error.
+func (a *StatusHandler) fadeFailed(action string, err error) bool {
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, context.Canceled) {
+		a.logger.Errorw("vv/api: failed to fade", "action", action, "error", err)
+	}
+	return true
+}
+
+// postFade changes volume or playback state with volume fading in background.
+func (a *StatusHandler) postFade(ctx context.Context, s *Status, current int, d time.Duration) error {
+	target := current
+	if s.Volume != nil {
+		target = *s.Volume
+	}
+	state := ""
+	if s.State != nil {
+		state = *s.State
+	}
+	switch state {
+	case "":
+		a.startFade(target, func(ctx context.Context) {
+			if a.fadeFailed("volume", fadeVolume(ctx, a.mpd.SetVol, current, target, d)) {
+				a.setVolAfterFade(target)
+			}
+		})
+	case "pause", "stop":
+		a.startFade(target, func(ctx context.Context) {
+			defer a.setVolAfterFade(target)
+			if a.fadeFailed(state, fadeVolume(ctx, a.mpd.SetVol, current, 0, d)) {
+				return
+			}
+			if state == "pause" {
+				a.fadeFailed(state, a.mpd.Pause(ctx, true))
+			} else {
+				a.fadeFailed(state, a.mpd.Stop(ctx))
+			}
+		})
+	case "play":
+		if err := a.mpd.SetVol(ctx, 0); err != nil {
+			return err
+		}
+		if err := a.mpd.Play(ctx, -1); err != nil {
+			a.setVolAfterFade(current)
+			return err
+		}
+		a.startFade(target, func(ctx context.Context) {
+			if a.fadeFailed(state, fadeVolume(ctx, a.mpd.SetVol, 0, target, d)) {
+				a.setVolAfterFade(target)
+			}
+		})
+	case "next", "previous":
+		// fades out and in in d
+		a.startFade(target, func(ctx context.Context) {
+			if a.fadeFailed(state, fadeVolume(ctx, a.mpd.SetVol, current, 0, d/2)) {
+				a.setVolAfterFade(target)
+				return
+			}
+			var err error
+			if state == "next" {
+				err = a.mpd.Next(ctx)
+			} else {
+				err = a.mpd.Previous(ctx)
+			}
+			if a.fadeFailed(state, err) {
+				a.setVolAfterFade(target)
+				return
+			}
+			if a.fadeFailed(state, fadeVolume(ctx, a.mpd.SetVol, 0, target, d/2)) {
+				a.setVolAfterFade(target)
+			}
+		})
+	default:
+		return fmt.Errorf("unknown state: %s", state)
+	}
+	return nil
+}
+
 func (a *StatusHandler) post(w http.ResponseWriter, r *http.Request) {
-	var s Status
-	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+	var req httpStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeHTTPError(w, http.StatusBadRequest, err)
 		return
 	}
+	s := req.Status
 	ctx := r.Context()
 	now := time.Now().UTC()
 	changed := false
+	if req.Fade != nil && *req.Fade < 0 {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("fade must be positive"))
+		return
+	}
+	current := a.Cache().Volume
+	if s.Volume != nil || s.State != nil {
+		// new volume or state overrides running fade
+		if restored, ok := a.stopFade(); ok {
+			current = &restored
+		}
+	}
+	if req.Fade != nil && *req.Fade > 0 && current != nil && *current >= 0 && (s.Volume != nil || s.State != nil) {
+		if s.State != nil {
+			switch *s.State {
+			case "play", "pause", "stop", "next", "previous":
+			default:
+				writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("unknown state: %s", *s.State))
+				return
+			}
+		}
+		if err := a.postFade(ctx, &s, *current, time.Duration(*req.Fade*float64(time.Second))); err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.Volume, s.State = nil, nil
+		changed = true
+	}
 	if s.Volume != nil {
 		if err := a.mpd.SetVol(ctx, *s.Volume); err != nil {
 			writeHTTPError(w, http.StatusInternalServerError, err)
@@ -271,6 +471,8 @@ func (a *StatusHandler) post(w http.ResponseWriter, r *http.Request) {
 			err = a.mpd.Play(ctx, -1)
 		case "pause":
 			err = a.mpd.Pause(ctx, true)
+		case "stop":
+			err = a.mpd.Stop(ctx)
 		case "next":
 			err = a.mpd.Next(ctx)
 		case "previous":
@@ -293,6 +495,10 @@ func (a *StatusHandler) post(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *StatusHandler) websocket(w http.ResponseWriter, r *http.Request) {
+	if a.upgrader.CheckOrigin != nil && !a.upgrader.CheckOrigin(r) {
+		writeHTTPError(w, http.StatusForbidden, fmt.Errorf("origin not allowed: %s", r.Header.Get("Origin")))
+		return
+	}
 	ws, err := a.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
@@ -320,20 +526,37 @@ func (a *StatusHandler) websocket(w http.ResponseWriter, r *http.Request) {
 	if err := ws.WriteMessage(websocket.TextMessage, []byte("ok")); err != nil {
 		return
 	}
+	a.mu.RLock()
+	rpc := a.rpc
+	a.mu.RUnlock()
+	replies := make(chan []byte, 10)
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
 		defer cancel()
 		for {
-			_, _, err := ws.ReadMessage()
+			t, msg, err := ws.ReadMessage()
 			if err != nil {
 				return
 			}
+			if rpc == nil || t != websocket.TextMessage {
+				continue
+			}
+			select {
+			case replies <- serveRPC(rpc, r, msg):
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case b := <-replies:
+			if err := ws.WriteMessage(websocket.TextMessage, b); err != nil {
+				return
+			}
 		case e, ok := <-c:
 			if !ok {
 				return
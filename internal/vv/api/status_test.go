@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/meiraka/vv/internal/log"
 	"github.com/meiraka/vv/internal/vv/api"
 )
 
@@ -104,6 +105,7 @@ func TestStatusHandlerGET(t *testing.T) {
 				ReplayGain:  strptr("off"),
 				Crossfade:   intptr(0),
 				Song:        intptr(30),
+				Partition:   "default",
 			},
 			changed: true,
 			update:  "Update",
@@ -198,6 +200,7 @@ func TestStatusHandlerGET(t *testing.T) {
 				ReplayGain:  strptr("track"),
 				Crossfade:   intptr(0),
 				Song:        intptr(30),
+				Partition:   "default",
 			},
 			changed: true,
 			update:  "UpdateOptions",
@@ -205,7 +208,7 @@ func TestStatusHandlerGET(t *testing.T) {
 	} {
 		t.Run(label, func(t *testing.T) {
 			mpd := &mpdStatus{t: t}
-			h, err := api.NewStatusHandler(mpd)
+			h, err := api.NewStatusHandler(mpd, log.NewTestLogger(t))
 			if err != nil {
 				t.Fatalf("api.NewLibrarySongs() = %v, %v", h, err)
 			}
@@ -265,6 +268,7 @@ func TestStatusHandlerPOST(t *testing.T) {
 		crossfade      func(*testing.T, time.Duration) error
 		play           func(*testing.T, int) error
 		pause          func(*testing.T, bool) error
+		stop           func() error
 		next           func() error
 		previous       func() error
 	}{
@@ -400,6 +404,29 @@ func TestStatusHandlerPOST(t *testing.T) {
 			want:       fmt.Sprintf(`{"error":%q}`, errTest.Error()),
 			pause:      mockBoolFunc("mpd.Pause(ctx, %v)", true, errTest),
 		},
+		`ok/{"state":"stop"}`: {
+			body:       `{"state":"stop"}`,
+			wantStatus: http.StatusAccepted,
+			want:       `{}`,
+			stop:       func() error { return nil },
+		},
+		`error/{"state":"stop"}`: {
+			body:       `{"state":"stop"}`,
+			wantStatus: http.StatusInternalServerError,
+			want:       fmt.Sprintf(`{"error":%q}`, errTest.Error()),
+			stop:       func() error { return errTest },
+		},
+		`ok/{"volume":50,"fade":3}/no mixer`: {
+			body:       `{"volume":50,"fade":3}`,
+			wantStatus: http.StatusAccepted,
+			want:       `{}`,
+			setVol:     mockIntFunc("mpd.SetVol(ctx, %q)", 50, nil),
+		},
+		`error/{"state":"pause","fade":-1}`: {
+			body:       `{"state":"pause","fade":-1}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"fade must be positive"}`,
+		},
 		`ok/{"state":"next"}`: {
 			body:       `{"state":"next"}`,
 			wantStatus: http.StatusAccepted,
@@ -444,12 +471,13 @@ func TestStatusHandlerPOST(t *testing.T) {
 				crossfade:      tt.crossfade,
 				play:           tt.play,
 				pause:          tt.pause,
+				stop:           tt.stop,
 				next:           tt.next,
 				previous:       tt.previous,
 			}
-			h, err := api.NewStatusHandler(mpd)
+			h, err := api.NewStatusHandler(mpd, log.NewTestLogger(t))
 			if err != nil {
-				t.Fatalf("api.NewStatusHandler(mpd) = %v, %v", h, err)
+				t.Fatalf("api.NewStatusHandler(mpd, log.NewTestLogger(t)) = %v, %v", h, err)
 			}
 			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
 			w := httptest.NewRecorder()
@@ -461,11 +489,86 @@ func TestStatusHandlerPOST(t *testing.T) {
 	}
 }
 
+func TestStatusHandlerPOSTFade(t *testing.T) {
+	calls := make(chan string, 100)
+	record := func(format string) func(*testing.T, int) error {
+		return func(_ *testing.T, i int) error {
+			calls <- fmt.Sprintf(format, i)
+			return nil
+		}
+	}
+	mpd := &mpdStatus{
+		t:      t,
+		status: func() (map[string]string, error) { return map[string]string{"volume": "40", "state": "play"}, nil },
+		setVol: record("SetVol(%d)"),
+		play:   record("Play(%d)"),
+		pause: func(_ *testing.T, b bool) error {
+			calls <- fmt.Sprintf("Pause(%v)", b)
+			return nil
+		},
+	}
+	h, err := api.NewStatusHandler(mpd, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("api.NewStatusHandler(mpd, log.NewTestLogger(t)) = %v, %v", h, err)
+	}
+	defer h.Close()
+	if err := h.Update(context.TODO()); err != nil {
+		t.Fatalf("Update got error %v; want nil", err)
+	}
+	post := func(body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != http.StatusAccepted {
+			t.Errorf("POST %s got %d %s; want %d", body, w.Code, w.Body.String(), http.StatusAccepted)
+		}
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-calls:
+				if got != w {
+					t.Errorf("got %s; want %s", got, w)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("got no mpd call; want %s", w)
+			}
+		}
+	}
+	for _, tt := range []struct {
+		body string
+		want []string
+	}{
+		{body: `{"state":"pause","fade":0.2}`, want: []string{"SetVol(20)", "SetVol(0)", "Pause(true)", "SetVol(40)"}},
+		{body: `{"state":"play","fade":0.2}`, want: []string{"SetVol(0)", "Play(-1)", "SetVol(20)", "SetVol(40)"}},
+		{body: `{"volume":60,"fade":0.2}`, want: []string{"SetVol(50)", "SetVol(60)"}},
+	} {
+		post(tt.body)
+		expect(tt.want...)
+	}
+
+	// new state cancels fading and restores volume
+	post(`{"state":"pause","fade":10}`)
+	post(`{"state":"play"}`)
+	expect("SetVol(40)", "Play(-1)")
+
+	// next fade starts from restored volume even if status has volume in fading
+	post(`{"state":"play","fade":100}`)
+	expect("SetVol(0)", "Play(-1)")
+	mpd.status = func() (map[string]string, error) { return map[string]string{"volume": "0", "state": "play"}, nil }
+	if err := h.Update(context.TODO()); err != nil {
+		t.Fatalf("Update got error %v; want nil", err)
+	}
+	post(`{"state":"pause","fade":0.2}`)
+	expect("SetVol(40)", "SetVol(20)", "SetVol(0)", "Pause(true)", "SetVol(40)")
+}
+
 func TestStatusHandlerWebSocket(t *testing.T) {
 	mpd := &mpdStatus{t: t}
-	h, err := api.NewStatusHandler(mpd)
+	h, err := api.NewStatusHandler(mpd, log.NewTestLogger(t))
 	if err != nil {
-		t.Fatalf("api.NewStatusHandler(mpd) = %v, %v", h, err)
+		t.Fatalf("api.NewStatusHandler(mpd, log.NewTestLogger(t)) = %v, %v", h, err)
 	}
 	defer h.Close()
 	ts := httptest.NewServer(h)
@@ -485,6 +588,76 @@ func TestStatusHandlerWebSocket(t *testing.T) {
 	}
 }
 
+func TestStatusHandlerWebSocketRPC(t *testing.T) {
+	mpd := &mpdStatus{t: t}
+	h, err := api.NewStatusHandler(mpd, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("api.NewStatusHandler(mpd, log.NewTestLogger(t)) = %v, %v", h, err)
+	}
+	defer h.Close()
+	h.HandleRPC(h)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	ws, _, err := websocket.DefaultDialer.Dial(strings.Replace(ts.URL, "http://", "ws://", 1), nil)
+	if err != nil {
+		t.Fatalf("failed to connect websocket: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, msg, err := ws.ReadMessage(); string(msg) != "ok" || err != nil {
+		t.Fatalf("got message: %s, %v, want: ok <nil>", msg, err)
+	}
+	for _, tt := range []struct {
+		label  string
+		msg    string
+		setVol func(*testing.T, int) error
+		want   string
+	}{
+		{
+			label:  "ok",
+			msg:    `{"id":1,"method":"/api/music","params":{"volume":50}}`,
+			setVol: mockIntFunc("mpd.SetVol(ctx, %q)", 50, nil),
+			want:   `{"id":1,"status":202,"result":{}}`,
+		},
+		{
+			label:  "error",
+			msg:    `{"id":"foo","method":"/api/music","params":{"volume":50}}`,
+			setVol: mockIntFunc("mpd.SetVol(ctx, %q)", 50, errTest),
+			want:   fmt.Sprintf(`{"id":"foo","status":500,"error":%q}`, errTest.Error()),
+		},
+		{
+			label: "bad params",
+			msg:   `{"id":2,"method":"/api/music","params":{"state":"unknown"}}`,
+			want:  `{"id":2,"status":400,"error":"unknown state: unknown"}`,
+		},
+		{
+			label: "no id",
+			msg:   `{"method":"/api/music","params":{"volume":50}}`,
+			want:  `{"id":null,"status":400,"error":"invalid rpc request"}`,
+		},
+	} {
+		t.Run(tt.label, func(t *testing.T) {
+			mpd.setVol = tt.setVol
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(tt.msg)); err != nil {
+				t.Fatalf("failed to write message: %v", err)
+			}
+			for {
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					t.Fatalf("got message: %s, %v, want: %s <nil>", msg, err, tt.want)
+				}
+				if string(msg) == "ping" {
+					continue
+				}
+				if string(msg) != tt.want {
+					t.Errorf("got message: %s; want: %s", msg, tt.want)
+				}
+				break
+			}
+		})
+	}
+}
+
 type mpdStatus struct {
 	t                *testing.T
 	status           func() (map[string]string, error)
@@ -500,6 +673,7 @@ type mpdStatus struct {
 	crossfade        func(*testing.T, time.Duration) error
 	play             func(*testing.T, int) error
 	pause            func(*testing.T, bool) error
+	stop             func() error
 	next             func() error
 	previous         func() error
 }
@@ -595,6 +769,13 @@ func (m *mpdStatus) Pause(ctx context.Context, a bool) error {
 	}
 	return m.pause(m.t, a)
 }
+func (m *mpdStatus) Stop(context.Context) error {
+	m.t.Helper()
+	if m.stop == nil {
+		m.t.Fatal("no Stop mock function")
+	}
+	return m.stop()
+}
 func (m *mpdStatus) Next(context.Context) error {
 	m.t.Helper()
 	if m.next == nil {
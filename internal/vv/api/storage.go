@@ -118,6 +118,14 @@ func (a *StorageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.cache.ServeHTTP(w, r)
 }
 
+// storage returns storage list by mount point.
+func (a *StorageHandler) storage() map[string]*httpStorage {
+	a.cache.mu.RLock()
+	defer a.cache.mu.RUnlock()
+	data, _ := a.cache.data.(map[string]*httpStorage)
+	return data
+}
+
 // Changed returns storage list update event chan.
 func (a *StorageHandler) Changed() <-chan struct{} {
 	return a.cache.Changed()
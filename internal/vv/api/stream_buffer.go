@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errStreamSlow = errors.New("api: stream: listener is too slow")
+
+// streamBuffer is a fixed size ring buffer for a stream listener.
+// Write fails with errStreamSlow instead of blocking if buffer is full.
+type streamBuffer struct {
+	buf    []byte
+	r      int
+	n      int
+	err    error
+	notify chan struct{}
+	mu     sync.Mutex
+}
+
+func newStreamBuffer(size int) *streamBuffer {
+	return &streamBuffer{
+		buf:    make([]byte, size),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Write appends p to buffer.
+func (b *streamBuffer) Write(p []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	if len(p) > len(b.buf)-b.n {
+		b.err = errStreamSlow
+		b.wake()
+		return b.err
+	}
+	w := (b.r + b.n) % len(b.buf)
+	c := copy(b.buf[w:], p)
+	copy(b.buf, p[c:])
+	b.n += len(p)
+	b.wake()
+	return nil
+}
+
+// CloseWithError closes buffer; Read returns err after reading buffered data.
+func (b *streamBuffer) CloseWithError(err error) {
+	b.mu.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.wake()
+	b.mu.Unlock()
+}
+
+// Read reads buffered data; blocks until data is written or buffer is closed.
+// Read discards buffered data if listener is too slow.
+func (b *streamBuffer) Read(ctx context.Context, p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		if b.err == errStreamSlow || (b.err != nil && b.n == 0) {
+			err := b.err
+			b.mu.Unlock()
+			return 0, err
+		}
+		if b.n != 0 {
+			c := len(p)
+			if c > b.n {
+				c = b.n
+			}
+			k := copy(p[:c], b.buf[b.r:])
+			copy(p[k:c], b.buf)
+			b.r = (b.r + c) % len(b.buf)
+			b.n -= c
+			b.mu.Unlock()
+			return c, nil
+		}
+		b.mu.Unlock()
+		select {
+		case <-b.notify:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (b *streamBuffer) wake() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStreamBuffer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	read := func(b *streamBuffer, size int) (string, error) {
+		p := make([]byte, size)
+		n, err := b.Read(ctx, p)
+		return string(p[:n]), err
+	}
+	t.Run("wrap", func(t *testing.T) {
+		b := newStreamBuffer(8)
+		for _, tt := range []struct {
+			write string
+			size  int
+			want  string
+		}{
+			{write: "abcdef", size: 4, want: "abcd"},
+			{write: "ghij", size: 8, want: "efghij"},
+			{write: "klmnopqr", size: 8, want: "klmnopqr"},
+		} {
+			if err := b.Write([]byte(tt.write)); err != nil {
+				t.Fatalf("Write(%q) got error %v; want nil", tt.write, err)
+			}
+			if got, err := read(b, tt.size); got != tt.want || err != nil {
+				t.Errorf("Read got %q, %v; want %q, nil", got, err, tt.want)
+			}
+		}
+	})
+	t.Run("slow", func(t *testing.T) {
+		b := newStreamBuffer(8)
+		if err := b.Write([]byte("abcdef")); err != nil {
+			t.Fatalf("Write got error %v; want nil", err)
+		}
+		if err := b.Write([]byte("ghi")); err != errStreamSlow {
+			t.Errorf("Write got error %v; want %v", err, errStreamSlow)
+		}
+		if got, err := read(b, 8); got != "" || err != errStreamSlow {
+			t.Errorf("Read got %q, %v; want \"\", %v", got, err, errStreamSlow)
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		b := newStreamBuffer(8)
+		closed := errors.New("closed")
+		go func() {
+			b.Write([]byte("abc"))
+			b.CloseWithError(closed)
+		}()
+		var got string
+		for {
+			s, err := read(b, 8)
+			got += s
+			if err != nil {
+				if got != "abc" || err != closed {
+					t.Errorf("Read got %q, %v; want \"abc\", %v", got, err, closed)
+				}
+				break
+			}
+		}
+	})
+}
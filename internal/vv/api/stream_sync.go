@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const streamMaxHeaderSize = 1 << 20
+
+// streamSync finds codec headers and sync points of audio stream to share it with listeners joined midway.
+type streamSync interface {
+	// write returns stream data ends at sync point; rest of p is kept until next write.
+	// returned data is valid until next write.
+	write(p []byte) []byte
+	// header returns codec headers for listeners joined midway.
+	header() []byte
+}
+
+// streamSyncs are audio formats which listeners can join midway.
+var streamSyncs = map[string]func() streamSync{
+	// mp3 and aac decoders resync to next frame
+	"audio/mpeg":      func() streamSync { return passSync{} },
+	"audio/aac":       func() streamSync { return passSync{} },
+	"audio/aacp":      func() streamSync { return passSync{} },
+	"audio/ogg":       func() streamSync { return &oggSync{} },
+	"application/ogg": func() streamSync { return &oggSync{} },
+	"audio/flac":      func() streamSync { return &flacSync{} },
+}
+
+// passSync is a streamSync for formats without codec headers.
+type passSync struct{}
+
+func (passSync) write(p []byte) []byte { return p }
+func (passSync) header() []byte        { return nil }
+
+var oggCapture = []byte("OggS")
+
+// oggSync splits Ogg stream by page and keeps header pages of current logical stream.
+type oggSync struct {
+	buf        []byte
+	off        int // written size of buf
+	hdr        []byte
+	collecting bool
+}
+
+func (o *oggSync) write(p []byte) []byte {
+	o.buf = append(o.buf[:0], o.buf[o.off:]...)
+	o.buf = append(o.buf, p...)
+	o.off = oggPages(o.buf, o.page)
+	return o.buf[:o.off]
+}
+
+// oggPages calls f for each complete Ogg page in b and returns processed size of b.
+// broken data is skipped.
+func oggPages(b []byte, f func(page []byte)) int {
+	i := 0
+	for len(b)-i >= 27 {
+		rest := b[i:]
+		if !bytes.HasPrefix(rest, oggCapture) {
+			// skips broken data
+			j := bytes.Index(rest[1:], oggCapture)
+			if j == -1 {
+				i = len(b) - len(oggCapture) + 1
+				break
+			}
+			i += j + 1
+			continue
+		}
+		segments := int(rest[26])
+		if len(rest) < 27+segments {
+			break
+		}
+		size := 27 + segments
+		for _, s := range rest[27 : 27+segments] {
+			size += int(s)
+		}
+		if len(rest) < size {
+			break
+		}
+		f(rest[:size])
+		i += size
+	}
+	return i
+}
+
+// oggBOS reports whether page is a first page of logical stream.
+func oggBOS(page []byte) bool {
+	return page[5]&0x02 != 0
+}
+
+// page keeps BOS page and following header pages which have no granule position.
+func (o *oggSync) page(p []byte) {
+	bos := oggBOS(p)
+	granule := binary.LittleEndian.Uint64(p[6:14])
+	switch {
+	case bos && !o.collecting:
+		// new chained stream
+		o.hdr = append([]byte{}, p...)
+		o.collecting = true
+	case o.collecting && (bos || granule == 0 || granule == ^uint64(0)) && len(o.hdr)+len(p) <= streamMaxHeaderSize:
+		o.hdr = append(o.hdr, p...)
+	default:
+		o.collecting = false
+	}
+}
+
+func (o *oggSync) header() []byte {
+	return o.hdr
+}
+
+// flacSync keeps FLAC stream marker and metadata blocks.
+// listeners joined midway receives data from middle of frame; FLAC decoders resync to next frame.
+type flacSync struct {
+	buf  []byte
+	hdr  []byte
+	done bool
+}
+
+func (f *flacSync) write(p []byte) []byte {
+	if f.done {
+		return p
+	}
+	f.buf = append(f.buf, p...)
+	if len(f.buf) < 4 {
+		return p
+	}
+	if !bytes.HasPrefix(f.buf, []byte("fLaC")) || len(f.buf) > streamMaxHeaderSize {
+		f.done, f.buf = true, nil
+		return p
+	}
+	for i := 4; len(f.buf)-i >= 4; {
+		last := f.buf[i]&0x80 != 0
+		i += 4 + (int(f.buf[i+1])<<16 | int(f.buf[i+2])<<8 | int(f.buf[i+3]))
+		if i > len(f.buf) {
+			break
+		}
+		if last {
+			f.hdr = f.buf[:i:i]
+			f.done, f.buf = true, nil
+			break
+		}
+	}
+	return p
+}
+
+func (f *flacSync) header() []byte {
+	return f.hdr
+}
@@ -4,20 +4,24 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"sync"
 )
 
 var goVersion = fmt.Sprintf("%s %s %s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
 
 type httpVersion struct {
-	App string `json:"app"`
-	Go  string `json:"go"`
-	MPD string `json:"mpd"`
+	App   string `json:"app"`
+	Go    string `json:"go"`
+	MPD   string `json:"mpd"`
+	Stale bool   `json:"stale,omitempty"`
 }
 
 type VersionHandler struct {
 	mpd     MPDVersion
 	cache   *cache
 	version string
+	data    *httpVersion
+	mu      sync.Mutex
 }
 
 // MPDVersion represents mpd api for Version API.
@@ -34,6 +38,7 @@ func NewVersionHandler(mpd MPDVersion, version string) (*VersionHandler, error)
 		mpd:     mpd,
 		cache:   c,
 		version: version,
+		data:    &httpVersion{App: version, Go: goVersion},
 	}, nil
 }
 
@@ -42,13 +47,28 @@ func (a *VersionHandler) Update() error {
 	if len(mpdVersion) == 0 {
 		mpdVersion = "unknown"
 	}
-	_, err := a.cache.SetIfModified(&httpVersion{App: a.version, Go: goVersion, MPD: mpdVersion})
-	return err
+	return a.set(func(v *httpVersion) { v.MPD = mpdVersion })
 }
 
 func (a *VersionHandler) UpdateNoMPD() error {
-	_, err := a.cache.SetIfModified(&httpVersion{App: a.version, Go: goVersion})
-	return err
+	return a.set(func(v *httpVersion) { v.MPD = "" })
+}
+
+// SetStale sets whether api caches are restored from snapshot or not updated by mpd.
+func (a *VersionHandler) SetStale(stale bool) error {
+	return a.set(func(v *httpVersion) { v.Stale = stale })
+}
+
+func (a *VersionHandler) set(f func(*httpVersion)) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	data := *a.data
+	f(&data)
+	if _, err := a.cache.SetIfModified(&data); err != nil {
+		return err
+	}
+	a.data = &data
+	return nil
 }
 
 // ServeHTTP responses version as json format.
@@ -495,6 +495,10 @@ class HTTP {
         };
         xhr.open("POST", path, true);
         xhr.setRequestHeader("Content-Type", "application/json");
+        const csrf = document.cookie.split("; ").find(v => v.startsWith("vv_csrf="));
+        if (csrf) {
+            xhr.setRequestHeader("X-CSRF-Token", csrf.substring("vv_csrf=".length));
+        }
         xhr.send(JSON.stringify(obj));
     }
 }
@@ -18,7 +18,7 @@ type Config struct {
 	LocalDir     string    // path to asset files directory
 	LastModified time.Time // asset LastModified
 	Logger       interface {
-		Debugf(format string, v ...interface{})
+		Debugw(msg string, keysAndValues ...interface{})
 	}
 }
 
@@ -63,7 +63,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
-		h.conf.Logger.Debugf("assets: %s: %v", r.URL.Path, err)
+		h.conf.Logger.Debugw("assets: failed to serve local file", "request_id", log.RequestID(r.Context()), "path", r.URL.Path, "error", err)
 
 	}
 	i, ok := embedIndex(r.URL.Path)
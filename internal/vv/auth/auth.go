@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles
+const (
+	RoleViewer     = "viewer"     // GET only
+	RoleController = "controller" // playback and queue
+	RoleAdmin      = "admin"      // storage, outputs, rescans
+)
+
+const (
+	// PathLogin is a login page path.
+	PathLogin = "/login"
+	// PathLogout is a logout api path.
+	PathLogout = "/logout"
+
+	cookieSession         = "vv_session"
+	defaultSessionTimeout = 30 * 24 * time.Hour
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:     1,
+	RoleController: 2,
+	RoleAdmin:      3,
+}
+
+// controllerPaths are api paths which controller role can POST.
+var controllerPaths = map[string]struct{}{
+	"/api/music":                    {},
+	"/api/music/playlist":           {},
+	"/api/music/playlist/snapshots": {},
+	"/api/music/schedule":           {},
+}
+
+// adminPaths are api paths which only admin role can GET.
+var adminPaths = map[string]struct{}{
+	"/api/audit": {},
+}
+
+// dummyHash is used to compare password for unknown user to make response time constant.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("vv"), bcrypt.MinCost)
+
+// User represents local user.
+type User struct {
+	Name     string
+	Password string // bcrypt hashed password
+	Role     string
+}
+
+// Token represents api token for scripts.
+type Token struct {
+	Name  string
+	Token string
+	Role  string
+}
+
+// Config is options for auth Handler.
+type Config struct {
+	Users          []User
+	Tokens         []Token
+	Anonymous      string        // role for unauthenticated request; denies unauthenticated request if empty
+	SessionTimeout time.Duration // default: 30 days
+}
+
+// Handler serves login page and authenticates requests.
+type Handler struct {
+	conf     *Config
+	users    map[string]*User
+	tokens   []*Token
+	sessions map[string]*session
+	mu       sync.Mutex
+}
+
+type session struct {
+	user    string
+	role    string
+	expires time.Time
+}
+
+// New creates Handler.
+func New(c *Config) (*Handler, error) {
+	conf := &Config{}
+	if c != nil {
+		*conf = *c
+	}
+	if conf.SessionTimeout == 0 {
+		conf.SessionTimeout = defaultSessionTimeout
+	}
+	if _, ok := roleLevels[conf.Anonymous]; !ok && len(conf.Anonymous) != 0 {
+		return nil, fmt.Errorf("anonymous: unknown role: %q", conf.Anonymous)
+	}
+	h := &Handler{
+		conf:     conf,
+		users:    make(map[string]*User, len(conf.Users)),
+		sessions: map[string]*session{},
+	}
+	for i := range conf.Users {
+		u := conf.Users[i]
+		if len(u.Name) == 0 {
+			return nil, fmt.Errorf("users: #%d: name is empty", i)
+		}
+		if _, ok := h.users[u.Name]; ok {
+			return nil, fmt.Errorf("users: %s: duplicated", u.Name)
+		}
+		if _, ok := roleLevels[u.Role]; !ok {
+			return nil, fmt.Errorf("users: %s: unknown role: %q", u.Name, u.Role)
+		}
+		if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+			return nil, fmt.Errorf("users: %s: password must be bcrypt hash: %w", u.Name, err)
+		}
+		h.users[u.Name] = &u
+	}
+	for i := range conf.Tokens {
+		t := conf.Tokens[i]
+		if len(t.Token) < 16 {
+			return nil, fmt.Errorf("tokens: %s: token must be at least 16 characters", t.Name)
+		}
+		if _, ok := roleLevels[t.Role]; !ok {
+			return nil, fmt.Errorf("tokens: %s: unknown role: %q", t.Name, t.Role)
+		}
+		h.tokens = append(h.tokens, &t)
+	}
+	return h, nil
+}
+
+// ServeHTTP serves login page and logout api.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case PathLogin:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.serveLoginPage(w, r, http.StatusOK, "")
+		case http.MethodPost:
+			h.login(w, r)
+		default:
+			writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	case PathLogout:
+		if r.Method != http.MethodPost {
+			writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		h.logout(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Protect returns http.Handler which serves next if request has enough role.
+// Unauthenticated api requests get 401 json error and page requests are redirected to login page.
+func (h *Handler) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, role, ok := h.authenticate(r)
+		if !ok {
+			if len(h.conf.Anonymous) == 0 {
+				h.unauthorized(w, r)
+				return
+			}
+			role = h.conf.Anonymous
+		}
+		if required := RequiredRole(r); roleLevels[role] < roleLevels[required] {
+			if !ok {
+				h.unauthorized(w, r)
+				return
+			}
+			writeHTTPError(w, http.StatusForbidden, fmt.Errorf("requires %s role", required))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), name, role)))
+	})
+}
+
+// RequiredRole returns role to serve request.
+func RequiredRole(r *http.Request) string {
+	if _, ok := adminPaths[r.URL.Path]; ok {
+		return RoleAdmin
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleViewer
+	}
+	if _, ok := controllerPaths[r.URL.Path]; ok {
+		return RoleController
+	}
+	return RoleAdmin
+}
+
+func (h *Handler) authenticate(r *http.Request) (name, role string, ok bool) {
+	if v := r.Header.Get("Authorization"); strings.HasPrefix(v, "Bearer ") {
+		token := []byte(strings.TrimPrefix(v, "Bearer "))
+		for _, t := range h.tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Token), token) == 1 {
+				return t.Name, t.Role, true
+			}
+		}
+		return "", "", false
+	}
+	c, err := r.Cookie(cookieSession)
+	if err != nil {
+		return "", "", false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[c.Value]
+	if !ok {
+		return "", "", false
+	}
+	if time.Now().After(s.expires) {
+		delete(h.sessions, c.Value)
+		return "", "", false
+	}
+	return s.user, s.role, true
+}
+
+func (h *Handler) unauthorized(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.Header.Get("Upgrade") != "websocket" {
+		http.Redirect(w, r, PathLogin+"?"+url.Values{"next": {r.URL.RequestURI()}}.Encode(), http.StatusSeeOther)
+		return
+	}
+	w.Header().Add("WWW-Authenticate", `Bearer realm="vv"`)
+	writeHTTPError(w, http.StatusUnauthorized, errors.New("authentication required"))
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
+	name, password := r.PostFormValue("name"), r.PostFormValue("password")
+	u, ok := h.users[name]
+	hash := dummyHash
+	if ok {
+		hash = []byte(u.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		h.serveLoginPage(w, r, http.StatusUnauthorized, "invalid name or password")
+		return
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	id := hex.EncodeToString(b)
+	now := time.Now()
+	expires := now.Add(h.conf.SessionTimeout)
+	h.mu.Lock()
+	// prunes expired sessions which are never presented again
+	for k, s := range h.sessions {
+		if now.After(s.expires) {
+			delete(h.sessions, k)
+		}
+	}
+	h.sessions[id] = &session{user: u.Name, role: u.Role, expires: expires}
+	h.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieSession,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, redirectPath(r.PostFormValue("next")), http.StatusSeeOther)
+}
+
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(cookieSession); err == nil {
+		h.mu.Lock()
+		delete(h.sessions, c.Value)
+		h.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieSession,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, PathLogin, http.StatusSeeOther)
+}
+
+// redirectPath returns local path to redirect after login.
+func redirectPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width,initial-scale=1">
+<title>vv - login</title>
+<style>
+body{font-family:sans-serif;display:flex;justify-content:center;margin-top:20vh;background:#222;color:#eee}
+form{display:flex;flex-direction:column;gap:.5em;width:16em}
+input{padding:.4em}
+p{color:#f66}
+</style>
+</head>
+<body>
+<form method="post" action="/login">
+<h1>vv</h1>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<input type="text" name="name" placeholder="name" autocomplete="username" required autofocus>
+<input type="password" name="password" placeholder="password" autocomplete="current-password" required>
+<input type="hidden" name="next" value="{{.Next}}">
+<input type="submit" value="login">
+</form>
+</body>
+</html>
+`))
+
+func (h *Handler) serveLoginPage(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	next := r.URL.Query().Get("next")
+	if r.Method == http.MethodPost {
+		next = r.PostFormValue("next")
+	}
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	loginPage.Execute(w, struct{ Error, Next string }{msg, redirectPath(next)})
+}
+
+type contextKey string
+
+const contextUser = contextKey("user")
+
+type user struct {
+	name string
+	role string
+}
+
+func withUser(ctx context.Context, name, role string) context.Context {
+	return context.WithValue(ctx, contextUser, &user{name: name, role: role})
+}
+
+// UserName returns authenticated user or token name from context.
+func UserName(ctx context.Context) (string, bool) {
+	if u, ok := ctx.Value(contextUser).(*user); ok && len(u.name) != 0 {
+		return u.name, true
+	}
+	return "", false
+}
+
+// Role returns role of request from context.
+func Role(ctx context.Context) (string, bool) {
+	if u, ok := ctx.Value(contextUser).(*user); ok {
+		return u.role, true
+	}
+	return "", false
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	b, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testHandler(t *testing.T, anonymous string) *Handler {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to generate password hash: %v", err)
+	}
+	h, err := New(&Config{
+		Users: []User{
+			{Name: "alice", Password: string(hash), Role: RoleAdmin},
+			{Name: "bob", Password: string(hash), Role: RoleViewer},
+		},
+		Tokens: []Token{
+			{Name: "cli", Token: "0123456789abcdef", Role: RoleController},
+		},
+		Anonymous: anonymous,
+	})
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	return h
+}
+
+func TestNew(t *testing.T) {
+	for label, c := range map[string]*Config{
+		"unknown role":      {Users: []User{{Name: "alice", Password: "$2a$04$abcdefghijklmnopqrstuu2cWn7p5tMz0OkJ/2p4MwH3f2b6DHp5S", Role: "root"}}},
+		"plain password":    {Users: []User{{Name: "alice", Password: "pass", Role: RoleAdmin}}},
+		"short token":       {Tokens: []Token{{Name: "cli", Token: "foo", Role: RoleAdmin}}},
+		"unknown anonymous": {Anonymous: "guest"},
+	} {
+		t.Run(label, func(t *testing.T) {
+			if _, err := New(c); err == nil {
+				t.Errorf("New got nil error; want error")
+			}
+		})
+	}
+}
+
+func TestHandlerProtect(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _ := UserName(r.Context())
+		role, _ := Role(r.Context())
+		w.Write([]byte(name + ":" + role))
+	})
+	for label, tt := range map[string]struct {
+		anonymous string
+		method    string
+		path      string
+		header    http.Header
+		status    int
+		want      string
+	}{
+		"no auth/api": {
+			method: http.MethodGet, path: "/api/music",
+			status: http.StatusUnauthorized, want: `{"error":"authentication required"}`,
+		},
+		"no auth/page": {
+			method: http.MethodGet, path: "/",
+			status: http.StatusSeeOther,
+		},
+		"anonymous/GET": {
+			anonymous: RoleViewer, method: http.MethodGet, path: "/api/music",
+			status: http.StatusOK, want: ":viewer",
+		},
+		"anonymous/POST": {
+			anonymous: RoleViewer, method: http.MethodPost, path: "/api/music",
+			status: http.StatusUnauthorized, want: `{"error":"authentication required"}`,
+		},
+		"token/controller": {
+			method: http.MethodPost, path: "/api/music",
+			header: http.Header{"Authorization": {"Bearer 0123456789abcdef"}},
+			status: http.StatusOK, want: "cli:controller",
+		},
+		"token/admin": {
+			method: http.MethodPost, path: "/api/music/storage",
+			header: http.Header{"Authorization": {"Bearer 0123456789abcdef"}},
+			status: http.StatusForbidden, want: `{"error":"requires admin role"}`,
+		},
+		"token/admin GET": {
+			method: http.MethodGet, path: "/api/audit",
+			header: http.Header{"Authorization": {"Bearer 0123456789abcdef"}},
+			status: http.StatusForbidden, want: `{"error":"requires admin role"}`,
+		},
+		"token/invalid": {
+			method: http.MethodGet, path: "/api/music",
+			header: http.Header{"Authorization": {"Bearer foo"}},
+			status: http.StatusUnauthorized, want: `{"error":"authentication required"}`,
+		},
+	} {
+		t.Run(label, func(t *testing.T) {
+			h := testHandler(t, tt.anonymous)
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			h.Protect(next).ServeHTTP(w, r)
+			if status := w.Result().StatusCode; status != tt.status {
+				t.Errorf("got status %d; want %d", status, tt.status)
+			}
+			if got := w.Body.String(); len(tt.want) != 0 && got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerLogin(t *testing.T) {
+	h := testHandler(t, "")
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _ := UserName(r.Context())
+		w.Write([]byte(name))
+	})
+	login := func(name, password string) *http.Response {
+		r := httptest.NewRequest(http.MethodPost, PathLogin, strings.NewReader(url.Values{"name": {name}, "password": {password}, "next": {"/foo"}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+	if resp := login("alice", "wrong"); resp.StatusCode != http.StatusUnauthorized || len(resp.Cookies()) != 0 {
+		t.Errorf("login with wrong password got %d, %v; want %d, no cookies", resp.StatusCode, resp.Cookies(), http.StatusUnauthorized)
+	}
+	if resp := login("carol", "pass"); resp.StatusCode != http.StatusUnauthorized || len(resp.Cookies()) != 0 {
+		t.Errorf("login with unknown user got %d, %v; want %d, no cookies", resp.StatusCode, resp.Cookies(), http.StatusUnauthorized)
+	}
+	resp := login("bob", "pass")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/foo" || len(resp.Cookies()) != 1 {
+		t.Fatalf("login got %d, %s, %v; want %d, /foo, session cookie", resp.StatusCode, resp.Header.Get("Location"), resp.Cookies(), http.StatusSeeOther)
+	}
+	cookie := resp.Cookies()[0]
+
+	// expired sessions are pruned on login
+	h.mu.Lock()
+	h.sessions["expired"] = &session{user: "alice", role: RoleAdmin, expires: time.Now().Add(-time.Second)}
+	h.mu.Unlock()
+	if resp := login("alice", "pass"); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("login got %d; want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	h.mu.Lock()
+	if _, ok := h.sessions["expired"]; ok || len(h.sessions) != 2 {
+		t.Errorf("got %d sessions, expired session found: %v; want 2 sessions without expired session", len(h.sessions), ok)
+	}
+	h.mu.Unlock()
+
+	r := httptest.NewRequest(http.MethodGet, "/api/music", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	h.Protect(next).ServeHTTP(w, r)
+	if status, got := w.Result().StatusCode, w.Body.String(); status != http.StatusOK || got != "bob" {
+		t.Errorf("GET with session got %d %s; want %d %s", status, got, http.StatusOK, "bob")
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/music", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	h.Protect(next).ServeHTTP(w, r)
+	if status := w.Result().StatusCode; status != http.StatusForbidden {
+		t.Errorf("POST by viewer got %d; want %d", status, http.StatusForbidden)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, PathLogout, nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	r = httptest.NewRequest(http.MethodGet, "/api/music", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	h.Protect(next).ServeHTTP(w, r)
+	if status := w.Result().StatusCode; status != http.StatusUnauthorized {
+		t.Errorf("GET after logout got %d; want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRedirectPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                "/",
+		"/foo?bar=baz":    "/foo?bar=baz",
+		"//example.com":   "/",
+		"https://foo/bar": "/",
+		"/\\example.com":  "/",
+	} {
+		if got := redirectPath(in); got != want {
+			t.Errorf("redirectPath(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
@@ -32,7 +32,7 @@ type Config struct {
 	TreeOrder    []string  // order of playlist tree(default: DefaultTreeOrder)
 	Data         []byte    // index.html data(default: embed index.html)
 	Logger       interface {
-		Debugf(format string, v ...interface{})
+		Debugw(msg string, keysAndValues ...interface{})
 	}
 }
 
@@ -166,7 +166,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			return
 		}
-		h.conf.Logger.Debugf("vv: %v", err)
+		h.conf.Logger.Debugw("vv: failed to serve local file", "request_id", log.RequestID(r.Context()), "error", err)
 	}
 
 	tag, index := determineLang(r)
@@ -0,0 +1,668 @@
+// Package mpris exports MPRIS2 media player on D-Bus session bus for desktop media keys and widgets.
+package mpris
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/dbus"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+const (
+	defaultName          = "vv"
+	defaultRetryInterval = 5 * time.Second
+	maxRetryInterval     = 5 * time.Minute
+	defaultTimeout       = 10 * time.Second
+	// seekThreshold is a max difference between expected and actual elapsed time to detect seeking.
+	seekThreshold = 1500 * time.Millisecond
+
+	objectPath          dbus.ObjectPath = "/org/mpris/MediaPlayer2"
+	noTrack             dbus.ObjectPath = "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+	ifaceRoot                           = "org.mpris.MediaPlayer2"
+	ifacePlayer                         = "org.mpris.MediaPlayer2.Player"
+	ifaceProperties                     = "org.freedesktop.DBus.Properties"
+	ifaceIntrospectable                 = "org.freedesktop.DBus.Introspectable"
+	ifacePeer                           = "org.freedesktop.DBus.Peer"
+)
+
+// D-Bus errors
+var (
+	errUnknownMethod    = &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod", Message: "unknown method"}
+	errUnknownObject    = &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownObject", Message: "unknown object"}
+	errUnknownInterface = &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownInterface", Message: "unknown interface"}
+	errUnknownProperty  = &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownProperty", Message: "unknown property"}
+	errReadOnly         = &dbus.Error{Name: "org.freedesktop.DBus.Error.PropertyReadOnly", Message: "property is read only"}
+	errInvalidArgs      = &dbus.Error{Name: "org.freedesktop.DBus.Error.InvalidArgs", Message: "invalid arguments"}
+	errNotSupported     = &dbus.Error{Name: "org.freedesktop.DBus.Error.NotSupported", Message: "not supported"}
+)
+
+// Logger is a logging interface for Bridge.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// MPD represents mpd commands for MPRIS methods and properties.
+type MPD interface {
+	Play(context.Context, int) error
+	Pause(context.Context, bool) error
+	Stop(context.Context) error
+	Next(context.Context) error
+	Previous(context.Context) error
+	SetVol(context.Context, int) error
+	Random(context.Context, bool) error
+	Repeat(context.Context, bool) error
+	Single(context.Context, bool) error
+	SeekCur(context.Context, float64) error
+}
+
+// Config is options for Bridge.
+type Config struct {
+	BusAddress    string        // D-Bus address(default: session bus)
+	Name          string        // bus name suffix of org.mpris.MediaPlayer2(default: vv)
+	Identity      string        // player name shown in desktop(default: vv)
+	ArtURLBase    string        // base url for relative cover image url(e.g. http://localhost:8080); relative cover is omitted if empty
+	RetryInterval time.Duration // initial reconnect interval; doubles on each failure up to 5 minutes(default: 5 seconds)
+	Timeout       time.Duration // timeout for connecting and mpd commands(default: 10 seconds)
+	Logger        Logger
+}
+
+// Bridge exports mpd status and current song as MPRIS2 player.
+// Bridge reconnects to message bus until Shutdown is called.
+type Bridge struct {
+	conf       *Config
+	mpd        MPD
+	status     *api.Status
+	statusTime time.Time
+	song       map[string][]string
+	update     chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+	mu         sync.Mutex
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+
+// New creates Bridge and starts background connection.
+func New(mpd MPD, c *Config) (*Bridge, error) {
+	conf := &Config{}
+	if c != nil {
+		*conf = *c
+	}
+	if len(conf.Name) == 0 {
+		conf.Name = defaultName
+	}
+	if !namePattern.MatchString(conf.Name) {
+		return nil, errors.New("invalid bus name: " + conf.Name)
+	}
+	if len(conf.Identity) == 0 {
+		conf.Identity = defaultName
+	}
+	conf.ArtURLBase = strings.TrimSuffix(conf.ArtURLBase, "/")
+	if conf.RetryInterval == 0 {
+		conf.RetryInterval = defaultRetryInterval
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.Logger == nil {
+		conf.Logger = nopLogger{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bridge{
+		conf:   conf,
+		mpd:    mpd,
+		update: make(chan struct{}, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go b.run(ctx)
+	return b, nil
+}
+
+// UpdateStatus sets player status.
+func (b *Bridge) UpdateStatus(s *api.Status) {
+	b.mu.Lock()
+	b.status = s
+	b.statusTime = time.Now()
+	b.mu.Unlock()
+	b.notify()
+}
+
+// UpdateCurrentSong sets current song.
+func (b *Bridge) UpdateCurrentSong(s map[string][]string) {
+	b.mu.Lock()
+	b.song = s
+	b.mu.Unlock()
+	b.notify()
+}
+
+// UpdateOutputs does nothing; MPRIS has no output property.
+func (b *Bridge) UpdateOutputs(map[string]*api.Output) {}
+
+func (b *Bridge) notify() {
+	select {
+	case b.update <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown disconnects from message bus.
+func (b *Bridge) Shutdown(ctx context.Context) error {
+	b.cancel()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bridge) run(ctx context.Context) {
+	defer close(b.done)
+	interval := b.conf.RetryInterval
+	for {
+		connected, err := b.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			interval = b.conf.RetryInterval
+		}
+		b.conf.Logger.Warnw("vv/mpris: disconnected", "error", err, "retry_after", interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// connect connects to message bus and serves until connection is closed.
+func (b *Bridge) connect(ctx context.Context) (bool, error) {
+	addr := b.conf.BusAddress
+	if len(addr) == 0 {
+		var err error
+		if addr, err = dbus.SessionBusAddress(); err != nil {
+			return false, err
+		}
+	}
+	dctx, cancel := context.WithTimeout(ctx, b.conf.Timeout)
+	defer cancel()
+	conn, err := dbus.Dial(dctx, addr, func(c *dbus.Conn, m *dbus.Message) {
+		ret, err := b.call(ctx, m)
+		if err != nil {
+			c.ReplyError(m, err)
+			return
+		}
+		c.Reply(m, ret...)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if err := conn.RequestName(dctx, ifaceRoot+"."+b.conf.Name); err != nil {
+		return false, err
+	}
+	b.conf.Logger.Debugw("vv/mpris: registered", "name", ifaceRoot+"."+b.conf.Name)
+	// properties are already published by Get and GetAll
+	prev := b.playerProperties()
+	var prevPos time.Duration
+	var prevTime time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-conn.Done():
+			return true, conn.Err()
+		case <-b.update:
+			props := b.playerProperties()
+			changed := map[string]dbus.Variant{}
+			for k, v := range props {
+				if k == "Position" {
+					continue
+				}
+				if !reflect.DeepEqual(prev[k], v) {
+					changed[k] = v
+				}
+			}
+			if len(changed) != 0 {
+				if err := conn.Emit(objectPath, ifaceProperties, "PropertiesChanged", ifacePlayer, changed, []string{}); err != nil {
+					return true, err
+				}
+			}
+			pos, now := b.position()
+			if _, songChanged := changed["Metadata"]; !songChanged && !prevTime.IsZero() {
+				expected := prevPos
+				if prev["PlaybackStatus"].Value == "Playing" {
+					expected += now.Sub(prevTime)
+				}
+				if d := pos - expected; d > seekThreshold || d < -seekThreshold {
+					if err := conn.Emit(objectPath, ifacePlayer, "Seeked", int64(pos/time.Microsecond)); err != nil {
+						return true, err
+					}
+				}
+			}
+			prev, prevPos, prevTime = props, pos, now
+		}
+	}
+}
+
+// position returns current song position and its base time.
+func (b *Bridge) position() (time.Duration, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.status == nil || b.status.SongElapsed == nil {
+		return 0, b.statusTime
+	}
+	return time.Duration(*b.status.SongElapsed * float64(time.Second)), b.statusTime
+}
+
+// currentPosition returns estimated song position at now.
+func (b *Bridge) currentPosition() time.Duration {
+	b.mu.Lock()
+	playing := b.status != nil && b.status.State != nil && *b.status.State == "play"
+	b.mu.Unlock()
+	pos, t := b.position()
+	if playing {
+		pos += time.Since(t)
+	}
+	return pos
+}
+
+func (b *Bridge) rootProperties() map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"CanQuit":             dbus.MakeVariant(false),
+		"CanRaise":            dbus.MakeVariant(false),
+		"HasTrackList":        dbus.MakeVariant(false),
+		"Identity":            dbus.MakeVariant(b.conf.Identity),
+		"SupportedUriSchemes": dbus.MakeVariant([]string{}),
+		"SupportedMimeTypes":  dbus.MakeVariant([]string{}),
+	}
+}
+
+func (b *Bridge) playerProperties() map[string]dbus.Variant {
+	b.mu.Lock()
+	status, song := b.status, b.song
+	b.mu.Unlock()
+	if status == nil {
+		status = &api.Status{}
+	}
+	playback := "Stopped"
+	if status.State != nil {
+		switch *status.State {
+		case "play":
+			playback = "Playing"
+		case "pause":
+			playback = "Paused"
+		}
+	}
+	loop := "None"
+	if status.Repeat != nil && *status.Repeat {
+		loop = "Playlist"
+		if status.Single != nil && *status.Single {
+			loop = "Track"
+		}
+	}
+	var volume float64
+	if status.Volume != nil && *status.Volume > 0 {
+		volume = float64(*status.Volume) / 100
+	}
+	metadata := b.metadata(song)
+	_, canSeek := metadata["mpris:length"]
+	return map[string]dbus.Variant{
+		"PlaybackStatus": dbus.MakeVariant(playback),
+		"LoopStatus":     dbus.MakeVariant(loop),
+		"Rate":           dbus.MakeVariant(1.0),
+		"Shuffle":        dbus.MakeVariant(status.Random != nil && *status.Random),
+		"Metadata":       dbus.MakeVariant(metadata),
+		"Volume":         dbus.MakeVariant(volume),
+		"Position":       dbus.MakeVariant(int64(b.currentPosition() / time.Microsecond)),
+		"MinimumRate":    dbus.MakeVariant(1.0),
+		"MaximumRate":    dbus.MakeVariant(1.0),
+		"CanGoNext":      dbus.MakeVariant(true),
+		"CanGoPrevious":  dbus.MakeVariant(true),
+		"CanPlay":        dbus.MakeVariant(true),
+		"CanPause":       dbus.MakeVariant(true),
+		"CanSeek":        dbus.MakeVariant(canSeek),
+		"CanControl":     dbus.MakeVariant(true),
+	}
+}
+
+// metadata converts song to MPRIS metadata.
+func (b *Bridge) metadata(song map[string][]string) map[string]dbus.Variant {
+	id := tag(song, "Id")
+	if len(id) == 0 {
+		return map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(noTrack)}
+	}
+	ret := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(trackID(id)),
+		"xesam:url":     dbus.MakeVariant(tag(song, "file")),
+	}
+	for k, v := range map[string]string{"xesam:title": "Title", "xesam:album": "Album"} {
+		if s := tag(song, v); len(s) != 0 {
+			ret[k] = dbus.MakeVariant(s)
+		}
+	}
+	for k, v := range map[string]string{"xesam:artist": "Artist", "xesam:albumArtist": "AlbumArtist", "xesam:genre": "Genre", "xesam:composer": "Composer"} {
+		if s := song[v]; len(s) != 0 {
+			ret[k] = dbus.MakeVariant(s)
+		}
+	}
+	for k, v := range map[string]string{"xesam:trackNumber": "Track", "xesam:discNumber": "Disc"} {
+		// track number may be "1/10"
+		if i, err := strconv.Atoi(strings.SplitN(tag(song, v), "/", 2)[0]); err == nil {
+			ret[k] = dbus.MakeVariant(int32(i))
+		}
+	}
+	if d, err := strconv.ParseFloat(tag(song, "duration"), 64); err == nil {
+		ret["mpris:length"] = dbus.MakeVariant(int64(d * 1e6))
+	} else if d, err := strconv.ParseFloat(tag(song, "Time"), 64); err == nil {
+		ret["mpris:length"] = dbus.MakeVariant(int64(d * 1e6))
+	}
+	// cover is converted by api ImageProviders
+	if cover := tag(song, "cover"); len(cover) != 0 {
+		if strings.HasPrefix(cover, "/") {
+			if len(b.conf.ArtURLBase) != 0 {
+				ret["mpris:artUrl"] = dbus.MakeVariant(b.conf.ArtURLBase + cover)
+			}
+		} else {
+			ret["mpris:artUrl"] = dbus.MakeVariant(cover)
+		}
+	}
+	return ret
+}
+
+func trackID(id string) dbus.ObjectPath {
+	return objectPath + "/vv/song/" + dbus.ObjectPath(id)
+}
+
+func tag(song map[string][]string, key string) string {
+	if v := song[key]; len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// call handles method call message and returns reply body.
+func (b *Bridge) call(ctx context.Context, m *dbus.Message) ([]interface{}, *dbus.Error) {
+	if m.Interface == ifacePeer && m.Member == "Ping" {
+		return nil, nil
+	}
+	if m.Path != objectPath {
+		return nil, errUnknownObject
+	}
+	ctx, cancel := context.WithTimeout(ctx, b.conf.Timeout)
+	defer cancel()
+	switch m.Interface + "." + m.Member {
+	case ifaceIntrospectable + ".Introspect":
+		return []interface{}{introspection}, nil
+	case ifaceProperties + ".Get":
+		iface, name, ok := stringArgs(m.Body)
+		if !ok {
+			return nil, errInvalidArgs
+		}
+		props, err := b.properties(iface)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := props[name]
+		if !ok {
+			return nil, errUnknownProperty
+		}
+		return []interface{}{v}, nil
+	case ifaceProperties + ".GetAll":
+		if len(m.Body) != 1 {
+			return nil, errInvalidArgs
+		}
+		iface, _ := m.Body[0].(string)
+		props, err := b.properties(iface)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{props}, nil
+	case ifaceProperties + ".Set":
+		iface, name, ok := stringArgs(m.Body)
+		if !ok || len(m.Body) != 3 {
+			return nil, errInvalidArgs
+		}
+		v, ok := m.Body[2].(dbus.Variant)
+		if !ok {
+			return nil, errInvalidArgs
+		}
+		return nil, b.set(ctx, iface, name, v.Value)
+	case ifaceRoot + ".Raise", ifaceRoot + ".Quit":
+		return nil, nil
+	case ifacePlayer + ".Next":
+		return nil, mpdError(b.mpd.Next(ctx))
+	case ifacePlayer + ".Previous":
+		return nil, mpdError(b.mpd.Previous(ctx))
+	case ifacePlayer + ".Pause":
+		return nil, mpdError(b.mpd.Pause(ctx, true))
+	case ifacePlayer + ".PlayPause":
+		if b.playerProperties()["PlaybackStatus"].Value == "Playing" {
+			return nil, mpdError(b.mpd.Pause(ctx, true))
+		}
+		return nil, mpdError(b.mpd.Play(ctx, -1))
+	case ifacePlayer + ".Stop":
+		return nil, mpdError(b.mpd.Stop(ctx))
+	case ifacePlayer + ".Play":
+		return nil, mpdError(b.mpd.Play(ctx, -1))
+	case ifacePlayer + ".Seek":
+		if len(m.Body) != 1 {
+			return nil, errInvalidArgs
+		}
+		offset, ok := m.Body[0].(int64)
+		if !ok {
+			return nil, errInvalidArgs
+		}
+		pos := b.currentPosition() + time.Duration(offset)*time.Microsecond
+		if pos < 0 {
+			pos = 0
+		}
+		if length, ok := b.metadata(b.currentSong())["mpris:length"]; ok && int64(pos/time.Microsecond) > length.Value.(int64) {
+			return nil, mpdError(b.mpd.Next(ctx))
+		}
+		return nil, mpdError(b.mpd.SeekCur(ctx, pos.Seconds()))
+	case ifacePlayer + ".SetPosition":
+		if len(m.Body) != 2 {
+			return nil, errInvalidArgs
+		}
+		id, ok1 := m.Body[0].(dbus.ObjectPath)
+		pos, ok2 := m.Body[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, errInvalidArgs
+		}
+		meta := b.metadata(b.currentSong())
+		// ignores stale request
+		if meta["mpris:trackid"].Value != id || pos < 0 {
+			return nil, nil
+		}
+		if length, ok := meta["mpris:length"]; ok && pos > length.Value.(int64) {
+			return nil, nil
+		}
+		return nil, mpdError(b.mpd.SeekCur(ctx, float64(pos)/1e6))
+	case ifacePlayer + ".OpenUri":
+		return nil, errNotSupported
+	}
+	return nil, errUnknownMethod
+}
+
+func (b *Bridge) currentSong() map[string][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.song
+}
+
+func (b *Bridge) properties(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	switch iface {
+	case ifaceRoot:
+		return b.rootProperties(), nil
+	case ifacePlayer:
+		return b.playerProperties(), nil
+	}
+	return nil, errUnknownInterface
+}
+
+// set sets writable player property.
+func (b *Bridge) set(ctx context.Context, iface, name string, v interface{}) *dbus.Error {
+	if _, err := b.properties(iface); err != nil {
+		return err
+	}
+	if iface != ifacePlayer {
+		return errReadOnly
+	}
+	switch name {
+	case "Volume":
+		f, ok := v.(float64)
+		if !ok {
+			return errInvalidArgs
+		}
+		vol := int(math.Round(f * 100))
+		if vol < 0 {
+			vol = 0
+		} else if vol > 100 {
+			vol = 100
+		}
+		return mpdError(b.mpd.SetVol(ctx, vol))
+	case "Shuffle":
+		s, ok := v.(bool)
+		if !ok {
+			return errInvalidArgs
+		}
+		return mpdError(b.mpd.Random(ctx, s))
+	case "LoopStatus":
+		s, ok := v.(string)
+		if !ok {
+			return errInvalidArgs
+		}
+		var repeat, single bool
+		switch s {
+		case "None":
+		case "Track":
+			repeat, single = true, true
+		case "Playlist":
+			repeat = true
+		default:
+			return errInvalidArgs
+		}
+		if err := b.mpd.Repeat(ctx, repeat); err != nil {
+			return mpdError(err)
+		}
+		return mpdError(b.mpd.Single(ctx, single))
+	case "Rate":
+		// only 1.0 is supported
+		return nil
+	}
+	if _, ok := b.playerProperties()[name]; ok {
+		return errReadOnly
+	}
+	return errUnknownProperty
+}
+
+func stringArgs(body []interface{}) (string, string, bool) {
+	if len(body) < 2 {
+		return "", "", false
+	}
+	a, ok1 := body[0].(string)
+	b, ok2 := body[1].(string)
+	return a, b, ok1 && ok2
+}
+
+func mpdError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return &dbus.Error{Name: "org.freedesktop.DBus.Error.Failed", Message: err.Error()}
+}
+
+const introspection = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect"><arg name="data" direction="out" type="s"/></method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Peer">
+    <method name="Ping"/>
+  </interface>
+  <interface name="org.freedesktop.DBus.Properties">
+    <method name="Get">
+      <arg name="interface_name" direction="in" type="s"/>
+      <arg name="property_name" direction="in" type="s"/>
+      <arg name="value" direction="out" type="v"/>
+    </method>
+    <method name="GetAll">
+      <arg name="interface_name" direction="in" type="s"/>
+      <arg name="properties" direction="out" type="a{sv}"/>
+    </method>
+    <method name="Set">
+      <arg name="interface_name" direction="in" type="s"/>
+      <arg name="property_name" direction="in" type="s"/>
+      <arg name="value" direction="in" type="v"/>
+    </method>
+    <signal name="PropertiesChanged">
+      <arg name="interface_name" type="s"/>
+      <arg name="changed_properties" type="a{sv}"/>
+      <arg name="invalidated_properties" type="as"/>
+    </signal>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2">
+    <method name="Raise"/>
+    <method name="Quit"/>
+    <property name="CanQuit" type="b" access="read"/>
+    <property name="CanRaise" type="b" access="read"/>
+    <property name="HasTrackList" type="b" access="read"/>
+    <property name="Identity" type="s" access="read"/>
+    <property name="SupportedUriSchemes" type="as" access="read"/>
+    <property name="SupportedMimeTypes" type="as" access="read"/>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2.Player">
+    <method name="Next"/>
+    <method name="Previous"/>
+    <method name="Pause"/>
+    <method name="PlayPause"/>
+    <method name="Stop"/>
+    <method name="Play"/>
+    <method name="Seek"><arg name="Offset" direction="in" type="x"/></method>
+    <method name="SetPosition">
+      <arg name="TrackId" direction="in" type="o"/>
+      <arg name="Position" direction="in" type="x"/>
+    </method>
+    <method name="OpenUri"><arg name="Uri" direction="in" type="s"/></method>
+    <signal name="Seeked"><arg name="Position" type="x"/></signal>
+    <property name="PlaybackStatus" type="s" access="read"/>
+    <property name="LoopStatus" type="s" access="readwrite"/>
+    <property name="Rate" type="d" access="readwrite"/>
+    <property name="Shuffle" type="b" access="readwrite"/>
+    <property name="Metadata" type="a{sv}" access="read"/>
+    <property name="Volume" type="d" access="readwrite"/>
+    <property name="Position" type="x" access="read"/>
+    <property name="MinimumRate" type="d" access="read"/>
+    <property name="MaximumRate" type="d" access="read"/>
+    <property name="CanGoNext" type="b" access="read"/>
+    <property name="CanGoPrevious" type="b" access="read"/>
+    <property name="CanPlay" type="b" access="read"/>
+    <property name="CanPause" type="b" access="read"/>
+    <property name="CanSeek" type="b" access="read"/>
+    <property name="CanControl" type="b" access="read"/>
+  </interface>
+</node>
+`
+
+type nopLogger struct{}
+
+func (nopLogger) Debugw(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Warnw(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Errorw(msg string, keysAndValues ...interface{}) {}
@@ -0,0 +1,139 @@
+package mpris
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/dbus"
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+type testMPD chan string
+
+func (m testMPD) call(s string) error                    { m <- s; return nil }
+func (m testMPD) Play(_ context.Context, pos int) error  { return m.call(fmt.Sprintf("play %d", pos)) }
+func (m testMPD) Pause(_ context.Context, b bool) error  { return m.call(fmt.Sprintf("pause %v", b)) }
+func (m testMPD) Stop(context.Context) error             { return m.call("stop") }
+func (m testMPD) Next(context.Context) error             { return m.call("next") }
+func (m testMPD) Previous(context.Context) error         { return m.call("previous") }
+func (m testMPD) SetVol(_ context.Context, v int) error  { return m.call(fmt.Sprintf("setvol %d", v)) }
+func (m testMPD) Random(_ context.Context, b bool) error { return m.call(fmt.Sprintf("random %v", b)) }
+func (m testMPD) Repeat(_ context.Context, b bool) error { return m.call(fmt.Sprintf("repeat %v", b)) }
+func (m testMPD) Single(_ context.Context, b bool) error { return m.call(fmt.Sprintf("single %v", b)) }
+func (m testMPD) SeekCur(_ context.Context, t float64) error {
+	return m.call(fmt.Sprintf("seekcur %.1f", t))
+}
+
+func boolPtr(b bool) *bool        { return &b }
+func intPtr(i int) *int           { return &i }
+func floatPtr(f float64) *float64 { return &f }
+func stringPtr(s string) *string  { return &s }
+
+func TestBridge(t *testing.T) {
+	mpd := make(testMPD, 10)
+	b, err := New(mpd, &Config{
+		// no bus to connect
+		BusAddress:    "unix:path=" + filepath.Join(t.TempDir(), "bus"),
+		ArtURLBase:    "http://localhost:8080/",
+		RetryInterval: time.Hour,
+		Logger:        log.NewTestLogger(t),
+	})
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := b.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown got error %v; want nil", err)
+		}
+	}()
+	b.UpdateStatus(&api.Status{State: stringPtr("pause"), Volume: intPtr(40), Repeat: boolPtr(true), Single: boolPtr(false), Random: boolPtr(true), SongElapsed: floatPtr(10)})
+	b.UpdateCurrentSong(map[string][]string{
+		"Id": {"3"}, "file": {"foo.flac"}, "Title": {"foo"}, "Artist": {"bar", "baz"}, "Track": {"2/10"},
+		"duration": {"200.5"}, "cover": {"/api/music/images/foo.jpg"},
+	})
+	call := func(iface, member string, args ...interface{}) ([]interface{}, *dbus.Error) {
+		return b.call(context.Background(), &dbus.Message{Type: dbus.TypeMethodCall, Path: objectPath, Interface: iface, Member: member, Body: args})
+	}
+
+	t.Run("properties", func(t *testing.T) {
+		for k, want := range map[string]interface{}{
+			"PlaybackStatus": "Paused",
+			"LoopStatus":     "Playlist",
+			"Shuffle":        true,
+			"Volume":         0.4,
+			"Position":       int64(10000000),
+			"CanSeek":        true,
+			"Metadata": map[string]dbus.Variant{
+				"mpris:trackid":     dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/vv/song/3")),
+				"mpris:length":      dbus.MakeVariant(int64(200500000)),
+				"mpris:artUrl":      dbus.MakeVariant("http://localhost:8080/api/music/images/foo.jpg"),
+				"xesam:url":         dbus.MakeVariant("foo.flac"),
+				"xesam:title":       dbus.MakeVariant("foo"),
+				"xesam:artist":      dbus.MakeVariant([]string{"bar", "baz"}),
+				"xesam:trackNumber": dbus.MakeVariant(int32(2)),
+			},
+		} {
+			got, err := call(ifaceProperties, "Get", ifacePlayer, k)
+			if err != nil || len(got) != 1 || !reflect.DeepEqual(got[0], dbus.MakeVariant(want)) {
+				t.Errorf("Get(%s) got %v, %v; want %v", k, got, err, want)
+			}
+		}
+		got, err := call(ifaceProperties, "GetAll", ifaceRoot)
+		if err != nil || len(got) != 1 || got[0].(map[string]dbus.Variant)["Identity"].Value != "vv" {
+			t.Errorf("GetAll(%s) got %v, %v; want Identity vv", ifaceRoot, got, err)
+		}
+		if _, err := call(ifaceProperties, "Get", ifacePlayer, "Foo"); err != errUnknownProperty {
+			t.Errorf("Get(Foo) got error %v; want %v", err, errUnknownProperty)
+		}
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		for _, tt := range []struct {
+			iface  string
+			member string
+			args   []interface{}
+			want   []string
+			err    *dbus.Error
+		}{
+			{iface: ifacePlayer, member: "PlayPause", want: []string{"play -1"}},
+			{iface: ifacePlayer, member: "Next", want: []string{"next"}},
+			{iface: ifacePlayer, member: "Seek", args: []interface{}{int64(5000000)}, want: []string{"seekcur 15.0"}},
+			{iface: ifacePlayer, member: "Seek", args: []interface{}{int64(500000000)}, want: []string{"next"}},
+			{iface: ifacePlayer, member: "SetPosition", args: []interface{}{dbus.ObjectPath("/org/mpris/MediaPlayer2/vv/song/3"), int64(30000000)}, want: []string{"seekcur 30.0"}},
+			{iface: ifacePlayer, member: "SetPosition", args: []interface{}{dbus.ObjectPath("/org/mpris/MediaPlayer2/vv/song/2"), int64(30000000)}},
+			{iface: ifaceProperties, member: "Set", args: []interface{}{ifacePlayer, "Volume", dbus.MakeVariant(0.555)}, want: []string{"setvol 56"}},
+			{iface: ifaceProperties, member: "Set", args: []interface{}{ifacePlayer, "Shuffle", dbus.MakeVariant(false)}, want: []string{"random false"}},
+			{iface: ifaceProperties, member: "Set", args: []interface{}{ifacePlayer, "LoopStatus", dbus.MakeVariant("Track")}, want: []string{"repeat true", "single true"}},
+			{iface: ifaceProperties, member: "Set", args: []interface{}{ifacePlayer, "PlaybackStatus", dbus.MakeVariant("Playing")}, err: errReadOnly},
+			{iface: ifacePlayer, member: "OpenUri", args: []interface{}{"file:///foo.flac"}, err: errNotSupported},
+			{iface: ifacePlayer, member: "Foo", err: errUnknownMethod},
+		} {
+			_, err := call(tt.iface, tt.member, tt.args...)
+			if err != tt.err {
+				t.Errorf("%s.%s%v got error %v; want %v", tt.iface, tt.member, tt.args, err, tt.err)
+			}
+			for _, want := range tt.want {
+				select {
+				case got := <-mpd:
+					if got != want {
+						t.Errorf("%s.%s%v got mpd command %q; want %q", tt.iface, tt.member, tt.args, got, want)
+					}
+				default:
+					t.Errorf("%s.%s%v got no mpd command; want %q", tt.iface, tt.member, tt.args, want)
+				}
+			}
+			select {
+			case got := <-mpd:
+				t.Errorf("%s.%s%v got unexpected mpd command %q", tt.iface, tt.member, tt.args, got)
+			default:
+			}
+		}
+	})
+}
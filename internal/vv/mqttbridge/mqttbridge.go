@@ -0,0 +1,460 @@
+// Package mqttbridge publishes player state to MQTT broker and controls mpd by MQTT commands.
+//
+// Topics(prefix: vv):
+//
+//	vv/availability        online or offline(retained)
+//	vv/status              status api json(retained)
+//	vv/state               play, pause or stop(retained)
+//	vv/volume              volume 0-100(retained)
+//	vv/song                current song api json(retained)
+//	vv/outputs/<id>        ON or OFF(retained)
+//	vv/command             play, pause, stop, next or previous
+//	vv/volume/set          volume 0-100
+//	vv/outputs/<id>/set    ON or OFF
+//
+// Home Assistant MQTT discovery configs are published to <discovery prefix>/<component>/<client id>/<object id>/config.
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/mqtt"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+const (
+	defaultTopic         = "vv"
+	defaultClientID      = "vv"
+	defaultName          = "vv"
+	defaultRetryInterval = 5 * time.Second
+	maxRetryInterval     = 5 * time.Minute
+	defaultTimeout       = 10 * time.Second
+
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	payloadOn      = "ON"
+	payloadOff     = "OFF"
+)
+
+// Logger is a logging interface for Bridge.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// MPD represents mpd commands for MQTT commands.
+type MPD interface {
+	Play(context.Context, int) error
+	Pause(context.Context, bool) error
+	Stop(context.Context) error
+	Next(context.Context) error
+	Previous(context.Context) error
+	SetVol(context.Context, int) error
+	EnableOutput(context.Context, string) error
+	DisableOutput(context.Context, string) error
+}
+
+// Config is options for Bridge.
+type Config struct {
+	Network         string        // broker network(default: tcp)
+	Addr            string        // broker address
+	ClientID        string        // MQTT client id and Home Assistant node id(default: vv)
+	UserName        string        // broker user name
+	Password        string        // broker password
+	Topic           string        // topic prefix(default: vv)
+	DiscoveryPrefix string        // Home Assistant discovery prefix; disables discovery if empty
+	Name            string        // Home Assistant device name(default: vv)
+	AppVersion      string        // app version string for Home Assistant device info
+	KeepAlive       time.Duration // default: 60 seconds
+	RetryInterval   time.Duration // initial reconnect interval; doubles on each failure up to 5 minutes(default: 5 seconds)
+	Timeout         time.Duration // timeout for connecting and mpd commands(default: 10 seconds)
+	Logger          Logger
+}
+
+// Bridge publishes player state to MQTT broker and controls mpd by MQTT commands.
+// Bridge reconnects to broker until Shutdown is called.
+type Bridge struct {
+	conf    *Config
+	mpd     MPD
+	nodeID  string
+	status  *api.Status
+	song    map[string][]string
+	outputs map[string]*api.Output
+	update  chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+var nodeIDReplacer = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// New creates Bridge and starts background connection.
+func New(mpd MPD, c *Config) (*Bridge, error) {
+	conf := &Config{}
+	if c != nil {
+		*conf = *c
+	}
+	if len(conf.Addr) == 0 {
+		return nil, errors.New("addr is empty")
+	}
+	if len(conf.Network) == 0 {
+		conf.Network = "tcp"
+	}
+	if len(conf.ClientID) == 0 {
+		conf.ClientID = defaultClientID
+	}
+	if len(conf.Topic) == 0 {
+		conf.Topic = defaultTopic
+	}
+	if strings.ContainsAny(conf.Topic, "+#") || strings.ContainsAny(conf.DiscoveryPrefix, "+#") {
+		return nil, errors.New("topic must not contain wildcards")
+	}
+	conf.Topic = strings.TrimSuffix(conf.Topic, "/")
+	conf.DiscoveryPrefix = strings.TrimSuffix(conf.DiscoveryPrefix, "/")
+	if len(conf.Name) == 0 {
+		conf.Name = defaultName
+	}
+	if conf.RetryInterval == 0 {
+		conf.RetryInterval = defaultRetryInterval
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.Logger == nil {
+		conf.Logger = nopLogger{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bridge{
+		conf:   conf,
+		mpd:    mpd,
+		nodeID: nodeIDReplacer.ReplaceAllString(conf.ClientID, "_"),
+		update: make(chan struct{}, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go b.run(ctx)
+	return b, nil
+}
+
+// UpdateStatus sets player status to publish.
+func (b *Bridge) UpdateStatus(s *api.Status) {
+	b.mu.Lock()
+	b.status = s
+	b.mu.Unlock()
+	b.notify()
+}
+
+// UpdateCurrentSong sets current song to publish.
+func (b *Bridge) UpdateCurrentSong(s map[string][]string) {
+	b.mu.Lock()
+	b.song = s
+	b.mu.Unlock()
+	b.notify()
+}
+
+// UpdateOutputs sets outputs to publish.
+func (b *Bridge) UpdateOutputs(o map[string]*api.Output) {
+	b.mu.Lock()
+	b.outputs = o
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *Bridge) notify() {
+	select {
+	case b.update <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown publishes offline state and disconnects from broker.
+func (b *Bridge) Shutdown(ctx context.Context) error {
+	b.cancel()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bridge) run(ctx context.Context) {
+	defer close(b.done)
+	interval := b.conf.RetryInterval
+	for {
+		connected, err := b.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			interval = b.conf.RetryInterval
+		}
+		b.conf.Logger.Warnw("vv/mqtt: disconnected", "error", err, "retry_after", interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// connect connects to broker and serves until connection is closed.
+func (b *Bridge) connect(ctx context.Context) (bool, error) {
+	dctx, cancel := context.WithTimeout(ctx, b.conf.Timeout)
+	conn, err := mqtt.Dial(dctx, b.conf.Network, b.conf.Addr, &mqtt.Options{
+		ClientID:  b.conf.ClientID,
+		UserName:  b.conf.UserName,
+		Password:  b.conf.Password,
+		KeepAlive: b.conf.KeepAlive,
+		Will:      &mqtt.Message{Topic: b.topic("availability"), Payload: []byte(payloadOffline), Retain: true},
+	})
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	b.conf.Logger.Debugw("vv/mqtt: connected", "addr", b.conf.Addr)
+	if err := conn.Subscribe(b.topic("command"), b.topic("volume", "set"), b.topic("outputs", "+", "set")); err != nil {
+		conn.Close()
+		return true, err
+	}
+	published := map[string]string{}
+	if err := b.publish(conn, published); err != nil {
+		conn.Close()
+		return true, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			conn.Publish(&mqtt.Message{Topic: b.topic("availability"), Payload: []byte(payloadOffline), Retain: true})
+			conn.Close()
+			return true, ctx.Err()
+		case <-b.update:
+			if err := b.publish(conn, published); err != nil {
+				conn.Close()
+				return true, err
+			}
+		case m, ok := <-conn.Messages():
+			if !ok {
+				return true, conn.Err()
+			}
+			if err := b.command(ctx, m); err != nil {
+				b.conf.Logger.Errorw("vv/mqtt: failed to run command", "topic", m.Topic, "error", err)
+			}
+		}
+	}
+}
+
+func (b *Bridge) topic(s ...string) string {
+	return b.conf.Topic + "/" + strings.Join(s, "/")
+}
+
+// publish publishes retained messages which are changed from published.
+// topics which are removed from current state are cleared by empty payload.
+func (b *Bridge) publish(conn *mqtt.Conn, published map[string]string) error {
+	msgs, err := b.messages()
+	if err != nil {
+		return err
+	}
+	topics := make([]string, 0, len(msgs)+len(published))
+	for k := range msgs {
+		topics = append(topics, k)
+	}
+	for k := range published {
+		if _, ok := msgs[k]; !ok {
+			topics = append(topics, k)
+		}
+	}
+	// publish availability at last to make sure that state is ready
+	sort.Slice(topics, func(i, j int) bool {
+		if a := b.topic("availability"); topics[i] == a || topics[j] == a {
+			return topics[j] == a
+		}
+		return topics[i] < topics[j]
+	})
+	for _, k := range topics {
+		v, ok := msgs[k]
+		if old, pok := published[k]; pok == ok && old == v {
+			continue
+		}
+		if err := conn.Publish(&mqtt.Message{Topic: k, Payload: []byte(v), Retain: true}); err != nil {
+			return err
+		}
+		if ok {
+			published[k] = v
+		} else {
+			delete(published, k)
+		}
+	}
+	return nil
+}
+
+// messages returns retained messages for current state.
+func (b *Bridge) messages() (map[string]string, error) {
+	b.mu.Lock()
+	status, song, outputs := b.status, b.song, b.outputs
+	b.mu.Unlock()
+	ret := map[string]string{b.topic("availability"): payloadOnline}
+	if status != nil {
+		j, err := json.Marshal(status)
+		if err != nil {
+			return nil, err
+		}
+		ret[b.topic("status")] = string(j)
+		if status.State != nil {
+			ret[b.topic("state")] = *status.State
+		}
+		if status.Volume != nil && *status.Volume >= 0 {
+			ret[b.topic("volume")] = strconv.Itoa(*status.Volume)
+		}
+	}
+	if song != nil {
+		j, err := json.Marshal(song)
+		if err != nil {
+			return nil, err
+		}
+		ret[b.topic("song")] = string(j)
+	}
+	for id, o := range outputs {
+		v := payloadOff
+		if o.Enabled {
+			v = payloadOn
+		}
+		ret[b.topic("outputs", id)] = v
+	}
+	if len(b.conf.DiscoveryPrefix) != 0 {
+		if err := b.discovery(ret, outputs); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// haDevice is a Home Assistant MQTT discovery device info.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+// haConfig is a Home Assistant MQTT discovery config.
+type haConfig struct {
+	Name                string    `json:"name"`
+	UniqueID            string    `json:"unique_id"`
+	Icon                string    `json:"icon,omitempty"`
+	AvailabilityTopic   string    `json:"availability_topic"`
+	StateTopic          string    `json:"state_topic,omitempty"`
+	CommandTopic        string    `json:"command_topic,omitempty"`
+	ValueTemplate       string    `json:"value_template,omitempty"`
+	JSONAttributesTopic string    `json:"json_attributes_topic,omitempty"`
+	PayloadPress        string    `json:"payload_press,omitempty"`
+	Min                 *int      `json:"min,omitempty"`
+	Max                 *int      `json:"max,omitempty"`
+	Device              *haDevice `json:"device"`
+}
+
+// discovery adds Home Assistant discovery configs to msgs.
+func (b *Bridge) discovery(msgs map[string]string, outputs map[string]*api.Output) error {
+	device := &haDevice{
+		Identifiers:  []string{b.nodeID},
+		Name:         b.conf.Name,
+		Manufacturer: "vv",
+		Model:        "Music Player Daemon",
+		SWVersion:    b.conf.AppVersion,
+	}
+	volMin, volMax := 0, 100
+	configs := map[string]*haConfig{
+		"sensor/state": {Name: "State", Icon: "mdi:music", StateTopic: b.topic("state")},
+		"sensor/song": {Name: "Song", Icon: "mdi:music-note", StateTopic: b.topic("song"), JSONAttributesTopic: b.topic("song"),
+			ValueTemplate: "{{ (value_json.Artist | default([]) | join(', ')) ~ ' - ' ~ (value_json.Title | default(['']) | first) }}"},
+		"number/volume": {Name: "Volume", Icon: "mdi:volume-high", StateTopic: b.topic("volume"), CommandTopic: b.topic("volume", "set"), Min: &volMin, Max: &volMax},
+	}
+	for _, c := range []string{"play", "pause", "stop", "next", "previous"} {
+		configs["button/"+c] = &haConfig{Name: strings.ToUpper(c[:1]) + c[1:], CommandTopic: b.topic("command"), PayloadPress: c}
+	}
+	for id, o := range outputs {
+		configs["switch/output_"+nodeIDReplacer.ReplaceAllString(id, "_")] = &haConfig{
+			Name: fmt.Sprintf("Output %s", o.Name), Icon: "mdi:speaker",
+			StateTopic: b.topic("outputs", id), CommandTopic: b.topic("outputs", id, "set"),
+		}
+	}
+	for k, c := range configs {
+		component, object, _ := strings.Cut(k, "/")
+		c.UniqueID = b.nodeID + "_" + object
+		c.AvailabilityTopic = b.topic("availability")
+		c.Device = device
+		j, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		msgs[strings.Join([]string{b.conf.DiscoveryPrefix, component, b.nodeID, object, "config"}, "/")] = string(j)
+	}
+	return nil
+}
+
+// command runs mpd command for MQTT command message.
+func (b *Bridge) command(ctx context.Context, m *mqtt.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, b.conf.Timeout)
+	defer cancel()
+	payload := strings.TrimSpace(string(m.Payload))
+	switch m.Topic {
+	case b.topic("command"):
+		switch strings.ToLower(payload) {
+		case "play":
+			return b.mpd.Play(ctx, -1)
+		case "pause":
+			return b.mpd.Pause(ctx, true)
+		case "stop":
+			return b.mpd.Stop(ctx)
+		case "next":
+			return b.mpd.Next(ctx)
+		case "previous":
+			return b.mpd.Previous(ctx)
+		}
+		return fmt.Errorf("unknown command: %q", payload)
+	case b.topic("volume", "set"):
+		f, err := strconv.ParseFloat(payload, 64)
+		if err != nil {
+			return fmt.Errorf("invalid volume: %q", payload)
+		}
+		vol := int(f)
+		if vol < 0 {
+			vol = 0
+		} else if vol > 100 {
+			vol = 100
+		}
+		return b.mpd.SetVol(ctx, vol)
+	}
+	if prefix := b.topic("outputs") + "/"; strings.HasPrefix(m.Topic, prefix) && strings.HasSuffix(m.Topic, "/set") {
+		if id := strings.TrimSuffix(strings.TrimPrefix(m.Topic, prefix), "/set"); len(id) != 0 && !strings.Contains(id, "/") {
+			switch strings.ToUpper(payload) {
+			case payloadOn:
+				return b.mpd.EnableOutput(ctx, id)
+			case payloadOff:
+				return b.mpd.DisableOutput(ctx, id)
+			}
+			return fmt.Errorf("invalid output state: %q", payload)
+		}
+	}
+	return fmt.Errorf("unknown topic")
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugw(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Warnw(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Errorw(msg string, keysAndValues ...interface{}) {}
@@ -0,0 +1,148 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/mqtt"
+	"github.com/meiraka/vv/internal/mqtt/mqtttest"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+type testMPD chan string
+
+func (m testMPD) call(s string) error                   { m <- s; return nil }
+func (m testMPD) Play(_ context.Context, pos int) error { return m.call(fmt.Sprintf("play %d", pos)) }
+func (m testMPD) Pause(_ context.Context, b bool) error { return m.call(fmt.Sprintf("pause %v", b)) }
+func (m testMPD) Stop(context.Context) error            { return m.call("stop") }
+func (m testMPD) Next(context.Context) error            { return m.call("next") }
+func (m testMPD) Previous(context.Context) error        { return m.call("previous") }
+func (m testMPD) SetVol(_ context.Context, v int) error { return m.call(fmt.Sprintf("setvol %d", v)) }
+func (m testMPD) EnableOutput(_ context.Context, id string) error {
+	return m.call("enableoutput " + id)
+}
+func (m testMPD) DisableOutput(_ context.Context, id string) error {
+	return m.call("disableoutput " + id)
+}
+
+func intPtr(i int) *int          { return &i }
+func stringPtr(s string) *string { return &s }
+
+// waitRetained waits for retained message of topic to be want.
+func waitRetained(t *testing.T, s *mqtttest.Server, topic, want string) {
+	t.Helper()
+	var got string
+	for i := 0; i < 1000; i++ {
+		got = ""
+		if m := s.Retained(topic); m != nil {
+			got = string(m.Payload)
+		}
+		if got == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("got retained %s %q; want %q", topic, got, want)
+}
+
+func TestBridge(t *testing.T) {
+	s, err := mqtttest.NewServer()
+	if err != nil {
+		t.Fatalf("mqtttest.NewServer got error %v; want nil", err)
+	}
+	defer s.Close()
+	mpd := make(testMPD, 10)
+	b, err := New(mpd, &Config{
+		Addr:            s.Addr,
+		ClientID:        "vv.living",
+		DiscoveryPrefix: "homeassistant",
+		RetryInterval:   50 * time.Millisecond,
+		Logger:          log.NewTestLogger(t),
+	})
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	b.UpdateStatus(&api.Status{State: stringPtr("play"), Volume: intPtr(40)})
+	b.UpdateCurrentSong(map[string][]string{"file": {"foo.flac"}, "Title": {"foo"}})
+	b.UpdateOutputs(map[string]*api.Output{"0": {Name: "alsa", Enabled: true}, "1": {Name: "http", Enabled: false}})
+
+	waitRetained(t, s, "vv/availability", "online")
+	waitRetained(t, s, "vv/state", "play")
+	waitRetained(t, s, "vv/volume", "40")
+	waitRetained(t, s, "vv/song", `{"Title":["foo"],"file":["foo.flac"]}`)
+	waitRetained(t, s, "vv/outputs/0", "ON")
+	waitRetained(t, s, "vv/outputs/1", "OFF")
+	for _, topic := range []string{
+		"homeassistant/sensor/vv_living/state/config",
+		"homeassistant/number/vv_living/volume/config",
+		"homeassistant/button/vv_living/next/config",
+		"homeassistant/switch/vv_living/output_1/config",
+	} {
+		m := s.Retained(topic)
+		if m == nil {
+			t.Errorf("got no discovery config %s", topic)
+			continue
+		}
+		var c haConfig
+		if err := json.Unmarshal(m.Payload, &c); err != nil || c.AvailabilityTopic != "vv/availability" || c.Device == nil || c.Device.Identifiers[0] != "vv_living" {
+			t.Errorf("got %s %s, %v; want discovery config", topic, m.Payload, err)
+		}
+	}
+
+	// removed output
+	b.UpdateOutputs(map[string]*api.Output{"0": {Name: "alsa", Enabled: false}})
+	waitRetained(t, s, "vv/outputs/0", "OFF")
+	waitRetained(t, s, "vv/outputs/1", "")
+	waitRetained(t, s, "homeassistant/switch/vv_living/output_1/config", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cl, err := mqtt.Dial(ctx, "tcp", s.Addr, &mqtt.Options{ClientID: "test"})
+	if err != nil {
+		t.Fatalf("Dial got error %v; want nil", err)
+	}
+	defer cl.Close()
+	for _, tt := range []struct {
+		topic   string
+		payload string
+		want    string
+	}{
+		{"vv/command", "play", "play -1"},
+		{"vv/command", "pause", "pause true"},
+		{"vv/command", "unknown", ""},
+		{"vv/command", "next", "next"},
+		{"vv/volume/set", "120", "setvol 100"},
+		{"vv/volume/set", "33.0", "setvol 33"},
+		{"vv/outputs/1/set", "ON", "enableoutput 1"},
+		{"vv/outputs/0/set", "OFF", "disableoutput 0"},
+	} {
+		if err := cl.Publish(&mqtt.Message{Topic: tt.topic, Payload: []byte(tt.payload)}); err != nil {
+			t.Fatalf("Publish got error %v; want nil", err)
+		}
+		if len(tt.want) == 0 {
+			continue
+		}
+		select {
+		case got := <-mpd:
+			if got != tt.want {
+				t.Errorf("%s %s: got %q; want %q", tt.topic, tt.payload, got, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s %s: got no mpd command; want %q", tt.topic, tt.payload, tt.want)
+		}
+	}
+
+	// reconnects
+	s.Disconnect()
+	waitRetained(t, s, "vv/availability", "offline")
+	waitRetained(t, s, "vv/availability", "online")
+
+	if err := b.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown got error %v; want nil", err)
+	}
+	waitRetained(t, s, "vv/availability", "offline")
+}
@@ -0,0 +1,130 @@
+package scrobble
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultLastFMURL = "https://ws.audioscrobbler.com/2.0/"
+
+// lastFMInvalidParameters is a Last.fm error code for invalid request.
+const lastFMInvalidParameters = 6
+
+// lastFM submits listens by Last.fm compatible scrobbling api.
+//
+// https://www.last.fm/api/scrobbling
+type lastFM struct {
+	url        string
+	apiKey     string
+	secret     string
+	sessionKey string
+	client     *http.Client
+}
+
+func newLastFM(c *Config) *lastFM {
+	u := c.URL
+	if len(u) == 0 {
+		u = defaultLastFMURL
+	}
+	return &lastFM{url: u, apiKey: c.APIKey, secret: c.Secret, sessionKey: c.SessionKey, client: c.Client}
+}
+
+func (c *lastFM) batchSize() int { return 50 }
+
+func (c *lastFM) nowPlaying(ctx context.Context, l *listen) error {
+	v := url.Values{"method": {"track.updateNowPlaying"}}
+	c.addListen(v, l, "")
+	return c.post(ctx, v)
+}
+
+func (c *lastFM) submit(ctx context.Context, l []*listen) error {
+	v := url.Values{"method": {"track.scrobble"}}
+	for i := range l {
+		c.addListen(v, l[i], "["+strconv.Itoa(i)+"]")
+		v.Set("timestamp["+strconv.Itoa(i)+"]", strconv.FormatInt(l[i].Time.Unix(), 10))
+	}
+	return c.post(ctx, v)
+}
+
+func (c *lastFM) addListen(v url.Values, l *listen, suffix string) {
+	v.Set("artist"+suffix, l.Artist)
+	v.Set("track"+suffix, l.Title)
+	for k, s := range map[string]string{
+		"album":       l.Album,
+		"albumArtist": l.AlbumArtist,
+		"trackNumber": l.TrackNumber,
+		"mbid":        l.MBID,
+	} {
+		if len(s) != 0 {
+			v.Set(k+suffix, s)
+		}
+	}
+	if l.Duration > 0 {
+		v.Set("duration"+suffix, strconv.Itoa(int(l.Duration)))
+	}
+}
+
+// sign adds api_key, sk and api_sig to v.
+func (c *lastFM) sign(v url.Values) {
+	v.Set("api_key", c.apiKey)
+	v.Set("sk", c.sessionKey)
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(v.Get(k))
+	}
+	b.WriteString(c.secret)
+	sum := md5.Sum([]byte(b.String()))
+	v.Set("api_sig", hex.EncodeToString(sum[:]))
+}
+
+func (c *lastFM) post(ctx context.Context, v url.Values) error {
+	c.sign(v)
+	v.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &apiError{msg: fmt.Sprintf("lastfm: %s", resp.Status)}
+		}
+		return fmt.Errorf("lastfm: invalid response: %w", err)
+	}
+	if e.Error != 0 {
+		return &apiError{
+			msg: fmt.Sprintf("lastfm: error %d: %s", e.Error, e.Message),
+			// other errors(e.g. service offline, invalid session key) are retried
+			permanent: e.Error == lastFMInvalidParameters,
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &apiError{msg: fmt.Sprintf("lastfm: %s", resp.Status)}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package scrobble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultListenBrainzURL = "https://api.listenbrainz.org"
+
+// listenBrainz submits listens by ListenBrainz api.
+//
+// https://listenbrainz.readthedocs.io/en/latest/users/api/core.html
+type listenBrainz struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newListenBrainz(c *Config) *listenBrainz {
+	u := c.URL
+	if len(u) == 0 {
+		u = defaultListenBrainzURL
+	}
+	return &listenBrainz{url: strings.TrimSuffix(u, "/"), token: c.Token, client: c.Client}
+}
+
+type listenBrainzSubmission struct {
+	ListenType string                 `json:"listen_type"`
+	Payload    []*listenBrainzPayload `json:"payload"`
+}
+
+type listenBrainzPayload struct {
+	ListenedAt    int64                      `json:"listened_at,omitempty"`
+	TrackMetadata *listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                      `json:"artist_name"`
+	TrackName      string                      `json:"track_name"`
+	ReleaseName    string                      `json:"release_name,omitempty"`
+	AdditionalInfo *listenBrainzAdditionalInfo `json:"additional_info"`
+}
+
+type listenBrainzAdditionalInfo struct {
+	RecordingMBID    string `json:"recording_mbid,omitempty"`
+	TrackNumber      string `json:"tracknumber,omitempty"`
+	DurationMS       int64  `json:"duration_ms,omitempty"`
+	MediaPlayer      string `json:"media_player"`
+	SubmissionClient string `json:"submission_client"`
+}
+
+func (c *listenBrainz) payload(l *listen, listenedAt bool) *listenBrainzPayload {
+	p := &listenBrainzPayload{
+		TrackMetadata: &listenBrainzTrackMetadata{
+			ArtistName:  l.Artist,
+			TrackName:   l.Title,
+			ReleaseName: l.Album,
+			AdditionalInfo: &listenBrainzAdditionalInfo{
+				RecordingMBID:    l.MBID,
+				TrackNumber:      l.TrackNumber,
+				DurationMS:       int64(l.Duration * 1000),
+				MediaPlayer:      "MPD",
+				SubmissionClient: "vv",
+			},
+		},
+	}
+	if listenedAt {
+		p.ListenedAt = l.Time.Unix()
+	}
+	return p
+}
+
+func (c *listenBrainz) batchSize() int { return 100 }
+
+func (c *listenBrainz) nowPlaying(ctx context.Context, l *listen) error {
+	return c.post(ctx, &listenBrainzSubmission{ListenType: "playing_now", Payload: []*listenBrainzPayload{c.payload(l, false)}})
+}
+
+func (c *listenBrainz) submit(ctx context.Context, l []*listen) error {
+	s := &listenBrainzSubmission{ListenType: "single"}
+	if len(l) > 1 {
+		s.ListenType = "import"
+	}
+	for i := range l {
+		s.Payload = append(s.Payload, c.payload(l[i], true))
+	}
+	return c.post(ctx, s)
+}
+
+func (c *listenBrainz) post(ctx context.Context, s *listenBrainzSubmission) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/1/submit-listens", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var e struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || len(e.Error) == 0 {
+		e.Error = strings.TrimSpace(string(body))
+	}
+	return &apiError{
+		msg: fmt.Sprintf("listenbrainz: %s: %s", resp.Status, e.Error),
+		// invalid listens are rejected with 400; auth errors are retried to keep queue until config is fixed
+		permanent: resp.StatusCode == http.StatusBadRequest,
+	}
+}
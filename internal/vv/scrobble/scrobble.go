@@ -0,0 +1,331 @@
+// Package scrobble submits played songs to ListenBrainz or Last.fm compatible apis.
+package scrobble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+// APIs
+const (
+	APIListenBrainz = "listenbrainz"
+	APILastFM       = "lastfm"
+)
+
+const (
+	defaultRetryInterval = time.Minute
+	maxRetryInterval     = 30 * time.Minute
+	defaultTimeout       = 10 * time.Second
+)
+
+// Logger is a logging interface for Scrobbler.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// Config is options for Scrobbler.
+type Config struct {
+	Name          string        // user name for logging
+	API           string        // APIListenBrainz or APILastFM
+	URL           string        // api base url(default: official api url)
+	Token         string        // ListenBrainz user token
+	APIKey        string        // Last.fm api key
+	Secret        string        // Last.fm shared secret
+	SessionKey    string        // Last.fm session key
+	QueueFile     string        // file path to persist retry queue; queue is not persisted if empty
+	RetryInterval time.Duration // initial retry interval; doubles on each failure up to 30 minutes(default: 1 minute)
+	Client        *http.Client  // default: http.Client with 10 seconds timeout
+	Logger        Logger
+}
+
+// client submits listens to scrobbling api.
+type client interface {
+	nowPlaying(context.Context, *listen) error
+	submit(context.Context, []*listen) error
+	batchSize() int
+}
+
+// apiError represents scrobbling api error.
+type apiError struct {
+	msg       string
+	permanent bool // request is invalid and should not be retried
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+// listen is a played song to submit.
+type listen struct {
+	Time        time.Time `json:"time"`
+	Artist      string    `json:"artist"`
+	Title       string    `json:"title"`
+	Album       string    `json:"album,omitempty"`
+	AlbumArtist string    `json:"album_artist,omitempty"`
+	TrackNumber string    `json:"track_number,omitempty"`
+	Duration    float64   `json:"duration,omitempty"` // seconds
+	MBID        string    `json:"mbid,omitempty"`     // MusicBrainz recording id
+}
+
+// newListen creates listen from play; returns nil if song has no artist or title.
+func newListen(p *api.Play) *listen {
+	l := &listen{
+		Time:        p.Time,
+		Artist:      strings.Join(p.Song["Artist"], ", "),
+		Title:       tag(p.Song, "Title"),
+		Album:       tag(p.Song, "Album"),
+		AlbumArtist: strings.Join(p.Song["AlbumArtist"], ", "),
+		TrackNumber: tag(p.Song, "Track"),
+		MBID:        tag(p.Song, "MUSICBRAINZ_TRACKID"),
+	}
+	if len(l.Artist) == 0 || len(l.Title) == 0 {
+		return nil
+	}
+	if d, err := strconv.ParseFloat(tag(p.Song, "duration"), 64); err == nil {
+		l.Duration = d
+	} else if d, err := strconv.ParseFloat(tag(p.Song, "Time"), 64); err == nil {
+		l.Duration = d
+	}
+	return l
+}
+
+func tag(song map[string][]string, key string) string {
+	if v, ok := song[key]; ok && len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Scrobbler submits now playing and played songs.
+// Played songs are queued and retried until api accepts them.
+type Scrobbler struct {
+	conf       *Config
+	client     client
+	queue      []*listen
+	nowPlaying chan *listen
+	wake       chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+	mu         sync.Mutex
+}
+
+// New creates Scrobbler and starts background submission.
+func New(c *Config) (*Scrobbler, error) {
+	conf := &Config{}
+	if c != nil {
+		*conf = *c
+	}
+	if conf.RetryInterval == 0 {
+		conf.RetryInterval = defaultRetryInterval
+	}
+	if conf.Client == nil {
+		conf.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	if conf.Logger == nil {
+		conf.Logger = nopLogger{}
+	}
+	s := &Scrobbler{
+		conf:       conf,
+		nowPlaying: make(chan *listen, 1),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	switch conf.API {
+	case APIListenBrainz:
+		if len(conf.Token) == 0 {
+			return nil, fmt.Errorf("%s: token is empty", conf.Name)
+		}
+		s.client = newListenBrainz(conf)
+	case APILastFM:
+		if len(conf.APIKey) == 0 || len(conf.Secret) == 0 || len(conf.SessionKey) == 0 {
+			return nil, fmt.Errorf("%s: api_key, secret and session_key are required", conf.Name)
+		}
+		s.client = newLastFM(conf)
+	default:
+		return nil, fmt.Errorf("%s: unknown api: %q", conf.Name, conf.API)
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("%s: load queue: %w", conf.Name, err)
+	}
+	if len(s.queue) != 0 {
+		s.wake <- struct{}{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.run(ctx)
+	return s, nil
+}
+
+// NowPlaying sends now playing song; failed request is not retried.
+func (s *Scrobbler) NowPlaying(p *api.Play) {
+	l := newListen(p)
+	if l == nil {
+		return
+	}
+	// drop old now playing song which is not sent yet
+	select {
+	case <-s.nowPlaying:
+	default:
+	}
+	select {
+	case s.nowPlaying <- l:
+	default:
+	}
+}
+
+// Scrobble queues played song to submit.
+func (s *Scrobbler) Scrobble(p *api.Play) {
+	l := newListen(p)
+	if l == nil {
+		s.conf.Logger.Debugw("vv/scrobble: skip song without artist or title", "scrobbler", s.conf.Name, "file", tag(p.Song, "file"))
+		return
+	}
+	s.mu.Lock()
+	s.queue = append(s.queue, l)
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		s.conf.Logger.Errorw("vv/scrobble: failed to save queue", "scrobbler", s.conf.Name, "error", err)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown stops background submission; queued songs are submitted at next start.
+func (s *Scrobbler) Shutdown(ctx context.Context) error {
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scrobbler) run(ctx context.Context) {
+	defer close(s.done)
+	interval := s.conf.RetryInterval
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case l := <-s.nowPlaying:
+			if err := s.client.nowPlaying(ctx, l); err != nil && ctx.Err() == nil {
+				s.conf.Logger.Warnw("vv/scrobble: failed to update now playing", "scrobbler", s.conf.Name, "error", err)
+			}
+			continue
+		case <-s.wake:
+			if retry != nil {
+				// wait for retry interval
+				continue
+			}
+		case <-retry:
+		}
+		if err := s.flush(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.conf.Logger.Warnw("vv/scrobble: failed to submit", "scrobbler", s.conf.Name, "error", err, "retry_after", interval)
+			retry = time.After(interval)
+			if interval *= 2; interval > maxRetryInterval {
+				interval = maxRetryInterval
+			}
+			continue
+		}
+		retry = nil
+		interval = s.conf.RetryInterval
+	}
+}
+
+// flush submits all queued songs.
+func (s *Scrobbler) flush(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		n := len(s.queue)
+		if size := s.client.batchSize(); n > size {
+			n = size
+		}
+		batch := append([]*listen{}, s.queue[:n]...)
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		err := s.client.submit(ctx, batch)
+		var aerr *apiError
+		if errors.As(err, &aerr) && aerr.permanent {
+			s.conf.Logger.Errorw("vv/scrobble: drop songs", "scrobbler", s.conf.Name, "songs", len(batch), "error", err)
+		} else if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.queue = s.queue[len(batch):]
+		err = s.save()
+		s.mu.Unlock()
+		if err != nil {
+			s.conf.Logger.Errorw("vv/scrobble: failed to save queue", "scrobbler", s.conf.Name, "error", err)
+		}
+	}
+}
+
+func (s *Scrobbler) load() error {
+	if len(s.conf.QueueFile) == 0 {
+		return nil
+	}
+	b, err := os.ReadFile(s.conf.QueueFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &s.queue)
+}
+
+// save writes queue to QueueFile; caller must hold s.mu.
+func (s *Scrobbler) save() error {
+	if len(s.conf.QueueFile) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(s.queue)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.conf.QueueFile)
+	if err := os.MkdirAll(dir, 0766); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(s.conf.QueueFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.conf.QueueFile)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugw(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Warnw(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Errorw(msg string, keysAndValues ...interface{}) {}
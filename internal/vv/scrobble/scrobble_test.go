@@ -0,0 +1,190 @@
+package scrobble
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+var testPlay = &api.Play{
+	Time: time.Unix(1600000000, 0),
+	Song: map[string][]string{
+		"file":     {"foo.flac"},
+		"Artist":   {"foo"},
+		"Title":    {"bar"},
+		"Album":    {"baz"},
+		"duration": {"200.5"},
+	},
+}
+
+func shutdown(t *testing.T, s *Scrobbler) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown got error %v; want nil", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for label, c := range map[string]*Config{
+		"unknown api":          {API: "foo"},
+		"listenbrainz/token":   {API: APIListenBrainz},
+		"lastfm/session key":   {API: APILastFM, APIKey: "key", Secret: "secret"},
+		"invalid queue format": {API: APIListenBrainz, Token: "token", QueueFile: "scrobble_test.go"},
+	} {
+		t.Run(label, func(t *testing.T) {
+			if _, err := New(c); err == nil {
+				t.Errorf("New got nil error; want error")
+			}
+		})
+	}
+}
+
+func TestScrobblerListenBrainz(t *testing.T) {
+	reqs := make(chan *listenBrainzSubmission, 10)
+	status := make(chan int, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/submit-listens" || r.Header.Get("Authorization") != "Token token" {
+			t.Errorf("got %s %s; want /1/submit-listens with token", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var s listenBrainzSubmission
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		reqs <- &s
+		w.WriteHeader(<-status)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ts.Close()
+	queue := filepath.Join(t.TempDir(), "queue.json")
+	conf := &Config{Name: "alice", API: APIListenBrainz, URL: ts.URL, Token: "token", QueueFile: queue, RetryInterval: 10 * time.Millisecond, Logger: log.NewTestLogger(t)}
+	s, err := New(conf)
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	defer shutdown(t, s)
+
+	status <- http.StatusOK
+	s.NowPlaying(testPlay)
+	if got := <-reqs; got.ListenType != "playing_now" || got.Payload[0].ListenedAt != 0 || got.Payload[0].TrackMetadata.TrackName != "bar" {
+		t.Errorf("got now playing %+v; want playing_now bar", got)
+	}
+
+	// retry while server is unavailable
+	status <- http.StatusServiceUnavailable
+	status <- http.StatusOK
+	s.Scrobble(testPlay)
+	if got := <-reqs; got.ListenType != "single" {
+		t.Errorf("got %s; want single", got.ListenType)
+	}
+	got := <-reqs
+	if got.ListenType != "single" || got.Payload[0].ListenedAt != 1600000000 || got.Payload[0].TrackMetadata.AdditionalInfo.DurationMS != 200500 {
+		t.Errorf("got retried listen %+v; want single listen at 1600000000", got)
+	}
+	// song without title is ignored
+	s.Scrobble(&api.Play{Song: map[string][]string{"file": {"foo.flac"}, "Artist": {"foo"}}})
+	select {
+	case got := <-reqs:
+		t.Errorf("got request %+v for song without title; want no request", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestScrobblerQueue(t *testing.T) {
+	queue := filepath.Join(t.TempDir(), "queue.json")
+	// server is down
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	conf := &Config{Name: "alice", API: APIListenBrainz, URL: ts.URL, Token: "token", QueueFile: queue, RetryInterval: time.Hour, Logger: log.NewTestLogger(t)}
+	s, err := New(conf)
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	s.Scrobble(testPlay)
+	s.Scrobble(testPlay)
+	shutdown(t, s)
+	ts.Close()
+	b, err := os.ReadFile(queue)
+	if err != nil {
+		t.Fatalf("failed to read queue: %v", err)
+	}
+	var l []*listen
+	if err := json.Unmarshal(b, &l); err != nil || len(l) != 2 {
+		t.Fatalf("got queue %s, %v; want 2 listens", b, err)
+	}
+
+	// queued songs are submitted at next start
+	reqs := make(chan *listenBrainzSubmission, 10)
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var s listenBrainzSubmission
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		reqs <- &s
+	}))
+	defer ts.Close()
+	conf.URL = ts.URL
+	s, err = New(conf)
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	defer shutdown(t, s)
+	if got := <-reqs; got.ListenType != "import" || len(got.Payload) != 2 {
+		t.Errorf("got %+v; want import 2 listens", got)
+	}
+}
+
+func TestScrobblerLastFM(t *testing.T) {
+	reqs := make(chan url.Values, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		reqs <- r.PostForm
+		if r.PostForm.Get("method") == "track.scrobble" && r.PostForm.Get("artist[0]") == "invalid" {
+			w.Write([]byte(`{"error":6,"message":"Invalid parameters"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	s, err := New(&Config{Name: "bob", API: APILastFM, URL: ts.URL, APIKey: "key", Secret: "secret", SessionKey: "sk", RetryInterval: 10 * time.Millisecond, Logger: log.NewTestLogger(t)})
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	defer shutdown(t, s)
+
+	s.NowPlaying(testPlay)
+	got := <-reqs
+	if got.Get("method") != "track.updateNowPlaying" || got.Get("artist") != "foo" || got.Get("track") != "bar" || got.Get("duration") != "200" || got.Get("sk") != "sk" {
+		t.Errorf("got now playing %v; want track.updateNowPlaying foo - bar", got)
+	}
+	// api_sig is md5 of sorted params without format + secret
+	sum := md5.Sum([]byte("albumbazapi_keykeyartistfooduration200methodtrack.updateNowPlayingsksktrackbarsecret"))
+	if sig, want := got.Get("api_sig"), hex.EncodeToString(sum[:]); sig != want {
+		t.Errorf("got api_sig %s; want %s", sig, want)
+	}
+
+	// invalid song is dropped
+	s.Scrobble(&api.Play{Time: testPlay.Time, Song: map[string][]string{"Artist": {"invalid"}, "Title": {"bar"}}})
+	if got := <-reqs; got.Get("method") != "track.scrobble" || got.Get("artist[0]") != "invalid" {
+		t.Errorf("got %v; want track.scrobble invalid", got)
+	}
+	s.Scrobble(testPlay)
+	if got := <-reqs; got.Get("method") != "track.scrobble" || got.Get("artist[0]") != "foo" || got.Get("timestamp[0]") != "1600000000" {
+		t.Errorf("got %v; want track.scrobble foo at 1600000000", got)
+	}
+}
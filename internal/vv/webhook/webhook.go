@@ -0,0 +1,227 @@
+// Package webhook posts player and library events to http endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+// Request headers
+const (
+	HeaderEvent     = "X-VV-Event"
+	HeaderSignature = "X-VV-Signature" // "sha256=" + hex encoded HMAC-SHA256 of request body
+)
+
+const (
+	defaultRetryInterval = 10 * time.Second
+	defaultMaxRetries    = 5
+	maxRetryInterval     = 10 * time.Minute
+	defaultTimeout       = 10 * time.Second
+	queueSize            = 64
+)
+
+// Logger is a logging interface for Webhook.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// Config is options for Webhook.
+type Config struct {
+	Name          string        // webhook name for logging
+	URL           string        // endpoint url to post events
+	Secret        string        // key to sign request body; request is not signed if empty
+	Events        []string      // event names to post; posts all events if empty
+	MaxRetries    int           // max retry count for each event(default: 5)
+	RetryInterval time.Duration // initial retry interval; doubles on each failure up to 10 minutes(default: 10 seconds)
+	Client        *http.Client  // default: http.Client with 10 seconds timeout
+	Logger        Logger
+}
+
+// permanentError represents error which should not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Webhook posts events as json in order of events.
+// Failed requests are retried with exponential backoff.
+type Webhook struct {
+	conf   *Config
+	events map[string]struct{}
+	queue  chan *api.Event
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates Webhook and starts background delivery.
+func New(c *Config) (*Webhook, error) {
+	conf := &Config{}
+	if c != nil {
+		*conf = *c
+	}
+	if conf.MaxRetries == 0 {
+		conf.MaxRetries = defaultMaxRetries
+	}
+	if conf.RetryInterval == 0 {
+		conf.RetryInterval = defaultRetryInterval
+	}
+	if conf.Client == nil {
+		conf.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	if conf.Logger == nil {
+		conf.Logger = nopLogger{}
+	}
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: url: %w", conf.Name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%s: url: unsupported scheme: %q", conf.Name, u.Scheme)
+	}
+	known := make(map[string]struct{}, len(api.Events))
+	for _, e := range api.Events {
+		known[e] = struct{}{}
+	}
+	events := make(map[string]struct{}, len(conf.Events))
+	for _, e := range conf.Events {
+		if _, ok := known[e]; !ok {
+			return nil, fmt.Errorf("%s: unknown event: %q", conf.Name, e)
+		}
+		events[e] = struct{}{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Webhook{
+		conf:   conf,
+		events: events,
+		queue:  make(chan *api.Event, queueSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w, nil
+}
+
+// Notify queues event to post; event is dropped if queue is full.
+func (w *Webhook) Notify(e *api.Event) {
+	if _, ok := w.events[e.Name]; len(w.events) != 0 && !ok {
+		return
+	}
+	select {
+	case w.queue <- e:
+	default:
+		w.conf.Logger.Errorw("vv/webhook: queue is full; drop event", "webhook", w.conf.Name, "event", e.Name)
+	}
+}
+
+// Shutdown stops background delivery; queued events are dropped.
+func (w *Webhook) Shutdown(ctx context.Context) error {
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Webhook) run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-w.queue:
+			w.deliver(ctx, e)
+		}
+	}
+}
+
+// deliver posts event until endpoint accepts it or retry count exceeds MaxRetries.
+func (w *Webhook) deliver(ctx context.Context, e *api.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		w.conf.Logger.Errorw("vv/webhook: drop event", "webhook", w.conf.Name, "event", e.Name, "error", err)
+		return
+	}
+	interval := w.conf.RetryInterval
+	for i := 0; ; i++ {
+		err := w.post(ctx, e.Name, body)
+		if err == nil {
+			w.conf.Logger.Debugw("vv/webhook: posted event", "webhook", w.conf.Name, "event", e.Name)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		var perr *permanentError
+		if errors.As(err, &perr) || i >= w.conf.MaxRetries {
+			w.conf.Logger.Errorw("vv/webhook: drop event", "webhook", w.conf.Name, "event", e.Name, "error", err)
+			return
+		}
+		w.conf.Logger.Warnw("vv/webhook: failed to post event", "webhook", w.conf.Name, "event", e.Name, "error", err, "retry_after", interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vv")
+	req.Header.Set(HeaderEvent, event)
+	if len(w.conf.Secret) != 0 {
+		req.Header.Set(HeaderSignature, Sign(w.conf.Secret, body))
+	}
+	resp, err := w.conf.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("%s", resp.Status)
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// Sign returns signature header value for body.
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugw(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Warnw(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Errorw(msg string, keysAndValues ...interface{}) {}
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/vv/api"
+)
+
+type request struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+func shutdown(t *testing.T, w *Webhook) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown got error %v; want nil", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for label, c := range map[string]*Config{
+		"empty url":     {},
+		"invalid url":   {URL: "ftp://example.com"},
+		"unknown event": {URL: "http://example.com", Events: []string{"foo"}},
+	} {
+		t.Run(label, func(t *testing.T) {
+			if _, err := New(c); err == nil {
+				t.Errorf("New got nil error; want error")
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	reqs := make(chan *request, 10)
+	status := make(chan int, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		reqs <- &request{event: r.Header.Get(HeaderEvent), signature: r.Header.Get(HeaderSignature), body: b}
+		w.WriteHeader(<-status)
+	}))
+	defer ts.Close()
+	w, err := New(&Config{
+		Name:          "test",
+		URL:           ts.URL,
+		Secret:        "secret",
+		Events:        []string{api.EventSongChanged, api.EventStateChanged},
+		MaxRetries:    1,
+		RetryInterval: 10 * time.Millisecond,
+		Logger:        log.NewTestLogger(t),
+	})
+	if err != nil {
+		t.Fatalf("New got error %v; want nil", err)
+	}
+	defer shutdown(t, w)
+
+	recv := func() *request {
+		t.Helper()
+		select {
+		case r := <-reqs:
+			return r
+		case <-time.After(time.Second):
+			t.Fatalf("got no request; want request")
+		}
+		return nil
+	}
+
+	w.Notify(&api.Event{Name: api.EventLibraryUpdated})
+	status <- http.StatusServiceUnavailable
+	status <- http.StatusOK
+	w.Notify(&api.Event{Name: api.EventSongChanged, Data: &api.EventSong{Song: map[string][]string{"file": {"foo.flac"}}}})
+	for i := 0; i < 2; i++ {
+		r := recv()
+		if r.event != api.EventSongChanged {
+			t.Errorf("got event %q; want %q", r.event, api.EventSongChanged)
+		}
+		if want := Sign("secret", r.body); r.signature != want {
+			t.Errorf("got signature %q; want %q", r.signature, want)
+		}
+		var got struct {
+			Event string        `json:"event"`
+			Data  api.EventSong `json:"data"`
+		}
+		if err := json.Unmarshal(r.body, &got); err != nil || got.Event != api.EventSongChanged || got.Data.Song["file"][0] != "foo.flac" {
+			t.Errorf("got %s, %v; want song changed event", r.body, err)
+		}
+	}
+
+	// client error is not retried
+	status <- http.StatusBadRequest
+	status <- http.StatusOK
+	w.Notify(&api.Event{Name: api.EventStateChanged})
+	w.Notify(&api.Event{Name: api.EventSongChanged})
+	if r := recv(); r.event != api.EventStateChanged {
+		t.Errorf("got event %q; want %q", r.event, api.EventStateChanged)
+	}
+	if r := recv(); r.event != api.EventSongChanged {
+		t.Errorf("got event %q; want %q", r.event, api.EventSongChanged)
+	}
+
+	// gives up after MaxRetries
+	status <- http.StatusInternalServerError
+	status <- http.StatusInternalServerError
+	status <- http.StatusOK
+	w.Notify(&api.Event{Name: api.EventStateChanged})
+	w.Notify(&api.Event{Name: api.EventSongChanged})
+	for _, want := range []string{api.EventStateChanged, api.EventStateChanged, api.EventSongChanged} {
+		if r := recv(); r.event != want {
+			t.Errorf("got event %q; want %q", r.event, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package zstd
+
+import (
+	"github.com/klauspost/compress/zstd"
+)
+
+var encoder, _ = zstd.NewWriter(nil)
+
+// Encode encodes bytes to zstd compressed data.
+func Encode(data []byte) ([]byte, error) {
+	return encoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+}
@@ -11,11 +11,17 @@ import (
 	"time"
 
 	"github.com/meiraka/vv/internal/log"
+	"github.com/meiraka/vv/internal/metrics"
 	"github.com/meiraka/vv/internal/mpd"
 	"github.com/meiraka/vv/internal/vv"
 	"github.com/meiraka/vv/internal/vv/api"
 	"github.com/meiraka/vv/internal/vv/api/images"
 	"github.com/meiraka/vv/internal/vv/assets"
+	"github.com/meiraka/vv/internal/vv/auth"
+	"github.com/meiraka/vv/internal/vv/mpris"
+	"github.com/meiraka/vv/internal/vv/mqttbridge"
+	"github.com/meiraka/vv/internal/vv/scrobble"
+	"github.com/meiraka/vv/internal/vv/webhook"
 )
 
 const (
@@ -48,15 +54,29 @@ func v2() {
 	if lastModified.Before(configDate) {
 		lastModified = configDate
 	}
+	logLevel := config.Log.Level
 	if config.debug {
-		logger = log.NewDebugLogger(os.Stderr)
+		logLevel = log.LevelDebug
 	}
+	logger = log.NewLogger(os.Stderr, logLevel, config.Log.Format)
+	mpdLogger := logger.With("subsystem", "mpd")
+	registry := metrics.NewRegistry()
+	mpdDuration := registry.Histogram("vv_mpd_command_duration_seconds", "mpd command latency in seconds.", nil, "command")
+	mpdErrors := registry.Counter("vv_mpd_command_errors_total", "Number of failed mpd commands.", "command")
 	client, err := mpd.Dial(config.MPD.Network, config.MPD.Addr, &mpd.ClientOptions{
 		BinaryLimit:          int(config.MPD.BinaryLimit),
 		Timeout:              10 * time.Second,
 		HealthCheckInterval:  time.Second,
 		ReconnectionInterval: 5 * time.Second,
 		CacheCommandsResult:  config.Server.Cover.Remote,
+		NonBlocking:          true,
+		CommandHook: func(cmd string, d time.Duration, err error) {
+			mpdDuration.Observe(d.Seconds(), cmd)
+			if err != nil {
+				mpdErrors.Inc(cmd)
+				mpdLogger.Debugw("mpd: command failed", "command", cmd, "duration", d, "error", err)
+			}
+		},
 	})
 	if err != nil {
 		logger.Fatalf("failed to dial mpd: %v", err)
@@ -64,18 +84,22 @@ func v2() {
 	watcher, err := mpd.NewWatcher(config.MPD.Network, config.MPD.Addr, &mpd.WatcherOptions{
 		Timeout:              10 * time.Second,
 		ReconnectionInterval: 5 * time.Second,
+		NonBlocking:          true,
 	})
 	if err != nil {
 		logger.Fatalf("failed to dial mpd: %v", err)
 	}
 	// get music dir from local mpd connection
 	if config.MPD.Network == "unix" && config.MPD.MusicDirectory == "" {
-		if c, err := client.Config(ctx); err == nil {
+		// do not wait mpd connection
+		cctx, cancel := context.WithTimeout(ctx, time.Second)
+		if c, err := client.Config(cctx); err == nil {
 			if dir, ok := c["music_directory"]; ok && filepath.IsAbs(dir) {
 				config.MPD.MusicDirectory = dir
 				logger.Printf("apply mpd.music_directory from mpd connection: %s", dir)
 			}
 		}
+		cancel()
 	}
 
 	// get music dir from local mpd config
@@ -102,6 +126,34 @@ func v2() {
 		}
 	}
 	m := http.NewServeMux()
+	protect := func(h http.Handler) http.Handler { return h }
+	var rpcMiddleware func(http.Handler) http.Handler
+	var allowAlarmOutputs func(*http.Request) bool
+	var requestUser func(context.Context) (string, bool)
+	if config.authEnabled() {
+		a, err := auth.New(toAuthConfig(config))
+		if err != nil {
+			logger.Fatalf("failed to initialize auth: %v", err)
+		}
+		m.Handle(auth.PathLogin, a)
+		m.Handle(auth.PathLogout, a)
+		protect = a.Protect
+		rpcMiddleware = a.Protect
+		requestUser = auth.UserName
+		// alarm outputs requires admin role as outputs api
+		allowAlarmOutputs = func(r *http.Request) bool {
+			role, ok := auth.Role(r.Context())
+			return !ok || role == auth.RoleAdmin
+		}
+	}
+	var thumbs *images.Thumbnails
+	if size := config.Server.Cover.Thumbnails.MaxSize; size != 0 {
+		t, err := images.NewThumbnails(filepath.Join(config.Server.CacheDirectory, "thumbnails"), int64(size), config.Server.Cover.Thumbnails.Sizes)
+		if err != nil {
+			logger.Fatalf("failed to initialize coverart thumbnails: %v", err)
+		}
+		thumbs = t
+	}
 	covers := make([]api.ImageProvider, 0, 2)
 	if config.Server.Cover.Local {
 		if len(config.MPD.MusicDirectory) == 0 {
@@ -111,7 +163,8 @@ func v2() {
 			if err != nil {
 				logger.Fatalf("failed to initialize coverart: %v", err)
 			}
-			m.Handle("/api/music/images/local/", c)
+			c.SetThumbnails(thumbs)
+			m.Handle("/api/music/images/local/", protect(c))
 			covers = append(covers, c)
 
 		}
@@ -121,14 +174,16 @@ func v2() {
 		if err != nil {
 			logger.Fatalf("failed to initialize coverart: %v", err)
 		}
-		m.Handle("/api/music/images/albumart/", a)
+		a.SetThumbnails(thumbs)
+		m.Handle("/api/music/images/albumart/", protect(a))
 		covers = append(covers, a)
 		defer a.Close()
 		e, err := images.NewEmbed("/api/music/images/embed/", client, filepath.Join(config.Server.CacheDirectory, "embed"))
 		if err != nil {
 			logger.Fatalf("failed to initialize coverart: %v", err)
 		}
-		m.Handle("/api/music/images/embed/", e)
+		e.SetThumbnails(thumbs)
+		m.Handle("/api/music/images/embed/", protect(e))
 		covers = append(covers, e)
 		defer e.Close()
 	}
@@ -137,7 +192,7 @@ func v2() {
 		TreeOrder:    config.Playlist.TreeOrder,
 		Local:        config.debug,
 		LastModified: lastModified,
-		Logger:       logger,
+		Logger:       logger.With("subsystem", "vv"),
 	})
 	if err != nil {
 		logger.Fatalf("failed to initialize root handler: %v", err)
@@ -145,29 +200,117 @@ func v2() {
 	assets, err := assets.NewHandler(&assets.Config{
 		Local:        config.debug,
 		LastModified: lastModified,
-		Logger:       logger,
+		Logger:       logger.With("subsystem", "assets"),
 	})
 	if err != nil {
 		logger.Fatalf("failed to initialize assets handler: %v", err)
 	}
-	api, err := api.NewHandler(ctx, client, watcher, &api.Config{
-		AppVersion:     version,
-		AudioProxy:     proxy,
-		ImageProviders: covers,
-		Logger:         logger,
+	scrobbleConfigs, err := toScrobbleConfigs(config, logger.With("subsystem", "scrobble"))
+	if err != nil {
+		logger.Fatalf("failed to initialize scrobbler: %v", err)
+	}
+	scrobblers := make([]*scrobble.Scrobbler, 0, len(scrobbleConfigs))
+	apiScrobblers := make([]api.Scrobbler, 0, len(scrobbleConfigs))
+	for _, c := range scrobbleConfigs {
+		s, err := scrobble.New(c)
+		if err != nil {
+			logger.Fatalf("failed to initialize scrobbler: %v", err)
+		}
+		scrobblers = append(scrobblers, s)
+		apiScrobblers = append(apiScrobblers, s)
+	}
+	webhookConfigs, err := toWebhookConfigs(config, logger.With("subsystem", "webhook"))
+	if err != nil {
+		logger.Fatalf("failed to initialize webhook: %v", err)
+	}
+	webhooks := make([]*webhook.Webhook, 0, len(webhookConfigs))
+	eventHooks := make([]api.EventHook, 0, len(webhookConfigs))
+	for _, c := range webhookConfigs {
+		w, err := webhook.New(c)
+		if err != nil {
+			logger.Fatalf("failed to initialize webhook: %v", err)
+		}
+		webhooks = append(webhooks, w)
+		eventHooks = append(eventHooks, w)
+	}
+	var bridge *mqttbridge.Bridge
+	var stateHooks []api.StateHook
+	if len(config.MQTT.Addr) != 0 {
+		bridge, err = mqttbridge.New(client, &mqttbridge.Config{
+			Addr:            config.MQTT.Addr,
+			ClientID:        config.MQTT.ClientID,
+			UserName:        config.MQTT.UserName,
+			Password:        config.MQTT.Password,
+			Topic:           config.MQTT.Topic,
+			DiscoveryPrefix: config.MQTT.DiscoveryPrefix,
+			Name:            config.MQTT.Name,
+			AppVersion:      version,
+			Logger:          logger.With("subsystem", "mqtt"),
+		})
+		if err != nil {
+			logger.Fatalf("failed to initialize mqtt bridge: %v", err)
+		}
+		stateHooks = append(stateHooks, bridge)
+	}
+	var player *mpris.Bridge
+	if config.MPRIS.Enabled {
+		artURLBase := config.localURL()
+		if config.authEnabled() {
+			// media players can not fetch cover images protected by authentication
+			artURLBase = ""
+		}
+		player, err = mpris.New(client, &mpris.Config{
+			Name:       config.MPRIS.Name,
+			ArtURLBase: artURLBase,
+			Logger:     logger.With("subsystem", "mpris"),
+		})
+		if err != nil {
+			logger.Fatalf("failed to initialize mpris: %v", err)
+		}
+		stateHooks = append(stateHooks, player)
+	}
+	apiHandler, err := api.NewHandler(ctx, client, watcher, &api.Config{
+		AppVersion:        version,
+		AudioProxy:        proxy,
+		RecordDirectory:   config.Server.RecordDirectory,
+		AllowedOrigins:    config.Server.AllowedOrigins,
+		CacheDirectory:    filepath.Join(config.Server.CacheDirectory, "api"),
+		HistoryDB:         filepath.Join(config.Server.CacheDirectory, "history.db"),
+		AuditDB:           filepath.Join(config.Server.CacheDirectory, "audit.db"),
+		RequestUser:       requestUser,
+		ImageProviders:    covers,
+		Scrobblers:        apiScrobblers,
+		EventHooks:        eventHooks,
+		StateHooks:        stateHooks,
+		RPCMiddleware:     rpcMiddleware,
+		AllowAlarmOutputs: allowAlarmOutputs,
+		Metrics:           registry,
+		Logger:            logger.With("subsystem", "api"),
 	})
 	if err != nil {
 		logger.Fatalf("failed to initialize api handler: %v", err)
 	}
-	m.Handle("/", root)
+	m.Handle("/", protect(root))
 	m.Handle("/assets/", assets)
-	m.Handle("/api/", api)
+	m.Handle("/api/", protect(apiHandler))
+	m.Handle("/metrics", protect(registry))
+	health, err := api.NewHealthHandler(client, watcher, apiHandler.Loaded)
+	if err != nil {
+		logger.Fatalf("failed to initialize health handler: %v", err)
+	}
+	// probes do not require authentication
+	m.Handle(api.PathHealthz, health)
+	m.Handle(api.PathReadyz, health)
 
+	var handler http.Handler = m
+	if config.Log.Access {
+		handler = log.AccessLog(logger.With("subsystem", "http"), handler)
+	}
 	s := http.Server{
-		Handler: m,
+		Handler: handler,
 		Addr:    config.Server.Addr,
 	}
-	s.RegisterOnShutdown(api.Stop)
+	s.RegisterOnShutdown(apiHandler.Stop)
 	errs := make(chan error, 1)
 	go func() {
 		errs <- s.ListenAndServe()
@@ -193,7 +336,27 @@ func v2() {
 	if err := watcher.Close(ctx); err != nil {
 		logger.Printf("failed to close mpd connection(event): %v", err)
 	}
-	if err := api.Shutdown(ctx); err != nil {
+	if err := apiHandler.Shutdown(ctx); err != nil {
 		logger.Printf("failed to stop api background task: %v", err)
 	}
+	for _, s := range scrobblers {
+		if err := s.Shutdown(ctx); err != nil {
+			logger.Printf("failed to stop scrobbler: %v", err)
+		}
+	}
+	if bridge != nil {
+		if err := bridge.Shutdown(ctx); err != nil {
+			logger.Printf("failed to stop mqtt bridge: %v", err)
+		}
+	}
+	if player != nil {
+		if err := player.Shutdown(ctx); err != nil {
+			logger.Printf("failed to stop mpris: %v", err)
+		}
+	}
+	for _, w := range webhooks {
+		if err := w.Shutdown(ctx); err != nil {
+			logger.Printf("failed to stop webhook: %v", err)
+		}
+	}
 }